@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/mdns"
+	"github.com/spf13/cobra"
+)
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "List servers on the local network",
+	Long:  `List the file servers advertising themselves on the local network`,
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			log.Fatalf("Failed to get 'timeout' flag: %v", err)
+		}
+
+		name, err := cmd.Flags().GetString("interface")
+		if err != nil {
+			log.Fatalf("Failed to get 'interface' flag: %v", err)
+		}
+
+		var iface *net.Interface
+		if name != "" {
+			iface, err = net.InterfaceByName(name)
+			if err != nil {
+				log.Fatalf("Invalid 'interface' flag: %v", err)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		services, err := mdns.Browse(ctx, iface)
+		if err != nil {
+			log.Fatalf("Failed to discover servers: %v", err)
+		}
+
+		if len(services) == 0 {
+			log.Println("No servers found")
+			return
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tHOST\tURL")
+		for _, service := range services {
+			name := service.Text["name"]
+			if name == "" {
+				name = service.Instance
+			}
+
+			fmt.Fprintf(tw, "%v\t%v\t%v\n", name, service.Host, service.URL())
+		}
+		tw.Flush()
+	},
+}
+
+func init() {
+	serverCmd.AddCommand(discoverCmd)
+
+	discoverCmd.Flags().Duration("timeout", 3*time.Second, "How long to wait for servers to answer")
+	discoverCmd.Flags().String("interface", "", "Network interface to search on, e.g. eth0")
+}
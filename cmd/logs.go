@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/accesslog"
+	"github.com/Owbird/SVault-Engine/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show the access log",
+	Long:  `Show the requests the file server handled, oldest first`,
+	Run: func(cmd *cobra.Command, args []string) {
+		since, err := cmd.Flags().GetString("since")
+		if err != nil {
+			log.Fatalf("Failed to get 'since' flag: %v", err)
+		}
+
+		path, err := cmd.Flags().GetString("path")
+		if err != nil {
+			log.Fatalf("Failed to get 'path' flag: %v", err)
+		}
+
+		filter := accesslog.Filter{Path: path}
+
+		if since != "" {
+			filter.Since, err = parseSince(since, time.Now())
+			if err != nil {
+				log.Fatalf("Invalid 'since' flag: %v", err)
+			}
+		}
+
+		dir, err := accesslog.Dir()
+		if err != nil {
+			log.Fatalf("Failed to get access log: %v", err)
+		}
+
+		records, err := accesslog.Query(dir, filter)
+		if err != nil {
+			log.Fatalf("Failed to read access log: %v", err)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tCLIENT\tUSER\tMETHOD\tPATH\tSTATUS\tSIZE\tDURATION")
+		for _, record := range records {
+			path := record.Path
+			if record.Query != "" {
+				path += "?" + record.Query
+			}
+
+			user := record.User
+			if user == "" {
+				user = "-"
+			}
+
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+				record.Time.Local().Format(time.DateTime),
+				record.RemoteIP,
+				user,
+				record.Method,
+				path,
+				record.Status,
+				utils.FmtBytes(record.Bytes),
+				record.Duration.Round(time.Millisecond),
+			)
+		}
+		tw.Flush()
+	},
+}
+
+// parseSince reads a duration before now like 24h, a date
+// like 2024-05-01 or an RFC 3339 time
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+
+	if t, err := time.ParseInLocation(time.DateOnly, since, time.Local); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use a duration like 24h, a date like 2024-05-01 or an RFC 3339 time")
+	}
+
+	return t, nil
+}
+
+func init() {
+	serverCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().String("since", "", "Only show requests since a duration ago like 24h, a date or an RFC 3339 time")
+	logsCmd.Flags().String("path", "", "Only show requests for a path or below it")
+}
@@ -1,10 +1,18 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
-	"sync"
-
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+	appconfig "github.com/Owbird/SVault-Engine/pkg/config"
+	"github.com/Owbird/SVault-Engine/pkg/events"
 	"github.com/Owbird/SVault-Engine/pkg/models"
+	"github.com/Owbird/SVault-Engine/pkg/qrcode"
 	"github.com/Owbird/SVault-Engine/pkg/server"
 	"github.com/spf13/cobra"
 )
@@ -27,6 +35,11 @@ var shareCmd = &cobra.Command{
 			log.Fatalf("Failed to get 'file' flag: %v", err)
 		}
 
+		showQR, err := cmd.Flags().GetBool("qr")
+		if err != nil {
+			log.Fatalf("Failed to get 'qr' flag: %v", err)
+		}
+
 		svr.Share(file, server.ShareCallBacks{
 			OnSendErr: func(err error) {
 				log.Fatalf("Send error: %s", err)
@@ -36,6 +49,10 @@ var shareCmd = &cobra.Command{
 			},
 			OnCodeReceive: func(code string) {
 				log.Println("Code: ", code)
+
+				if showQR {
+					printQR(qrcode.WormholeURI(code))
+				}
 			},
 			OnProgressChange: func(progress models.FileShareProgress) {
 				log.Printf("Sent: %v/%v (%v%%)", progress.Bytes, progress.Total, progress.Percentage)
@@ -65,57 +82,115 @@ var startCmd = &cobra.Command{
 	Short: "Start the server",
 	Long:  `Start the server`,
 	Run: func(cmd *cobra.Command, args []string) {
-		dir, err := cmd.Flags().GetString("dir")
+		dirs, err := cmd.Flags().GetStringArray("dir")
 		if err != nil {
 			log.Fatalf("Failed to get 'dir' flag: %v", err)
 		}
 
-		logCh := make(chan models.ServerLog)
+		dir, mounts, err := parseDirs(dirs)
+		if err != nil {
+			log.Fatalf("Invalid 'dir' flag: %v", err)
+		}
 
-		defer close(logCh)
+		// Mounts of svault.toml are served without any flag
+		if dir == "" && len(mounts) == 0 && len(appconfig.NewAppConfig().GetSeverConfig().GetMounts()) == 0 {
+			log.Fatalf("Missing 'dir' flag: give a directory to serve or mounts in svault.toml")
+		}
 
-		wg := sync.WaitGroup{}
+		logJSON, err := cmd.Flags().GetBool("log-json")
+		if err != nil {
+			log.Fatalf("Failed to get 'log-json' flag: %v", err)
+		}
 
-		wg.Add(1)
-		go func() {
-			for l := range logCh {
-				switch l.Type {
-				case models.API_LOG:
-					if l.Error != nil {
-						log.Printf("[!] API Error: %v", l.Error)
-					} else {
-						log.Printf("[+] API Log: %v", l.Message)
-					}
-				case models.SERVE_WEB_UI_NETWORK:
-					if l.Error != nil {
-						log.Printf("[!] Network Web Run Error: %v", l.Error)
-					} else {
-						log.Printf("[+] Network Web Running: %v", l.Message)
-					}
-				case models.SERVE_WEB_UI_REMOTE:
-					if l.Error != nil {
-						log.Printf("[!] Remote Web Run Error: %v", l.Error)
-					} else {
-						log.Printf("[+] Remote Web Running: %v", l.Message)
-					}
+		remote, err := cmd.Flags().GetBool("remote")
+		if err != nil {
+			log.Fatalf("Failed to get 'remote' flag: %v", err)
+		}
+
+		showQR, err := cmd.Flags().GetBool("qr")
+		if err != nil {
+			log.Fatalf("Failed to get 'qr' flag: %v", err)
+		}
+
+		iface, err := cmd.Flags().GetString("interface")
+		if err != nil {
+			log.Fatalf("Failed to get 'interface' flag: %v", err)
+		}
+
+		server := server.NewServer(dir, nil)
+		server.Mounts = mounts
+		server.Remote = remote
+		server.Interface = iface
+
+		if logJSON {
+			server.Subscribe(events.Slog(slog.New(slog.NewJSONHandler(os.Stderr, nil))))
+		} else {
+			server.Subscribe(events.Typed(func(event events.Event) {
+				printLog(event)
 
-				default:
-					if l.Error != nil {
-						log.Printf("[!] Server Error: %v", l.Error)
-					} else {
-						log.Printf("[+] Server Log: %v", l.Message)
+				if !showQR {
+					return
+				}
+
+				// Phones scan the URLs rather than having them typed
+				switch event := event.(type) {
+				case events.NetworkURL:
+					if event.Err == nil {
+						printQR(event.URL)
+					}
+				case events.RemoteURL:
+					if event.Err == nil {
+						printQR(event.URL)
 					}
 				}
-			}
-		}()
+			}))
+		}
 
-		server := server.NewServer(dir, logCh)
+		if err := server.Start(); err != nil {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+	},
+}
 
-		wg.Add(1)
-		go server.Start()
+// printLog prints a server event for the terminal
+func printLog(event events.Event) {
+	switch event := event.(type) {
+	case events.APILog:
+		if event.Err != nil {
+			log.Printf("[!] API Error: %v", event.Err)
+		} else {
+			log.Printf("[+] API Log: %v", event.Message)
+		}
+	case events.NetworkURL:
+		if event.Err != nil {
+			log.Printf("[!] Network Web Run Error: %v", event.Err)
+		} else {
+			log.Printf("[+] Network Web Running: %v", event.URL)
+		}
+	case events.Access:
+		log.Printf("[+] Access: %v (%v bytes, %v)", event.Log().Message, event.Record.Bytes, event.Record.Duration.Round(time.Millisecond))
+	case events.RemoteURL:
+		if event.Err != nil {
+			log.Printf("[!] Remote Web Run Error: %v", event.Err)
+		} else {
+			log.Printf("[+] Remote Web Running: %v", event.URL)
+		}
+	case events.TunnelUp:
+		// The link is printed as the remote web UI
+	case events.TunnelDown:
+		log.Printf("[!] Tunnel Down: %v. %v", event.Err, event.Message)
+	}
+}
 
-		wg.Wait()
-	},
+// printQR prints the QR code of text for the terminal
+func printQR(text string) {
+	code, err := qrcode.Terminal(text)
+	if err != nil {
+		log.Printf("[!] QR Code Error: %v", err)
+		return
+	}
+
+	fmt.Print(code)
 }
 
 func init() {
@@ -125,13 +200,44 @@ func init() {
 	serverCmd.AddCommand(shareCmd)
 	serverCmd.AddCommand(receiveCmd)
 
-	startCmd.Flags().StringP("dir", "d", "", "Directory to serve")
+	startCmd.Flags().StringArrayP("dir", "d", nil, "Directory to serve, or name=path to serve it at /name. Repeat to serve several")
+	startCmd.Flags().Bool("log-json", false, "Write the logs as JSON lines to stderr")
+	startCmd.Flags().Bool("qr", true, "Print QR codes of the server URLs")
+	startCmd.Flags().String("interface", "", "Network interface to advertise the server on, e.g. eth0. Defaults to picking one")
+	startCmd.Flags().Bool("remote", false, "Expose the server on the internet through the tunnel of svault.toml")
 
 	shareCmd.Flags().StringP("file", "f", "", "File to share")
+	shareCmd.Flags().Bool("qr", true, "Print a QR code of the share code")
 
 	receiveCmd.Flags().StringP("code", "c", "", "Code from other device")
 
-	startCmd.MarkFlagRequired("dir")
 	shareCmd.MarkFlagRequired("file")
 	receiveCmd.MarkFlagRequired("code")
 }
+
+// parseDirs splits the --dir flags into the unnamed directory
+// and the name=path mounts
+func parseDirs(dirs []string) (string, map[string]string, error) {
+	dir := ""
+	mounts := map[string]string{}
+
+	for _, d := range dirs {
+		name, path, ok := strings.Cut(d, "=")
+		if !ok || !config.ValidMountName(name) {
+			if dir != "" {
+				return "", nil, fmt.Errorf("only one directory can be served without a name, got %v and %v", dir, d)
+			}
+
+			dir = d
+			continue
+		}
+
+		if _, ok := mounts[name]; ok {
+			return "", nil, fmt.Errorf("mount %v given more than once", name)
+		}
+
+		mounts[name] = path
+	}
+
+	return dir, mounts, nil
+}
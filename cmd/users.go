@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/spf13/cobra"
+)
+
+var usersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Manage file server users",
+	Long:  `Manage the users allowed to access the file server. Once a user exists every request has to log in`,
+}
+
+var usersAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a user",
+	Long:  `Add a user with a role and the paths it can access, e.g. /photos when serving mounts`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		role, err := cmd.Flags().GetString("role")
+		if err != nil {
+			log.Fatalf("Failed to get 'role' flag: %v", err)
+		}
+
+		paths, err := cmd.Flags().GetStringArray("path")
+		if err != nil {
+			log.Fatalf("Failed to get 'path' flag: %v", err)
+		}
+
+		password, err := cmd.Flags().GetString("password")
+		if err != nil {
+			log.Fatalf("Failed to get 'password' flag: %v", err)
+		}
+
+		if password == "" {
+			password = readPassword()
+		}
+
+		if err := usersStore().Add(args[0], password, role, paths...); err != nil {
+			log.Fatalf("Failed to add user: %v", err)
+		}
+
+		log.Printf("User %v added", args[0])
+	},
+}
+
+var usersRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a user",
+	Long:  `Remove a user`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := usersStore().Remove(args[0]); err != nil {
+			log.Fatalf("Failed to remove user: %v", err)
+		}
+
+		log.Printf("User %v removed", args[0])
+	},
+}
+
+var usersGrantCmd = &cobra.Command{
+	Use:   "grant <name> <path>",
+	Short: "Give a user access to a path",
+	Long:  `Give a user access to everything below a path, e.g. /photos/2024`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := usersStore().Grant(args[0], args[1]); err != nil {
+			log.Fatalf("Failed to grant path: %v", err)
+		}
+
+		log.Printf("User %v granted %v", args[0], args[1])
+	},
+}
+
+var usersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users",
+	Long:  `List users with their roles and paths`,
+	Run: func(cmd *cobra.Command, args []string) {
+		list, err := usersStore().List()
+		if err != nil {
+			log.Fatalf("Failed to list users: %v", err)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tROLE\tPATHS")
+		for _, user := range list {
+			fmt.Fprintf(tw, "%v\t%v\t%v\n", user.Name, user.Role, strings.Join(user.Paths, ", "))
+		}
+		tw.Flush()
+	},
+}
+
+func usersStore() *users.Store {
+	dir, err := users.StoreDir()
+	if err != nil {
+		log.Fatalf("Failed to get users database: %v", err)
+	}
+
+	return users.NewStore(dir)
+}
+
+// readPassword reads the password from the first line of stdin
+func readPassword() string {
+	fmt.Print("Password: ")
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("Failed to read password: %v", err)
+	}
+
+	return strings.TrimRight(line, "\r\n")
+}
+
+func init() {
+	serverCmd.AddCommand(usersCmd)
+
+	usersCmd.AddCommand(usersAddCmd)
+	usersCmd.AddCommand(usersRemoveCmd)
+	usersCmd.AddCommand(usersGrantCmd)
+	usersCmd.AddCommand(usersListCmd)
+
+	usersAddCmd.Flags().StringP("role", "r", users.ROLE_VIEWER, "Role of the user: viewer, uploader or admin")
+	usersAddCmd.Flags().StringArrayP("path", "p", []string{"/"}, "Path the user can access. Repeat to grant several")
+	usersAddCmd.Flags().String("password", "", "Password of the user, read from stdin when empty")
+}
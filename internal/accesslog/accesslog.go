@@ -0,0 +1,257 @@
+// Package accesslog persists the access records of the file
+// server as JSON lines in size rotated files
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/utils"
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+const (
+	// Name of the current log file, rotated ones get a .1, .2... suffix
+	FILE_NAME = "access.log"
+
+	// Size a log file is rotated at
+	MAX_SIZE = 10 * 1024 * 1024
+
+	// Rotated files kept, the oldest are removed
+	MAX_BACKUPS = 5
+)
+
+// Dir returns the directory of the access logs in the svault dir
+func Dir() (string, error) {
+	svaultDir, err := utils.GetSVaultDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(svaultDir, "logs"), nil
+}
+
+// Logger appends records to the log file in dir
+type Logger struct {
+	mu         sync.Mutex
+	dir        string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewLogger opens the log file in dir, rotating it once it
+// grows past maxSize bytes and keeping maxBackups rotated files
+func NewLogger(dir string, maxSize int64, maxBackups int) (*Logger, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		dir:        dir,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(filepath.Join(l.dir, FILE_NAME), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+
+	return nil
+}
+
+// backupName returns the name of the nth rotated file
+func backupName(n int) string {
+	return fmt.Sprintf("%v.%d", FILE_NAME, n)
+}
+
+// rotate shifts the rotated files up by one, dropping
+// the oldest, and starts a new log file
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(filepath.Join(l.dir, backupName(l.maxBackups)))
+
+	for n := l.maxBackups - 1; n >= 1; n-- {
+		err := os.Rename(filepath.Join(l.dir, backupName(n)), filepath.Join(l.dir, backupName(n+1)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if l.maxBackups > 0 {
+		if err := os.Rename(filepath.Join(l.dir, FILE_NAME), filepath.Join(l.dir, backupName(1))); err != nil {
+			return err
+		}
+	} else {
+		os.Remove(filepath.Join(l.dir, FILE_NAME))
+	}
+
+	return l.open()
+}
+
+// Write appends a record
+func (l *Logger) Write(record models.AccessLog) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate access log: %w", err)
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+
+	return err
+}
+
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// Filter selects records. Zero fields match everything
+type Filter struct {
+	// Only records at or after this time
+	Since time.Time
+
+	// Only requests for this path or below it, either in the
+	// URL path or in the file and dir queries
+	Path string
+}
+
+// Match reports whether record is selected by f
+func (f Filter) Match(record models.AccessLog) bool {
+	if !f.Since.IsZero() && record.Time.Before(f.Since) {
+		return false
+	}
+
+	if f.Path == "" {
+		return true
+	}
+
+	paths := []string{record.Path}
+	if query, err := url.ParseQuery(record.Query); err == nil {
+		paths = append(paths, query["file"]...)
+		paths = append(paths, query["dir"]...)
+	}
+
+	prefix := strings.TrimSuffix(f.Path, "/")
+
+	for _, p := range paths {
+		if p == f.Path || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Query returns the records in dir selected by filter, oldest first.
+// Lines that cannot be parsed are skipped
+func Query(dir string, filter Filter) ([]models.AccessLog, error) {
+	// Rotated files are older the higher their number
+	backups := []int{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), FILE_NAME+".")
+		if !ok {
+			continue
+		}
+
+		if n, err := strconv.Atoi(suffix); err == nil {
+			backups = append(backups, n)
+		}
+	}
+
+	slices.Sort(backups)
+	slices.Reverse(backups)
+
+	names := []string{}
+	for _, n := range backups {
+		names = append(names, backupName(n))
+	}
+	names = append(names, FILE_NAME)
+
+	records := []models.AccessLog{}
+
+	for _, name := range names {
+		file, err := os.Open(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return records, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			var record models.AccessLog
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				continue
+			}
+
+			if filter.Match(record) {
+				records = append(records, record)
+			}
+		}
+
+		err = scanner.Err()
+		file.Close()
+
+		if err != nil {
+			return records, err
+		}
+	}
+
+	return records, nil
+}
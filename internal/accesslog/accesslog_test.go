@@ -0,0 +1,83 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+func TestLoggerRotatesAndQueries(t *testing.T) {
+	dir := t.TempDir()
+
+	// Small enough for every record to start a new file
+	logger, err := NewLogger(dir, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	start := time.Now().Add(-time.Hour)
+
+	for i, p := range []string{"/a", "/b", "/c", "/d"} {
+		err := logger.Write(models.AccessLog{
+			Time:   start.Add(time.Duration(i) * time.Minute),
+			Method: "GET",
+			Path:   p,
+			Status: 200,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, backupName(3))); err == nil {
+		t.Error("more rotated files kept than allowed")
+	}
+
+	records, err := Query(dir, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{}
+	for _, record := range records {
+		paths = append(paths, record.Path)
+	}
+
+	// The oldest record was rotated out
+	if len(paths) != 3 || paths[0] != "/b" || paths[2] != "/d" {
+		t.Errorf("paths = %v, want [/b /c /d]", paths)
+	}
+
+	records, err = Query(dir, Filter{Since: start.Add(150 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || records[0].Path != "/d" {
+		t.Errorf("records since = %v, want /d", records)
+	}
+}
+
+func TestFilterMatchesPath(t *testing.T) {
+	tests := []struct {
+		record models.AccessLog
+		path   string
+		want   bool
+	}{
+		{models.AccessLog{Path: "/photos/a.jpg"}, "/photos", true},
+		{models.AccessLog{Path: "/photos"}, "/photos/", true},
+		{models.AccessLog{Path: "/photos2"}, "/photos", false},
+		{models.AccessLog{Path: "/download", Query: "file=%2Fphotos%2Fa.jpg"}, "/photos", true},
+		{models.AccessLog{Path: "/", Query: "dir=/docs"}, "/photos", false},
+	}
+
+	for _, tt := range tests {
+		if got := (Filter{Path: tt.path}).Match(tt.record); got != tt.want {
+			t.Errorf("Match(%v?%v, %v) = %v, want %v", tt.record.Path, tt.record.Query, tt.path, got, tt.want)
+		}
+	}
+}
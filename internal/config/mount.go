@@ -0,0 +1,111 @@
+package config
+
+import "strings"
+
+// Top level paths used by the server itself, which mounts cannot take
+var reservedMountNames = map[string]bool{
+	"api":     true,
+	"assets":  true,
+	"metrics": true,
+	"qr":      true,
+}
+
+// MountConfig is a directory served under its name,
+// e.g. /photos, with its own permissions
+type MountConfig struct {
+	// The first path segment the directory is served under
+	name string
+
+	// The directory being served
+	dir string
+
+	// Should uploads be allowed
+	allowUploads bool
+
+	// Should renaming, moving and creating directories be allowed
+	allowModify bool
+
+	// Should deleting files and directories be allowed
+	allowDelete bool
+}
+
+func NewMountConfig(name string, dir string) *MountConfig {
+	return &MountConfig{
+		name: name,
+		dir:  dir,
+	}
+}
+
+// ValidMountName reports whether name can be used as a mount.
+// Names are a single path segment of letters, digits, '.', '-'
+// and '_' that does not clash with the server's own paths
+func ValidMountName(name string) bool {
+	if name == "" || name == "." || name == ".." || reservedMountNames[strings.ToLower(name)] {
+		return false
+	}
+
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetDir sets the directory being served
+func (mc *MountConfig) SetDir(dir string) *MountConfig {
+	mc.dir = dir
+	return mc
+}
+
+// SetAllowUploads sets if uploads are allowed in the mount
+// Defaults to false
+func (mc *MountConfig) SetAllowUploads(allowUploads bool) *MountConfig {
+	mc.allowUploads = allowUploads
+	return mc
+}
+
+// SetAllowModify sets if renaming, moving and creating
+// directories are allowed in the mount
+// Defaults to false
+func (mc *MountConfig) SetAllowModify(allowModify bool) *MountConfig {
+	mc.allowModify = allowModify
+	return mc
+}
+
+// SetAllowDelete sets if deleting is allowed in the mount
+// Defaults to false
+func (mc *MountConfig) SetAllowDelete(allowDelete bool) *MountConfig {
+	mc.allowDelete = allowDelete
+	return mc
+}
+
+// GetName returns the name the mount is served under
+func (mc *MountConfig) GetName() string {
+	return mc.name
+}
+
+// GetDir returns the directory being served
+func (mc *MountConfig) GetDir() string {
+	return mc.dir
+}
+
+// GetAllowUploads returns if uploads are allowed in the mount
+func (mc *MountConfig) GetAllowUploads() bool {
+	return mc.allowUploads
+}
+
+// GetAllowModify returns if files in the mount can be renamed
+// and moved and directories created
+func (mc *MountConfig) GetAllowModify() bool {
+	return mc.allowModify
+}
+
+// GetAllowDelete returns if files in the mount can be deleted
+func (mc *MountConfig) GetAllowDelete() bool {
+	return mc.allowDelete
+}
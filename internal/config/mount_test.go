@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestValidMountName(t *testing.T) {
+	tests := map[string]bool{
+		"photos":    true,
+		"my-docs_2": true,
+		"":          false,
+		"..":        false,
+		"a/b":       false,
+		"api":       false,
+		"Assets":    false,
+		"metrics":   false,
+		"qr":        false,
+		"a b":       false,
+	}
+
+	for name, want := range tests {
+		if got := ValidMountName(name); got != want {
+			t.Errorf("ValidMountName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
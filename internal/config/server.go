@@ -1,15 +1,84 @@
 package config
 
+import "github.com/Owbird/SVault-Engine/internal/fsroot"
+
+const (
+	// Upload overwrite policies
+	OVERWRITE_REJECT    = "reject"
+	OVERWRITE_RENAME    = "rename"
+	OVERWRITE_OVERWRITE = "overwrite"
+)
+
 type ServerConfig struct {
 	// The server label to be displayed
 	name string
 
 	// Should uploads be allowed
 	allowUploads bool
+
+	// Should renaming, moving and creating directories be allowed
+	allowModify bool
+
+	// Should deleting files and directories be allowed
+	allowDelete bool
+
+	// How symlinks inside the served dir are handled
+	symlinkPolicy fsroot.SymlinkPolicy
+
+	// Maximum size of an upload request in bytes, 0 for no limit
+	maxUploadSize int64
+
+	// What happens when an upload targets an existing file
+	overwritePolicy string
+
+	// Should file names be indexed in the background for search
+	searchIndex bool
+
+	// Should dotfiles be shown in listings and search results
+	showHidden bool
+
+	// Should changes to the served dir be pushed to browsers
+	liveUpdates bool
+
+	// Directory with templates and assets overriding the built in ones
+	themeDir string
+
+	// Directories served under their names instead of a single dir
+	mounts []*MountConfig
+
+	// URL path the handlers are served under, e.g. /photos for a mount
+	basePath string
+
+	// Requests per second allowed from each client, 0 for no limit
+	rateLimit float64
+
+	// Requests a client can make at once before being limited
+	rateBurst int
+
+	// Bytes per second received and sent by the whole server, 0 for no limit
+	uploadLimit   int64
+	downloadLimit int64
+
+	// Bytes per second received and sent on each connection, 0 for no limit
+	connUploadLimit   int64
+	connDownloadLimit int64
+
+	// Should metrics be served for scraping
+	metrics bool
+
+	// Address of a separate listener for the metrics, "" to serve
+	// them at /metrics on the server itself
+	metricsAddr string
 }
 
 func NewServerConfig() *ServerConfig {
-	return &ServerConfig{}
+	return &ServerConfig{
+		symlinkPolicy:   fsroot.SymlinkWithin,
+		overwritePolicy: OVERWRITE_RENAME,
+		showHidden:      true,
+		liveUpdates:     true,
+		rateBurst:       50,
+	}
 }
 
 // SetName sets the server name
@@ -26,6 +95,177 @@ func (sc *ServerConfig) SetAllowUploads(allowUploads bool) *ServerConfig {
 	return sc
 }
 
+// SetAllowModify sets if files can be renamed and moved
+// and directories created
+// Defaults to false
+func (sc *ServerConfig) SetAllowModify(allowModify bool) *ServerConfig {
+	sc.allowModify = allowModify
+	return sc
+}
+
+// SetAllowDelete sets if files and directories can be deleted
+// Defaults to false
+func (sc *ServerConfig) SetAllowDelete(allowDelete bool) *ServerConfig {
+	sc.allowDelete = allowDelete
+	return sc
+}
+
+// SetSymlinkPolicy sets how symlinks inside the served dir are handled.
+// One of "deny", "within" or "follow"
+// Defaults to "within"
+func (sc *ServerConfig) SetSymlinkPolicy(symlinkPolicy string) *ServerConfig {
+	sc.symlinkPolicy = fsroot.ParseSymlinkPolicy(symlinkPolicy)
+	return sc
+}
+
+// SetMaxUploadSize sets the maximum size of an upload request in bytes.
+// 0 means no limit
+// Defaults to 0
+func (sc *ServerConfig) SetMaxUploadSize(maxUploadSize int64) *ServerConfig {
+	sc.maxUploadSize = maxUploadSize
+	return sc
+}
+
+// SetOverwritePolicy sets what happens when an upload targets an existing file.
+// One of "reject", "rename" or "overwrite"
+// Defaults to "rename"
+func (sc *ServerConfig) SetOverwritePolicy(overwritePolicy string) *ServerConfig {
+	switch overwritePolicy {
+	case OVERWRITE_REJECT, OVERWRITE_OVERWRITE:
+		sc.overwritePolicy = overwritePolicy
+	default:
+		sc.overwritePolicy = OVERWRITE_RENAME
+	}
+	return sc
+}
+
+// SetSearchIndex sets if file names under the served dir are kept
+// in an index updated by a file watcher, making search fast on large
+// trees. Without it every search walks the tree
+// Defaults to false
+func (sc *ServerConfig) SetSearchIndex(searchIndex bool) *ServerConfig {
+	sc.searchIndex = searchIndex
+	return sc
+}
+
+// SetShowHidden sets if dotfiles are shown in listings and search
+// results. Hidden files can still be downloaded by path
+// Defaults to true
+func (sc *ServerConfig) SetShowHidden(showHidden bool) *ServerConfig {
+	sc.showHidden = showHidden
+	return sc
+}
+
+// SetLiveUpdates sets if changes to the served dir are pushed
+// to connected browsers through the /events stream
+// Defaults to true
+func (sc *ServerConfig) SetLiveUpdates(liveUpdates bool) *ServerConfig {
+	sc.liveUpdates = liveUpdates
+	return sc
+}
+
+// SetThemeDir sets a directory whose *.html templates and
+// assets/ files replace the built in ones of the same name
+// Defaults to "", the built in theme
+func (sc *ServerConfig) SetThemeDir(themeDir string) *ServerConfig {
+	sc.themeDir = themeDir
+	return sc
+}
+
+// SetRateLimit sets the requests per second allowed from each
+// client. Further requests are refused with 429 Too Many Requests.
+// 0 means no limit
+// Defaults to 0
+func (sc *ServerConfig) SetRateLimit(rateLimit float64) *ServerConfig {
+	sc.rateLimit = rateLimit
+	return sc
+}
+
+// SetRateBurst sets how many requests a client can make at once,
+// like the assets and thumbnails of a page, before the rate limit
+// applies
+// Defaults to 50
+func (sc *ServerConfig) SetRateBurst(rateBurst int) *ServerConfig {
+	sc.rateBurst = rateBurst
+	return sc
+}
+
+// SetUploadLimit sets the bytes per second the server receives
+// across all uploads. 0 means no limit
+// Defaults to 0
+func (sc *ServerConfig) SetUploadLimit(uploadLimit int64) *ServerConfig {
+	sc.uploadLimit = uploadLimit
+	return sc
+}
+
+// SetDownloadLimit sets the bytes per second the server sends
+// across all downloads. 0 means no limit
+// Defaults to 0
+func (sc *ServerConfig) SetDownloadLimit(downloadLimit int64) *ServerConfig {
+	sc.downloadLimit = downloadLimit
+	return sc
+}
+
+// SetConnUploadLimit sets the bytes per second received on each
+// connection. 0 means no limit
+// Defaults to 0
+func (sc *ServerConfig) SetConnUploadLimit(connUploadLimit int64) *ServerConfig {
+	sc.connUploadLimit = connUploadLimit
+	return sc
+}
+
+// SetConnDownloadLimit sets the bytes per second sent on each
+// connection. 0 means no limit
+// Defaults to 0
+func (sc *ServerConfig) SetConnDownloadLimit(connDownloadLimit int64) *ServerConfig {
+	sc.connDownloadLimit = connDownloadLimit
+	return sc
+}
+
+// SetMetrics sets if metrics are served for scraping
+// Defaults to false
+func (sc *ServerConfig) SetMetrics(metrics bool) *ServerConfig {
+	sc.metrics = metrics
+	return sc
+}
+
+// SetMetricsAddr sets the address the metrics are served on
+// instead of /metrics on the server, e.g. "127.0.0.1:9090"
+// Defaults to ""
+func (sc *ServerConfig) SetMetricsAddr(metricsAddr string) *ServerConfig {
+	sc.metricsAddr = metricsAddr
+	return sc
+}
+
+// AddMount adds a directory served under its name, replacing
+// any mount with the same name
+// Defaults to no mounts, serving a single dir
+func (sc *ServerConfig) AddMount(mount *MountConfig) *ServerConfig {
+	for i, m := range sc.mounts {
+		if m.GetName() == mount.GetName() {
+			sc.mounts[i] = mount
+			return sc
+		}
+	}
+
+	sc.mounts = append(sc.mounts, mount)
+	return sc
+}
+
+// ForMount returns a copy of the configuration with the
+// permissions of mount, for the handlers serving it
+func (sc *ServerConfig) ForMount(mount *MountConfig) *ServerConfig {
+	mountConfig := *sc
+
+	mountConfig.allowUploads = mount.GetAllowUploads()
+	mountConfig.allowModify = mount.GetAllowModify()
+	mountConfig.allowDelete = mount.GetAllowDelete()
+	mountConfig.mounts = nil
+	mountConfig.basePath = "/" + mount.GetName()
+
+	return &mountConfig
+}
+
 // GetName returns the server name
 func (sc *ServerConfig) GetName() string {
 	return sc.name
@@ -35,3 +275,101 @@ func (sc *ServerConfig) GetName() string {
 func (sc *ServerConfig) GetAllowUploads() bool {
 	return sc.allowUploads
 }
+
+// GetAllowModify returns if files can be renamed and moved
+// and directories created
+func (sc *ServerConfig) GetAllowModify() bool {
+	return sc.allowModify
+}
+
+// GetAllowDelete returns if files and directories can be deleted
+func (sc *ServerConfig) GetAllowDelete() bool {
+	return sc.allowDelete
+}
+
+// GetSymlinkPolicy returns how symlinks inside the served dir are handled
+func (sc *ServerConfig) GetSymlinkPolicy() fsroot.SymlinkPolicy {
+	return sc.symlinkPolicy
+}
+
+// GetMaxUploadSize returns the maximum size of an upload request in bytes
+func (sc *ServerConfig) GetMaxUploadSize() int64 {
+	return sc.maxUploadSize
+}
+
+// GetOverwritePolicy returns what happens when an upload targets an existing file
+func (sc *ServerConfig) GetOverwritePolicy() string {
+	return sc.overwritePolicy
+}
+
+// GetSearchIndex returns if file names are indexed for search
+func (sc *ServerConfig) GetSearchIndex() bool {
+	return sc.searchIndex
+}
+
+// GetShowHidden returns if dotfiles are shown in listings
+func (sc *ServerConfig) GetShowHidden() bool {
+	return sc.showHidden
+}
+
+// GetLiveUpdates returns if changes are pushed to connected browsers
+func (sc *ServerConfig) GetLiveUpdates() bool {
+	return sc.liveUpdates
+}
+
+// GetThemeDir returns the directory overriding the built in theme
+func (sc *ServerConfig) GetThemeDir() string {
+	return sc.themeDir
+}
+
+// GetMounts returns the directories served under their names
+func (sc *ServerConfig) GetMounts() []*MountConfig {
+	return sc.mounts
+}
+
+// GetBasePath returns the URL path the handlers are served under,
+// "" when they are served at the root
+func (sc *ServerConfig) GetBasePath() string {
+	return sc.basePath
+}
+
+// GetRateLimit returns the requests per second allowed from each client
+func (sc *ServerConfig) GetRateLimit() float64 {
+	return sc.rateLimit
+}
+
+// GetRateBurst returns how many requests a client can make at once
+func (sc *ServerConfig) GetRateBurst() int {
+	return sc.rateBurst
+}
+
+// GetUploadLimit returns the bytes per second received across all uploads
+func (sc *ServerConfig) GetUploadLimit() int64 {
+	return sc.uploadLimit
+}
+
+// GetDownloadLimit returns the bytes per second sent across all downloads
+func (sc *ServerConfig) GetDownloadLimit() int64 {
+	return sc.downloadLimit
+}
+
+// GetConnUploadLimit returns the bytes per second received on each connection
+func (sc *ServerConfig) GetConnUploadLimit() int64 {
+	return sc.connUploadLimit
+}
+
+// GetConnDownloadLimit returns the bytes per second sent on each connection
+func (sc *ServerConfig) GetConnDownloadLimit() int64 {
+	return sc.connDownloadLimit
+}
+
+// GetMetrics returns if metrics are served for scraping
+func (sc *ServerConfig) GetMetrics() bool {
+	return sc.metrics
+}
+
+// GetMetricsAddr returns the separate address of the metrics,
+// "" when they are served at /metrics
+func (sc *ServerConfig) GetMetricsAddr() string {
+	return sc.metricsAddr
+}
@@ -0,0 +1,143 @@
+package config
+
+const (
+	// Tunnel providers
+	TUNNEL_LOCALTUNNEL = "localtunnel"
+	TUNNEL_SSH         = "ssh"
+	TUNNEL_NONE        = "none"
+)
+
+// TunnelConfig selects how the web UI is exposed remotely
+type TunnelConfig struct {
+	// One of the tunnel providers
+	provider string
+
+	// The localtunnel server handing out tunnels
+	baseURL string
+
+	// The SSH server forwarding its port, as host:port
+	sshHost string
+
+	// The user logged in as on the SSH server
+	sshUser string
+
+	// The private key used to log in
+	sshKey string
+
+	// The known_hosts file checking the key of the SSH server
+	sshKnownHosts string
+
+	// The address the SSH server listens on for the tunnel
+	sshRemoteAddr string
+
+	// The URL the tunnel is reached at, when the provider cannot tell
+	publicURL string
+}
+
+func NewTunnelConfig() *TunnelConfig {
+	return &TunnelConfig{
+		provider:      TUNNEL_LOCALTUNNEL,
+		baseURL:       "https://loca.lt",
+		sshRemoteAddr: "localhost:8080",
+	}
+}
+
+// SetProvider sets the tunnel provider.
+// One of "localtunnel", "ssh" or "none"
+// Defaults to "localtunnel"
+func (tc *TunnelConfig) SetProvider(provider string) *TunnelConfig {
+	tc.provider = provider
+	return tc
+}
+
+// SetBaseURL sets the localtunnel server handing out tunnels
+// Defaults to "https://loca.lt"
+func (tc *TunnelConfig) SetBaseURL(baseURL string) *TunnelConfig {
+	tc.baseURL = baseURL
+	return tc
+}
+
+// SetSSHHost sets the SSH server forwarding its port, as host:port
+// Defaults to ""
+func (tc *TunnelConfig) SetSSHHost(sshHost string) *TunnelConfig {
+	tc.sshHost = sshHost
+	return tc
+}
+
+// SetSSHUser sets the user logged in as on the SSH server
+// Defaults to ""
+func (tc *TunnelConfig) SetSSHUser(sshUser string) *TunnelConfig {
+	tc.sshUser = sshUser
+	return tc
+}
+
+// SetSSHKey sets the path of the private key used to log in
+// Defaults to ""
+func (tc *TunnelConfig) SetSSHKey(sshKey string) *TunnelConfig {
+	tc.sshKey = sshKey
+	return tc
+}
+
+// SetSSHKnownHosts sets the path of the known_hosts file checking
+// the key of the SSH server. "" uses ~/.ssh/known_hosts
+// Defaults to ""
+func (tc *TunnelConfig) SetSSHKnownHosts(sshKnownHosts string) *TunnelConfig {
+	tc.sshKnownHosts = sshKnownHosts
+	return tc
+}
+
+// SetSSHRemoteAddr sets the address the SSH server listens on
+// for the tunnel
+// Defaults to "localhost:8080"
+func (tc *TunnelConfig) SetSSHRemoteAddr(sshRemoteAddr string) *TunnelConfig {
+	tc.sshRemoteAddr = sshRemoteAddr
+	return tc
+}
+
+// SetPublicURL sets the URL the tunnel is reached at, e.g. a
+// reverse proxy in front of the port of the SSH server
+// Defaults to ""
+func (tc *TunnelConfig) SetPublicURL(publicURL string) *TunnelConfig {
+	tc.publicURL = publicURL
+	return tc
+}
+
+// GetProvider returns the tunnel provider
+func (tc *TunnelConfig) GetProvider() string {
+	return tc.provider
+}
+
+// GetBaseURL returns the localtunnel server handing out tunnels
+func (tc *TunnelConfig) GetBaseURL() string {
+	return tc.baseURL
+}
+
+// GetSSHHost returns the SSH server forwarding its port
+func (tc *TunnelConfig) GetSSHHost() string {
+	return tc.sshHost
+}
+
+// GetSSHUser returns the user logged in as on the SSH server
+func (tc *TunnelConfig) GetSSHUser() string {
+	return tc.sshUser
+}
+
+// GetSSHKey returns the path of the private key used to log in
+func (tc *TunnelConfig) GetSSHKey() string {
+	return tc.sshKey
+}
+
+// GetSSHKnownHosts returns the path of the known_hosts file
+func (tc *TunnelConfig) GetSSHKnownHosts() string {
+	return tc.sshKnownHosts
+}
+
+// GetSSHRemoteAddr returns the address the SSH server listens on
+func (tc *TunnelConfig) GetSSHRemoteAddr() string {
+	return tc.sshRemoteAddr
+}
+
+// GetPublicURL returns the URL the tunnel is reached at
+func (tc *TunnelConfig) GetPublicURL() string {
+	return tc.publicURL
+}
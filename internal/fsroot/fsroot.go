@@ -0,0 +1,421 @@
+// Package fsroot confines file system access to a single
+// directory tree, in the spirit of os.Root
+package fsroot
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy decides how symlinks found under the root are treated
+type SymlinkPolicy string
+
+const (
+	// SymlinkDeny rejects any path that passes through a symlink
+	SymlinkDeny SymlinkPolicy = "deny"
+
+	// SymlinkWithin follows symlinks as long as their target
+	// stays inside the root
+	SymlinkWithin SymlinkPolicy = "within"
+
+	// SymlinkFollow follows symlinks wherever they point
+	SymlinkFollow SymlinkPolicy = "follow"
+)
+
+var (
+	// ErrOutsideRoot is returned when a path resolves outside the root
+	ErrOutsideRoot = errors.New("path escapes root")
+
+	// ErrSymlink is returned when a path crosses a symlink the
+	// policy does not allow
+	ErrSymlink = errors.New("path crosses a symlink")
+
+	// ErrIsRoot is returned when an operation would remove
+	// or move the root itself
+	ErrIsRoot = errors.New("path is the root")
+)
+
+// Root is a directory that all paths are resolved against
+type Root struct {
+	// The directory as given
+	dir string
+
+	// The directory with symlinks evaluated
+	realDir string
+
+	policy SymlinkPolicy
+}
+
+// ParseSymlinkPolicy converts a config value into a SymlinkPolicy,
+// falling back to SymlinkWithin for unknown values
+func ParseSymlinkPolicy(policy string) SymlinkPolicy {
+	switch SymlinkPolicy(policy) {
+	case SymlinkDeny, SymlinkFollow:
+		return SymlinkPolicy(policy)
+	default:
+		return SymlinkWithin
+	}
+}
+
+// Open opens dir as a Root using the given symlink policy
+func Open(dir string, policy SymlinkPolicy) (*Root, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	realDir, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(realDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: errors.New("not a directory")}
+	}
+
+	return &Root{
+		dir:     abs,
+		realDir: realDir,
+		policy:  ParseSymlinkPolicy(string(policy)),
+	}, nil
+}
+
+// Name returns the absolute directory of the root
+func (r *Root) Name() string {
+	return r.dir
+}
+
+// RealName returns the absolute directory of the root with
+// symlinks evaluated, for walking and watching the tree
+func (r *Root) RealName() string {
+	return r.realDir
+}
+
+// Policy returns the symlink policy of the root
+func (r *Root) Policy() SymlinkPolicy {
+	return r.policy
+}
+
+// Clean normalizes a client supplied path into a slash separated
+// path relative to the root. Paths that climb above the root
+// are rejected rather than clamped.
+func Clean(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", ErrOutsideRoot
+	}
+
+	name = filepath.ToSlash(name)
+	if filepath.VolumeName(name) != "" {
+		return "", ErrOutsideRoot
+	}
+
+	cleaned := path.Clean(strings.TrimLeft(name, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrOutsideRoot
+	}
+
+	return cleaned, nil
+}
+
+// Resolve maps name onto the root and returns the file system path
+// to use. The path does not have to exist, which allows resolving
+// the target of a new file.
+func (r *Root) Resolve(name string) (string, error) {
+	rel, err := Clean(name)
+	if err != nil {
+		return "", err
+	}
+
+	full := filepath.Join(r.realDir, filepath.FromSlash(rel))
+
+	switch r.policy {
+	case SymlinkFollow:
+		return full, nil
+	case SymlinkDeny:
+		return full, r.checkNoSymlinks(rel)
+	default:
+		return r.resolveWithin(full)
+	}
+}
+
+// checkNoSymlinks walks every component of rel and fails on the
+// first symlink found
+func (r *Root) checkNoSymlinks(rel string) error {
+	if rel == "." {
+		return nil
+	}
+
+	current := r.realDir
+
+	for _, part := range strings.Split(rel, "/") {
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return ErrSymlink
+		}
+	}
+
+	return nil
+}
+
+// resolveWithin evaluates the symlinks in the longest existing
+// prefix of full and makes sure the result stays in the root
+func (r *Root) resolveWithin(full string) (string, error) {
+	existing := full
+	missing := ""
+
+	for {
+		evaluated, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			resolved := filepath.Join(evaluated, missing)
+			if !r.contains(resolved) {
+				return "", ErrOutsideRoot
+			}
+
+			return resolved, nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		// A dangling symlink cannot be checked, refuse it
+		if info, lerr := os.Lstat(existing); lerr == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return "", ErrSymlink
+		}
+
+		if existing == r.realDir {
+			return "", err
+		}
+
+		missing = filepath.Join(filepath.Base(existing), missing)
+		existing = filepath.Dir(existing)
+	}
+}
+
+// contains reports whether p is the root or lies below it
+func (r *Root) contains(p string) bool {
+	rel, err := filepath.Rel(r.realDir, p)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// Open opens the named file for reading
+func (r *Root) Open(name string) (*os.File, error) {
+	p, err := r.Resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return os.Open(p)
+}
+
+// OpenFile opens the named file with the given flags and permissions
+func (r *Root) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	p, err := r.Resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return os.OpenFile(p, flag, perm)
+}
+
+// Stat returns the file info of the named file, following
+// symlinks the policy allows
+func (r *Root) Stat(name string) (fs.FileInfo, error) {
+	p, err := r.Resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return os.Stat(p)
+}
+
+// ReadDir reads the named directory. Entries that cannot be
+// reached under the symlink policy are left out.
+func (r *Root) ReadDir(name string) ([]os.DirEntry, error) {
+	rel, err := Clean(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	p, err := r.Resolve(rel)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]os.DirEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.Type()&fs.ModeSymlink != 0 && r.policy != SymlinkFollow {
+			if _, err := r.Resolve(path.Join(rel, entry.Name())); err != nil {
+				continue
+			}
+		}
+
+		allowed = append(allowed, entry)
+	}
+
+	return allowed, nil
+}
+
+// Mkdir creates the named directory
+func (r *Root) Mkdir(name string, perm fs.FileMode) error {
+	p, err := r.Resolve(name)
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+
+	return os.Mkdir(p, perm)
+}
+
+// MkdirAll creates the named directory along with any missing parents
+func (r *Root) MkdirAll(name string, perm fs.FileMode) error {
+	p, err := r.Resolve(name)
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+
+	return os.MkdirAll(p, perm)
+}
+
+// resolveEntry resolves the parent of name with the symlink policy
+// and returns the path of name itself without following it, so
+// operations act on a symlink rather than on its target
+func (r *Root) resolveEntry(name string) (string, error) {
+	rel, err := Clean(name)
+	if err != nil {
+		return "", err
+	}
+
+	if rel == "." {
+		return "", ErrIsRoot
+	}
+
+	parent, err := r.Resolve(path.Dir(rel))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(parent, path.Base(rel)), nil
+}
+
+// Lstat returns the file info of the named file
+// without following a final symlink
+func (r *Root) Lstat(name string) (fs.FileInfo, error) {
+	p, err := r.resolveEntry(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+
+	return os.Lstat(p)
+}
+
+// RemoveAll removes the named file or directory with its contents.
+// A symlink is removed rather than what it points to
+func (r *Root) RemoveAll(name string) error {
+	p, err := r.resolveEntry(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	if _, err := os.Lstat(p); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(p)
+}
+
+// Rename moves oldname to newname. A symlink is moved rather
+// than what it points to
+func (r *Root) Rename(oldname string, newname string) error {
+	oldPath, err := r.resolveEntry(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	newPath, err := r.resolveEntry(newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	return os.Rename(oldPath, newPath)
+}
+
+// RenameNoReplace renames oldname to newname, failing with
+// fs.ErrExist instead of replacing anything at newname
+func (r *Root) RenameNoReplace(oldname string, newname string) error {
+	oldPath, err := r.resolveEntry(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	newPath, err := r.resolveEntry(newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	if err := renameNoReplace(oldPath, newPath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	return nil
+}
+
+// linkNoReplace moves a file with a hard link, which never
+// replaces newpath, falling back to a checked rename for
+// directories and where links are unsupported
+func linkNoReplace(oldpath string, newpath string) error {
+	info, err := os.Lstat(oldpath)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		err := os.Link(oldpath, newpath)
+		if err == nil {
+			return os.Remove(oldpath)
+		}
+
+		if errors.Is(err, fs.ErrExist) {
+			return fs.ErrExist
+		}
+	}
+
+	if _, err := os.Lstat(newpath); err == nil {
+		return fs.ErrExist
+	}
+
+	return os.Rename(oldpath, newpath)
+}
+
+// IsDenied reports whether err was caused by a path being
+// rejected by the root
+func IsDenied(err error) bool {
+	return errors.Is(err, ErrOutsideRoot) || errors.Is(err, ErrSymlink) || errors.Is(err, ErrIsRoot)
+}
@@ -0,0 +1,298 @@
+package fsroot
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupRoot creates the following tree and returns the served dir
+//
+//	outside/secret.txt
+//	served/file.txt
+//	served/sub/nested.txt
+//	served/link-in -> served/sub
+//	served/link-out -> outside
+//	served/link-secret -> outside/secret.txt
+//	served/dangling -> served/missing
+func setupRoot(t *testing.T) string {
+	t.Helper()
+
+	base := t.TempDir()
+	served := filepath.Join(base, "served")
+	outside := filepath.Join(base, "outside")
+
+	for _, dir := range []string{filepath.Join(served, "sub"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		filepath.Join(outside, "secret.txt"):       "secret",
+		filepath.Join(served, "file.txt"):          "file",
+		filepath.Join(served, "sub", "nested.txt"): "nested",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"link-in":     filepath.Join(served, "sub"),
+		"link-out":    outside,
+		"link-secret": filepath.Join(outside, "secret.txt"),
+		"dangling":    filepath.Join(served, "missing"),
+	}
+
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(served, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	return served
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "", want: "."},
+		{name: "/", want: "."},
+		{name: "//", want: "."},
+		{name: "file.txt", want: "file.txt"},
+		{name: "/sub/nested.txt", want: "sub/nested.txt"},
+		{name: "//sub//nested.txt", want: "sub/nested.txt"},
+		{name: "sub/../file.txt", want: "file.txt"},
+		{name: "..%2f..%2fetc", want: "..%2f..%2fetc"},
+		{name: "...", want: "..."},
+		{name: "..", wantErr: true},
+		{name: "../", wantErr: true},
+		{name: "/..", wantErr: true},
+		{name: "../etc/passwd", wantErr: true},
+		{name: "/../../etc/passwd", wantErr: true},
+		{name: "a/../../etc/passwd", wantErr: true},
+		{name: "sub/../../served/file.txt", wantErr: true},
+		{name: "file.txt\x00.png", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Clean(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Clean(%q) = %q, want error", tt.name, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Clean(%q) unexpected error: %v", tt.name, err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("Clean(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	served := setupRoot(t)
+
+	// allowed maps a policy to whether the path must resolve
+	tests := []struct {
+		name    string
+		allowed map[SymlinkPolicy]bool
+	}{
+		{"file.txt", map[SymlinkPolicy]bool{SymlinkDeny: true, SymlinkWithin: true, SymlinkFollow: true}},
+		{"/sub/nested.txt", map[SymlinkPolicy]bool{SymlinkDeny: true, SymlinkWithin: true, SymlinkFollow: true}},
+		{"sub/new-file.txt", map[SymlinkPolicy]bool{SymlinkDeny: true, SymlinkWithin: true, SymlinkFollow: true}},
+		{"new-dir/new-file.txt", map[SymlinkPolicy]bool{SymlinkDeny: true, SymlinkWithin: true, SymlinkFollow: true}},
+		{"../outside/secret.txt", map[SymlinkPolicy]bool{}},
+		{"a/../../etc/passwd", map[SymlinkPolicy]bool{}},
+		{"/../../../../etc/passwd", map[SymlinkPolicy]bool{}},
+		{"sub/../../outside/secret.txt", map[SymlinkPolicy]bool{}},
+		{"link-in/nested.txt", map[SymlinkPolicy]bool{SymlinkWithin: true, SymlinkFollow: true}},
+		{"link-out/secret.txt", map[SymlinkPolicy]bool{SymlinkFollow: true}},
+		{"link-out/new-file.txt", map[SymlinkPolicy]bool{SymlinkFollow: true}},
+		{"link-secret", map[SymlinkPolicy]bool{SymlinkFollow: true}},
+		{"link-out/../file.txt", map[SymlinkPolicy]bool{SymlinkDeny: true, SymlinkWithin: true, SymlinkFollow: true}},
+		{"dangling", map[SymlinkPolicy]bool{SymlinkFollow: true}},
+		{"dangling/new-file.txt", map[SymlinkPolicy]bool{SymlinkFollow: true}},
+	}
+
+	for _, policy := range []SymlinkPolicy{SymlinkDeny, SymlinkWithin, SymlinkFollow} {
+		root, err := Open(served, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range tests {
+			t.Run(string(policy)+"/"+tt.name, func(t *testing.T) {
+				_, err := root.Resolve(tt.name)
+
+				if tt.allowed[policy] && err != nil {
+					t.Fatalf("Resolve(%q) unexpected error: %v", tt.name, err)
+				}
+
+				if !tt.allowed[policy] && err == nil {
+					t.Fatalf("Resolve(%q) succeeded, want rejection", tt.name)
+				}
+
+				if !tt.allowed[policy] && !IsDenied(err) {
+					t.Fatalf("Resolve(%q) error %v is not a denial", tt.name, err)
+				}
+			})
+		}
+	}
+}
+
+func TestReadDirHidesUnreachableLinks(t *testing.T) {
+	served := setupRoot(t)
+
+	tests := []struct {
+		policy SymlinkPolicy
+		want   []string
+	}{
+		{SymlinkDeny, []string{"file.txt", "sub"}},
+		{SymlinkWithin, []string{"file.txt", "link-in", "sub"}},
+		{SymlinkFollow, []string{"dangling", "file.txt", "link-in", "link-out", "link-secret", "sub"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			root, err := Open(served, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := root.ReadDir("/")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("ReadDir = %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("ReadDir = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenRejectsEscapes(t *testing.T) {
+	served := setupRoot(t)
+
+	root, err := Open(served, SymlinkWithin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"../outside/secret.txt", "link-secret", "link-out/secret.txt"} {
+		if f, err := root.Open(name); err == nil {
+			f.Close()
+			t.Fatalf("Open(%q) succeeded, want rejection", name)
+		}
+	}
+}
+
+func TestMutationsActOnLinks(t *testing.T) {
+	served := setupRoot(t)
+
+	root, err := Open(served, SymlinkWithin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := root.RemoveAll("link-in"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(served, "sub", "nested.txt")); err != nil {
+		t.Fatalf("removing a link removed its target: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"/", root.RemoveAll("/")},
+		{"..", root.RemoveAll("..")},
+		{"link-out/secret.txt", root.RemoveAll("link-out/secret.txt")},
+		{"rename root", root.Rename(".", "moved")},
+		{"rename out", root.Rename("file.txt", "../file.txt")},
+		{"rename through link", root.Rename("file.txt", "link-out/file.txt")},
+	}
+
+	for _, tt := range tests {
+		if !IsDenied(tt.err) {
+			t.Fatalf("%v: error %v is not a denial", tt.name, tt.err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(served, "..", "outside", "secret.txt")); err != nil {
+		t.Fatalf("file outside the root was touched: %v", err)
+	}
+}
+
+func TestRenameNoReplace(t *testing.T) {
+	served := setupRoot(t)
+
+	root, err := Open(served, SymlinkWithin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(served, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ oldname, newname string }{
+		{"file.txt", "sub/nested.txt"},
+		{"sub", "empty"},
+	}
+
+	for _, tt := range tests {
+		if err := root.RenameNoReplace(tt.oldname, tt.newname); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("RenameNoReplace(%v, %v) = %v, want %v", tt.oldname, tt.newname, err, fs.ErrExist)
+		}
+
+		// The fallback must refuse as well
+		if err := linkNoReplace(filepath.Join(served, tt.oldname), filepath.Join(served, tt.newname)); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("linkNoReplace(%v, %v) = %v, want %v", tt.oldname, tt.newname, err, fs.ErrExist)
+		}
+	}
+
+	if content, err := os.ReadFile(filepath.Join(served, "sub", "nested.txt")); err != nil || string(content) == "file" {
+		t.Fatalf("existing file was replaced: %v", err)
+	}
+
+	if err := root.RenameNoReplace("file.txt", "sub/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := linkNoReplace(filepath.Join(served, "sub", "file.txt"), filepath.Join(served, "file.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(served, "file.txt")); err != nil {
+		t.Fatalf("file not moved back: %v", err)
+	}
+}
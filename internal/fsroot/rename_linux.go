@@ -0,0 +1,18 @@
+package fsroot
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameNoReplace renames atomically without replacing newpath,
+// on file systems supporting it
+func renameNoReplace(oldpath string, newpath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldpath, unix.AT_FDCWD, newpath, unix.RENAME_NOREPLACE)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) {
+		return linkNoReplace(oldpath, newpath)
+	}
+
+	return err
+}
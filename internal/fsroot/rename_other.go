@@ -0,0 +1,8 @@
+//go:build !linux
+
+package fsroot
+
+// renameNoReplace renames without replacing newpath
+func renameNoReplace(oldpath string, newpath string) error {
+	return linkNoReplace(oldpath, newpath)
+}
@@ -0,0 +1,459 @@
+// Package mdns advertises file servers on the local network
+// over mDNS/DNS-SD and discovers the advertised ones
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// The DNS-SD service type of the file servers
+	SERVICE = "_svault._tcp"
+
+	DOMAIN = "local."
+
+	// How long the records may be cached
+	TTL = 120
+)
+
+// The mDNS group and port
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Set on records to replace those cached for the name
+const cacheFlush = 1 << 15
+
+var serviceName = dnsmessage.MustNewName(SERVICE + "." + DOMAIN)
+
+// Lists the service types on the network, for DNS-SD browsers
+var servicesName = dnsmessage.MustNewName("_services._dns-sd._udp." + DOMAIN)
+
+// Service is a file server on the local network
+type Service struct {
+	// The name of the server, unique on the network
+	Instance string
+
+	// The host name of the machine, without .local
+	Host string
+
+	Port int
+
+	IPs []net.IP
+
+	// The key=value pairs of the TXT record
+	Text map[string]string
+}
+
+// URL returns the address of the web UI of the service
+func (s Service) URL() string {
+	if len(s.IPs) == 0 {
+		return fmt.Sprintf("http://%v.local:%v", s.Host, s.Port)
+	}
+
+	return fmt.Sprintf("http://%v", net.JoinHostPort(s.IPs[0].String(), fmt.Sprint(s.Port)))
+}
+
+// label returns s as a single DNS label, which cannot
+// contain dots and is at most 63 bytes long
+func label(s string) string {
+	s = strings.ReplaceAll(s, ".", " ")
+
+	for len(s) > 63 {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+
+	return s
+}
+
+func (s Service) instanceName() (dnsmessage.Name, error) {
+	return dnsmessage.NewName(label(s.Instance) + "." + SERVICE + "." + DOMAIN)
+}
+
+func (s Service) hostName() (dnsmessage.Name, error) {
+	return dnsmessage.NewName(label(s.Host) + "." + DOMAIN)
+}
+
+// records returns the PTR, SRV, TXT and A records of s
+func (s Service) records(ttl uint32) (ptr dnsmessage.Resource, others []dnsmessage.Resource, err error) {
+	instance, err := s.instanceName()
+	if err != nil {
+		return ptr, nil, err
+	}
+
+	host, err := s.hostName()
+	if err != nil {
+		return ptr, nil, err
+	}
+
+	ptr = dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: serviceName, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.PTRResource{PTR: instance},
+	}
+
+	unique := dnsmessage.ResourceHeader{Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl}
+
+	srv := unique
+	srv.Name = instance
+	srv.Type = dnsmessage.TypeSRV
+	others = append(others, dnsmessage.Resource{
+		Header: srv,
+		Body:   &dnsmessage.SRVResource{Port: uint16(s.Port), Target: host},
+	})
+
+	txt := []string{}
+	for key, value := range s.Text {
+		txt = append(txt, key+"="+value)
+	}
+	slices.Sort(txt)
+
+	// A TXT record needs at least one string
+	if len(txt) == 0 {
+		txt = append(txt, "")
+	}
+
+	txtHeader := unique
+	txtHeader.Name = instance
+	txtHeader.Type = dnsmessage.TypeTXT
+	others = append(others, dnsmessage.Resource{
+		Header: txtHeader,
+		Body:   &dnsmessage.TXTResource{TXT: txt},
+	})
+
+	for _, ip := range s.IPs {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			continue
+		}
+
+		a := unique
+		a.Name = host
+		a.Type = dnsmessage.TypeA
+		others = append(others, dnsmessage.Resource{
+			Header: a,
+			Body:   &dnsmessage.AResource{A: [4]byte(ip4)},
+		})
+	}
+
+	return ptr, others, nil
+}
+
+// answer returns the response of s to query, or nil when
+// s is not asked about
+func (s Service) answer(query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	ptr, others, err := s.records(TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, _ := s.instanceName()
+	host, _ := s.hostName()
+
+	response := &dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+	}
+
+	add := func(resources *[]dnsmessage.Resource, r dnsmessage.Resource) {
+		for _, existing := range *resources {
+			if existing.GoString() == r.GoString() {
+				return
+			}
+		}
+		*resources = append(*resources, r)
+	}
+
+	for _, q := range query.Questions {
+		if q.Class&^cacheFlush != dnsmessage.ClassINET && q.Class&^cacheFlush != dnsmessage.ClassANY {
+			continue
+		}
+
+		switch {
+		case sameName(q.Name, servicesName) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+			add(&response.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: servicesName, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: TTL},
+				Body:   &dnsmessage.PTRResource{PTR: serviceName},
+			})
+		case sameName(q.Name, serviceName) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+			add(&response.Answers, ptr)
+			for _, r := range others {
+				add(&response.Additionals, r)
+			}
+		case sameName(q.Name, instance) || sameName(q.Name, host):
+			for _, r := range others {
+				if sameName(r.Header.Name, q.Name) && (q.Type == r.Header.Type || q.Type == dnsmessage.TypeALL) {
+					add(&response.Answers, r)
+				}
+			}
+		}
+	}
+
+	if len(response.Answers) == 0 {
+		return nil, nil
+	}
+
+	return response, nil
+}
+
+func sameName(a dnsmessage.Name, b dnsmessage.Name) bool {
+	return strings.EqualFold(a.String(), b.String())
+}
+
+// Responder answers the queries for a service
+type Responder struct {
+	service Service
+	conn    *net.UDPConn
+}
+
+// NewResponder joins the mDNS group on iface, or on the
+// default interface when iface is nil
+func NewResponder(iface *net.Interface, service Service) (*Responder, error) {
+	if _, err := service.instanceName(); err != nil {
+		return nil, err
+	}
+
+	if _, err := service.hostName(); err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", iface, mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Responder{service: service, conn: conn}, nil
+}
+
+// announce sends the records of the service, with a ttl
+// of 0 to have them removed from caches
+func (r *Responder) announce(ttl uint32) error {
+	ptr, others, err := r.service.records(ttl)
+	if err != nil {
+		return err
+	}
+
+	message := dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: append([]dnsmessage.Resource{ptr}, others...),
+	}
+
+	packet, err := message.Pack()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn.WriteToUDP(packet, mdnsAddr)
+	return err
+}
+
+// Serve announces the service and answers queries until ctx
+// is done, when it tells the network the service is gone
+func (r *Responder) Serve(ctx context.Context) error {
+	defer r.conn.Close()
+
+	if err := r.announce(TTL); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.announce(0)
+			r.conn.Close()
+		case <-stop:
+		}
+	}()
+
+	buf := make([]byte, 9000)
+
+	for {
+		n, src, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || query.Header.Response {
+			continue
+		}
+
+		response, err := r.service.answer(&query)
+		if err != nil || response == nil {
+			continue
+		}
+
+		dst := mdnsAddr
+
+		// Queries from other ports are one-shot queries
+		// expecting a unicast DNS response
+		if src.Port != mdnsAddr.Port {
+			dst = src
+			response.Header.ID = query.Header.ID
+			response.Questions = query.Questions
+		}
+
+		packet, err := response.Pack()
+		if err != nil {
+			continue
+		}
+
+		r.conn.WriteToUDP(packet, dst)
+	}
+}
+
+// Browse queries the network on iface, or on the default interface
+// when iface is nil, and returns the services that answered before
+// ctx is done
+func Browse(ctx context.Context, iface *net.Interface) ([]Service, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if iface != nil {
+		if err := ipv4.NewPacketConn(conn).SetMulticastInterface(iface); err != nil {
+			return nil, err
+		}
+	}
+
+	query := dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{Name: serviceName, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+		},
+	}
+
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.WriteToUDP(packet, mdnsAddr); err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(3 * time.Second)
+	}
+	conn.SetReadDeadline(deadline)
+
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	browser := newBrowser()
+	buf := make([]byte, 9000)
+
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+
+		var response dnsmessage.Message
+		if err := response.Unpack(buf[:n]); err != nil || !response.Header.Response {
+			continue
+		}
+
+		browser.add(&response)
+	}
+
+	return browser.services(), nil
+}
+
+// browser puts services together from the records of responses
+type browser struct {
+	instances []string
+	srv       map[string]dnsmessage.SRVResource
+	txt       map[string][]string
+	a         map[string][]net.IP
+}
+
+func newBrowser() *browser {
+	return &browser{
+		srv: map[string]dnsmessage.SRVResource{},
+		txt: map[string][]string{},
+		a:   map[string][]net.IP{},
+	}
+}
+
+func (b *browser) add(response *dnsmessage.Message) {
+	resources := append(slices.Clone(response.Answers), response.Additionals...)
+
+	for _, r := range resources {
+		name := strings.ToLower(r.Header.Name.String())
+
+		switch body := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if sameName(r.Header.Name, serviceName) {
+				instance := body.PTR.String()
+				if !slices.ContainsFunc(b.instances, func(i string) bool { return strings.EqualFold(i, instance) }) {
+					b.instances = append(b.instances, instance)
+				}
+			}
+		case *dnsmessage.SRVResource:
+			b.srv[name] = *body
+		case *dnsmessage.TXTResource:
+			b.txt[name] = body.TXT
+		case *dnsmessage.AResource:
+			ip := net.IP(body.A[:])
+			if !slices.ContainsFunc(b.a[name], ip.Equal) {
+				b.a[name] = append(b.a[name], ip)
+			}
+		}
+	}
+}
+
+// services returns the services with an SRV record, by instance
+func (b *browser) services() []Service {
+	services := []Service{}
+
+	for _, instance := range b.instances {
+		srv, ok := b.srv[strings.ToLower(instance)]
+		if !ok {
+			continue
+		}
+
+		service := Service{
+			Instance: strings.TrimSuffix(instance, "."+SERVICE+"."+DOMAIN),
+			Host:     strings.TrimSuffix(srv.Target.String(), "."+DOMAIN),
+			Port:     int(srv.Port),
+			IPs:      b.a[strings.ToLower(srv.Target.String())],
+			Text:     map[string]string{},
+		}
+
+		for _, entry := range b.txt[strings.ToLower(instance)] {
+			if key, value, ok := strings.Cut(entry, "="); ok {
+				service.Text[key] = value
+			}
+		}
+
+		services = append(services, service)
+	}
+
+	slices.SortFunc(services, func(a, b Service) int {
+		return strings.Compare(a.Instance, b.Instance)
+	})
+
+	return services
+}
@@ -0,0 +1,148 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var testService = Service{
+	Instance: "Ann's Server",
+	Host:     "ann-laptop",
+	Port:     8080,
+	IPs:      []net.IP{net.IPv4(192, 168, 1, 20)},
+	Text:     map[string]string{"name": "Ann's Server"},
+}
+
+// roundTrip packs and unpacks m as it is sent on the network
+func roundTrip(t *testing.T, m *dnsmessage.Message) *dnsmessage.Message {
+	t.Helper()
+
+	packet, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var unpacked dnsmessage.Message
+	if err := unpacked.Unpack(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	return &unpacked
+}
+
+func TestBrowserFindsAnsweredService(t *testing.T) {
+	query := &dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{Name: serviceName, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+		},
+	}
+
+	response, err := testService.answer(roundTrip(t, query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response == nil {
+		t.Fatal("no answer to a query for the service")
+	}
+
+	b := newBrowser()
+	b.add(roundTrip(t, response))
+
+	services := b.services()
+	if len(services) != 1 {
+		t.Fatalf("found %v services, want 1", len(services))
+	}
+
+	got := services[0]
+	if got.Instance != testService.Instance || got.Host != testService.Host || got.Port != testService.Port {
+		t.Errorf("found %+v, want %+v", got, testService)
+	}
+
+	if got.Text["name"] != "Ann's Server" {
+		t.Errorf("TXT name = %q", got.Text["name"])
+	}
+
+	if got.URL() != "http://192.168.1.20:8080" {
+		t.Errorf("URL = %q", got.URL())
+	}
+}
+
+func TestAnswerIgnoresOtherNames(t *testing.T) {
+	query := &dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{Name: dnsmessage.MustNewName("_http._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+		},
+	}
+
+	response, err := testService.answer(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response != nil {
+		t.Errorf("answered a query for another service: %v", response.GoString())
+	}
+}
+
+func TestAnswerHostAddress(t *testing.T) {
+	service := testService
+	service.IPs = []net.IP{net.IPv4(192, 168, 1, 20), net.IPv4(10, 0, 0, 5)}
+
+	query := &dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{Name: dnsmessage.MustNewName("ANN-LAPTOP.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		},
+	}
+
+	response, err := service.answer(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response == nil || len(response.Answers) != 2 {
+		t.Fatalf("answers = %v, want both addresses", response)
+	}
+}
+
+func TestLabelFitsDNS(t *testing.T) {
+	got := label("my.server " + strings.Repeat("é", 40))
+
+	if len(got) > 63 || strings.Contains(got, ".") {
+		t.Errorf("label = %q, want at most 63 bytes without dots", got)
+	}
+}
+
+// Multicast is often unavailable in sandboxes, so the responder
+// is only checked when it can join the group
+func TestResponderAndBrowse(t *testing.T) {
+	responder, err := NewResponder(nil, testService)
+	if err != nil {
+		t.Skipf("cannot join the mDNS group: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go responder.Serve(ctx)
+
+	browseCtx, browseCancel := context.WithTimeout(ctx, time.Second)
+	defer browseCancel()
+
+	services, err := Browse(browseCtx, nil)
+	if err != nil {
+		t.Skipf("cannot query the mDNS group: %v", err)
+	}
+
+	for _, service := range services {
+		if service.Instance == testService.Instance {
+			return
+		}
+	}
+
+	t.Skipf("multicast is not looped back, found %v", services)
+}
@@ -0,0 +1,222 @@
+// Package metrics keeps counters and gauges and writes them
+// in the Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Metric types
+	COUNTER = "counter"
+	GAUGE   = "gauge"
+)
+
+// Content type of the text exposition format
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds the metrics written by its handler
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*Vec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// Vec is a metric with a series for each combination of
+// values of its labels. A metric without labels has one series
+type Vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (r *Registry) register(name string, help string, kind string, labels []string) *Vec {
+	v := &Vec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: map[string]*series{},
+	}
+
+	r.mu.Lock()
+	r.metrics = append(r.metrics, v)
+	r.mu.Unlock()
+
+	return v
+}
+
+// Counter adds a metric that only goes up
+func (r *Registry) Counter(name string, help string, labels ...string) *Vec {
+	return r.register(name, help, COUNTER, labels)
+}
+
+// Gauge adds a metric that goes up and down
+func (r *Registry) Gauge(name string, help string, labels ...string) *Vec {
+	return r.register(name, help, GAUGE, labels)
+}
+
+// get returns the series of labelValues, creating it
+func (v *Vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %v takes %v label values, got %v", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		v.series[key] = s
+	}
+
+	return s
+}
+
+// Add adds delta to the series of labelValues. Counters
+// ignore negative deltas
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	if v.kind == COUNTER && delta < 0 {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.get(labelValues).value += delta
+}
+
+// Inc adds 1 to the series of labelValues
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Dec subtracts 1 from the series of labelValues of a gauge
+func (v *Vec) Dec(labelValues ...string) {
+	v.Add(-1, labelValues...)
+}
+
+// Set sets the series of labelValues of a gauge
+func (v *Vec) Set(value float64, labelValues ...string) {
+	if v.kind != GAUGE {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.get(labelValues).value = value
+}
+
+// Value returns the series of labelValues
+func (v *Vec) Value(labelValues ...string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if s, ok := v.series[strings.Join(labelValues, "\xff")]; ok {
+		return s.value
+	}
+
+	return 0
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// write writes the metric with its series sorted by label values
+func (v *Vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %v %v\n", v.name, helpEscaper.Replace(v.help))
+	fmt.Fprintf(w, "# TYPE %v %v\n", v.name, v.kind)
+
+	// A metric without labels is always reported
+	if len(v.labels) == 0 {
+		v.get(nil)
+	}
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s := v.series[key]
+
+		w.WriteString(v.name)
+
+		if len(v.labels) > 0 {
+			w.WriteByte('{')
+			for i, label := range v.labels {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				fmt.Fprintf(w, `%v="%v"`, label, labelEscaper.Replace(s.labelValues[i]))
+			}
+			w.WriteByte('}')
+		}
+
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		w.WriteByte('\n')
+	}
+}
+
+// WriteTo writes every metric in the text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	for _, v := range metrics {
+		v.write(bw)
+	}
+
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+// Handler serves the metrics for scraping
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", CONTENT_TYPE)
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
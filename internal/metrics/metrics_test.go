@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesExpositionFormat(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := registry.Counter("requests_total", "Requests\nhandled.", "route", "code")
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "404")
+	requests.Add(-5, "/a", "404")
+
+	active := registry.Gauge("active", "In progress.")
+	active.Inc()
+	active.Inc()
+	active.Dec()
+
+	label := registry.Gauge("label", "Escaped labels.", "value")
+	label.Set(1.5, "a\"b\\c\nd")
+
+	var b strings.Builder
+	if _, err := registry.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP requests_total Requests\nhandled.
+# TYPE requests_total counter
+requests_total{route="/a",code="404"} 2
+requests_total{route="/b",code="200"} 1
+# HELP active In progress.
+# TYPE active gauge
+active 1
+# HELP label Escaped labels.
+# TYPE label gauge
+label{value="a\"b\\c\nd"} 1.5
+`
+
+	if b.String() != want {
+		t.Errorf("got\n%v\nwant\n%v", b.String(), want)
+	}
+}
+
+func TestMetricsWithoutLabelsAreReported(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("total", "Nothing yet.")
+
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != CONTENT_TYPE {
+		t.Errorf("content type = %q, want %q", got, CONTENT_TYPE)
+	}
+
+	if !strings.Contains(rec.Body.String(), "\ntotal 0\n") {
+		t.Errorf("body %q does not report total", rec.Body.String())
+	}
+}
+
+func TestSetOnlyChangesGauges(t *testing.T) {
+	registry := NewRegistry()
+
+	counter := registry.Counter("total", "Counter.")
+	counter.Inc()
+	counter.Set(0)
+
+	if got := counter.Value(); got != 1 {
+		t.Errorf("counter = %v, want 1", got)
+	}
+}
@@ -0,0 +1,355 @@
+// Package ratelimit limits request rates and bandwidth
+// with token buckets
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Clients not seen for this long are forgotten
+const clientIdleTTL = 10 * time.Minute
+
+// Most clients kept at once, the longest idle is forgotten
+// for a new one so spoofed addresses cannot exhaust memory
+const maxClients = 10000
+
+// Bucket is a token bucket refilled at rate tokens per second
+// up to burst tokens. Reservations may take more tokens than
+// are left, later callers then wait for the debt to be paid
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewBucket returns a full bucket. A nil bucket never limits,
+// which is what a rate of 0 or less returns
+func NewBucket(rate float64, burst float64) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Bucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// refill adds the tokens earned since the last call
+func (b *Bucket) refill() {
+	now := b.now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Allow takes a token if one is left
+func (b *Bucket) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// Reserve takes n tokens and returns how long to wait
+// before acting on them
+func (b *Bucket) Reserve(n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens -= float64(n)
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// RetryAfter returns how long until a token is available
+func (b *Bucket) RetryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Chunk returns the most bytes a single reservation
+// should take so transfers stay smooth
+func (b *Bucket) Chunk() int {
+	if b == nil {
+		return 0
+	}
+
+	return int(b.burst)
+}
+
+// Wait reserves n tokens from every bucket and sleeps until all
+// allow them. It returns the time waited, or the context error
+func Wait(ctx context.Context, n int, buckets ...*Bucket) (time.Duration, error) {
+	var delay time.Duration
+
+	for _, b := range buckets {
+		delay = max(delay, b.Reserve(n))
+	}
+
+	if delay == 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// chunkSize returns the size transfers through buckets are split into
+func chunkSize(buckets []*Bucket, size int) int {
+	for _, b := range buckets {
+		if chunk := b.Chunk(); chunk > 0 {
+			size = min(size, chunk)
+		}
+	}
+
+	return size
+}
+
+// Reader limits the bytes read from an io.Reader to the rates
+// of its buckets
+type Reader struct {
+	ctx     context.Context
+	r       io.Reader
+	buckets []*Bucket
+
+	// Called when a read had to wait
+	OnWait func(time.Duration)
+}
+
+func NewReader(ctx context.Context, r io.Reader, buckets ...*Bucket) *Reader {
+	return &Reader{ctx: ctx, r: r, buckets: buckets}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return r.r.Read(p)
+	}
+
+	n, err := r.r.Read(p[:chunkSize(r.buckets, len(p))])
+	if n > 0 {
+		delay, waitErr := Wait(r.ctx, n, r.buckets...)
+		if waitErr != nil {
+			return n, waitErr
+		}
+
+		if delay > 0 && r.OnWait != nil {
+			r.OnWait(delay)
+		}
+	}
+
+	return n, err
+}
+
+// Writer limits the bytes written to an io.Writer to the rates
+// of its buckets
+type Writer struct {
+	ctx     context.Context
+	w       io.Writer
+	buckets []*Bucket
+
+	// Called when a write had to wait
+	OnWait func(time.Duration)
+}
+
+func NewWriter(ctx context.Context, w io.Writer, buckets ...*Bucket) *Writer {
+	return &Writer{ctx: ctx, w: w, buckets: buckets}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		chunk := chunkSize(w.buckets, len(p))
+
+		delay, err := Wait(w.ctx, chunk, w.buckets...)
+		if err != nil {
+			return written, err
+		}
+
+		if delay > 0 && w.OnWait != nil {
+			w.OnWait(delay)
+		}
+
+		n, err := w.w.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[chunk:]
+	}
+
+	return written, nil
+}
+
+type client struct {
+	bucket  *Bucket
+	seen    time.Time
+	limited bool
+}
+
+// Limiter keeps a bucket for each client
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	clients map[string]*client
+	max     int
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewLimiter allows each client rate requests per second with
+// bursts of up to burst requests. A nil limiter never limits,
+// which is what a rate of 0 or less returns
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		clients: map[string]*client{},
+		max:     maxClients,
+		swept:   time.Now(),
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether the client identified by key may make
+// a request. started is true for the first request refused
+// after the client was last allowed one
+func (l *Limiter) Allow(key string) (allowed bool, started bool) {
+	if l == nil {
+		return true, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	c, ok := l.clients[key]
+	if !ok {
+		if len(l.clients) >= l.max {
+			l.evict()
+		}
+
+		c = &client{bucket: NewBucket(l.rate, l.burst)}
+		c.bucket.now = l.now
+		c.bucket.last = now
+		l.clients[key] = c
+	}
+	c.seen = now
+
+	if c.bucket.Allow() {
+		c.limited = false
+		return true, false
+	}
+
+	started = !c.limited
+	c.limited = true
+
+	return false, started
+}
+
+// RetryAfter returns how long until the client identified
+// by key may make a request
+func (l *Limiter) RetryAfter(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	c, ok := l.clients[key]
+	l.mu.Unlock()
+
+	if !ok {
+		return 0
+	}
+
+	return c.bucket.RetryAfter()
+}
+
+// sweep forgets idle clients, at most once per idle period
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < clientIdleTTL {
+		return
+	}
+
+	for key, c := range l.clients {
+		if now.Sub(c.seen) > clientIdleTTL {
+			delete(l.clients, key)
+		}
+	}
+
+	l.swept = now
+}
+
+// evict forgets the client seen longest ago
+func (l *Limiter) evict() {
+	var oldest string
+	var seen time.Time
+
+	for key, c := range l.clients {
+		if seen.IsZero() || c.seen.Before(seen) {
+			oldest, seen = key, c.seen
+		}
+	}
+
+	delete(l.clients, oldest)
+}
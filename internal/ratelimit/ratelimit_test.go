@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is advanced by hand
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func TestBucketAllow(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+
+	b := NewBucket(2, 3)
+	b.now, b.last = clock.now, clock.t
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("request %v refused within the burst", i)
+		}
+	}
+
+	if b.Allow() {
+		t.Fatal("request allowed past the burst")
+	}
+
+	if got := b.RetryAfter(); got != 500*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want 500ms", got)
+	}
+
+	clock.t = clock.t.Add(500 * time.Millisecond)
+
+	if !b.Allow() {
+		t.Error("request refused after refill")
+	}
+}
+
+func TestBucketReserve(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+
+	b := NewBucket(100, 100)
+	b.now, b.last = clock.now, clock.t
+
+	if got := b.Reserve(100); got != 0 {
+		t.Errorf("first Reserve = %v, want 0", got)
+	}
+
+	if got := b.Reserve(50); got != 500*time.Millisecond {
+		t.Errorf("second Reserve = %v, want 500ms", got)
+	}
+}
+
+func TestNilLimitsNothing(t *testing.T) {
+	if NewBucket(0, 10) != nil || NewLimiter(0, 10) != nil {
+		t.Fatal("a rate of 0 returned a limit")
+	}
+
+	var b *Bucket
+	if !b.Allow() || b.Reserve(1<<20) != 0 {
+		t.Error("nil bucket limited")
+	}
+
+	var l *Limiter
+	if allowed, _ := l.Allow("client"); !allowed {
+		t.Error("nil limiter limited")
+	}
+}
+
+func TestLimiterIsPerClient(t *testing.T) {
+	l := NewLimiter(1, 1)
+
+	if allowed, _ := l.Allow("a"); !allowed {
+		t.Fatal("first request of a refused")
+	}
+
+	allowed, started := l.Allow("a")
+	if allowed || !started {
+		t.Errorf("second request of a = %v %v, want refused and started", allowed, started)
+	}
+
+	if _, started := l.Allow("a"); started {
+		t.Error("limiting reported as started twice")
+	}
+
+	if allowed, _ := l.Allow("b"); !allowed {
+		t.Error("b limited by the requests of a")
+	}
+}
+
+func TestLimiterCapsClients(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+
+	l := NewLimiter(1, 1)
+	l.now = clock.now
+	l.max = 2
+
+	for _, key := range []string{"a", "b", "c"} {
+		l.Allow(key)
+		clock.t = clock.t.Add(time.Second)
+	}
+
+	if len(l.clients) != 2 {
+		t.Errorf("clients = %v, want 2", len(l.clients))
+	}
+
+	if _, ok := l.clients["a"]; ok {
+		t.Error("longest idle client was kept")
+	}
+}
+
+func TestWriterAndReader(t *testing.T) {
+	data := strings.Repeat("x", 300)
+
+	waited := time.Duration(0)
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(context.Background(), buf, NewBucket(1000, 100))
+	w.OnWait = func(d time.Duration) { waited += d }
+
+	start := time.Now()
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != data {
+		t.Error("writer changed the data")
+	}
+
+	// 100 bytes are free, 200 more take 200ms at 1000 bytes per second
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || waited == 0 {
+		t.Errorf("writer took %v, waited %v, want about 200ms", elapsed, waited)
+	}
+
+	r := NewReader(context.Background(), strings.NewReader(data), NewBucket(1000, 100))
+
+	start = time.Now()
+	read, err := io.ReadAll(r)
+	if err != nil || string(read) != data {
+		t.Fatalf("reader read %q, %v", read, err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("reader took %v, want about 200ms", elapsed)
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	b := NewBucket(1, 1)
+	b.Reserve(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Wait(ctx, 10, b); err == nil {
+		t.Error("Wait ignored the canceled context")
+	}
+}
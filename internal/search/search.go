@@ -0,0 +1,248 @@
+// Package search finds files by name under a directory tree,
+// either by walking it or from an index kept up to date by a watcher
+package search
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Owbird/SVault-Engine/internal/watcher"
+)
+
+// ErrBadQuery is returned for empty queries and malformed globs
+var ErrBadQuery = errors.New("invalid search query")
+
+// Query matches file names against a glob when it contains
+// any of *?[ and as a substring otherwise. Matching ignores case.
+// Globs containing a slash match the whole path instead of the name
+type Query struct {
+	pattern  string
+	glob     bool
+	fullPath bool
+}
+
+// ParseQuery validates q and prepares it for matching
+func ParseQuery(q string) (Query, error) {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" {
+		return Query{}, ErrBadQuery
+	}
+
+	query := Query{
+		pattern: q,
+		glob:    strings.ContainsAny(q, "*?["),
+	}
+
+	if query.glob {
+		query.fullPath = strings.Contains(q, "/")
+		query.pattern = strings.TrimPrefix(q, "/")
+
+		if _, err := path.Match(query.pattern, ""); err != nil {
+			return Query{}, ErrBadQuery
+		}
+	}
+
+	return query, nil
+}
+
+// Match reports whether the slash rooted path p matches
+func (q Query) Match(p string) bool {
+	target := strings.ToLower(path.Base(p))
+	if q.fullPath {
+		target = strings.ToLower(strings.TrimPrefix(p, "/"))
+	}
+
+	if q.glob {
+		ok, _ := path.Match(q.pattern, target)
+		return ok
+	}
+
+	return strings.Contains(target, q.pattern)
+}
+
+// inScope reports whether p is below the slash rooted dir
+func inScope(p string, dir string) bool {
+	return dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// Keep reports whether the slash rooted p may be returned.
+// Walk does not enter the directories it rejects, so it
+// should reject the paths below them as well
+type Keep func(p string) bool
+
+// Walk searches the tree at root below the slash rooted dir,
+// returning at most limit matching paths passing keep.
+// Symlinks are not followed
+func Walk(root string, dir string, q Query, limit int, keep Keep) ([]string, error) {
+	matches := []string{}
+
+	start := filepath.Join(root, filepath.FromSlash(dir))
+
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == start {
+				return err
+			}
+			return nil
+		}
+
+		if p == start {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+
+		name := "/" + filepath.ToSlash(rel)
+
+		if d.IsDir() && !keep(name) {
+			return fs.SkipDir
+		}
+
+		if q.Match(name) && (d.IsDir() || keep(name)) {
+			matches = append(matches, name)
+			if len(matches) >= limit {
+				return fs.SkipAll
+			}
+		}
+
+		return nil
+	})
+
+	sort.Strings(matches)
+
+	return matches, err
+}
+
+// Index keeps the paths under a directory in memory
+type Index struct {
+	root string
+
+	mu    sync.RWMutex
+	paths map[string]bool
+	ready bool
+}
+
+// NewIndex creates an empty index of the tree at root.
+// It is filled and kept current by Run
+func NewIndex(root string) *Index {
+	return &Index{
+		root:  root,
+		paths: map[string]bool{},
+	}
+}
+
+// Ready reports whether the index has been built
+func (i *Index) Ready() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.ready
+}
+
+// Build walks the whole tree and replaces the indexed paths
+func (i *Index) Build() error {
+	paths := map[string]bool{}
+
+	err := filepath.WalkDir(i.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == i.root {
+				return err
+			}
+			return nil
+		}
+
+		if rel, err := filepath.Rel(i.root, p); err == nil && rel != "." {
+			paths["/"+filepath.ToSlash(rel)] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.paths = paths
+	i.ready = true
+	i.mu.Unlock()
+
+	return nil
+}
+
+// Run builds the index and then applies the events of w to it
+// until w is closed. Changes made while building are queued
+// by the subscription and applied afterwards
+func (i *Index) Run(w *watcher.Watcher) error {
+	events := w.Subscribe()
+
+	if err := i.Build(); err != nil {
+		w.Unsubscribe(events)
+		return err
+	}
+
+	for event := range events {
+		switch event.Op {
+		case watcher.CREATE:
+			i.mu.Lock()
+			i.paths[event.Path] = true
+			i.mu.Unlock()
+		case watcher.REMOVE, watcher.RENAME:
+			i.remove(event.Path)
+		case watcher.RESYNC:
+			i.Build()
+		}
+	}
+
+	return nil
+}
+
+// remove drops p and everything below it
+func (i *Index) remove(p string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.paths, p)
+
+	prefix := p + "/"
+	for indexed := range i.paths {
+		if strings.HasPrefix(indexed, prefix) {
+			delete(i.paths, indexed)
+		}
+	}
+}
+
+// Search returns at most limit indexed paths below the
+// slash rooted dir matching q and passing keep, in sorted order
+func (i *Index) Search(dir string, q Query, limit int, keep Keep) []string {
+	i.mu.RLock()
+	matches := []string{}
+	for p := range i.paths {
+		if inScope(p, dir) && q.Match(p) {
+			matches = append(matches, p)
+		}
+	}
+	i.mu.RUnlock()
+
+	sort.Strings(matches)
+
+	kept := []string{}
+	for _, p := range matches {
+		if len(kept) >= limit {
+			break
+		}
+
+		if keep(p) {
+			kept = append(kept, p)
+		}
+	}
+
+	return kept
+}
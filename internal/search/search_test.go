@@ -0,0 +1,183 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/watcher"
+)
+
+// setupTree creates the files in paths under a temp dir
+func setupTree(t *testing.T, paths ...string) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for _, p := range paths {
+		full := filepath.Join(root, filepath.FromSlash(p))
+
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(full, []byte(p), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestQueryMatch(t *testing.T) {
+	tests := []struct {
+		query string
+		path  string
+		want  bool
+	}{
+		{"cat", "/photos/Cat.JPG", true},
+		{"photos", "/photos/cat.jpg", false},
+		{"*.jpg", "/photos/cat.JPG", true},
+		{"*.jpg", "/photos/cat.png", false},
+		{"c?t.*", "/photos/cat.jpg", true},
+		{"photos/*.jpg", "/photos/cat.jpg", true},
+		{"/photos/*.jpg", "/photos/cat.jpg", true},
+		{"photos/*.jpg", "/other/photos/cat.jpg", false},
+		{"[ab]*", "/bat", true},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := q.Match(tt.path); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.query, tt.path, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "   ", "[a"} {
+		if _, err := ParseQuery(bad); err != ErrBadQuery {
+			t.Errorf("ParseQuery(%q) err = %v, want %v", bad, err, ErrBadQuery)
+		}
+	}
+}
+
+// keepAll keeps every path
+func keepAll(string) bool {
+	return true
+}
+
+// skipDotDirs rejects dot files and the paths below dot directories
+func skipDotDirs(p string) bool {
+	return !strings.Contains(p, "/.")
+}
+
+func TestSearchKeep(t *testing.T) {
+	root := setupTree(t, ".git/cat.jpg", ".cat.jpg", "a/cat.jpg")
+
+	q, _ := ParseQuery("cat")
+
+	entered := []string{}
+	got, err := Walk(root, "/", q, 1, func(p string) bool {
+		entered = append(entered, p)
+		return skipDotDirs(p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, []string{"/a/cat.jpg"}) {
+		t.Errorf("Walk = %v, want the kept path within the limit", got)
+	}
+
+	for _, p := range entered {
+		if strings.HasPrefix(p, "/.git/") {
+			t.Errorf("Walk entered rejected dir: %v", p)
+		}
+	}
+
+	index := NewIndex(root)
+	if err := index.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := index.Search("/", q, 1, skipDotDirs); !reflect.DeepEqual(got, []string{"/a/cat.jpg"}) {
+		t.Errorf("Search = %v, want the kept path within the limit", got)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root := setupTree(t, "a/cat.jpg", "a/b/cat.png", "dog.jpg", "cats/notes.txt")
+
+	q, _ := ParseQuery("cat")
+
+	got, err := Walk(root, "/", q, 10, keepAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/a/b/cat.png", "/a/cat.jpg", "/cats"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Walk = %v, want %v", got, want)
+	}
+
+	got, _ = Walk(root, "/a/b", q, 10, keepAll)
+	if !reflect.DeepEqual(got, []string{"/a/b/cat.png"}) {
+		t.Fatalf("scoped Walk = %v", got)
+	}
+
+	got, _ = Walk(root, "/", q, 1, keepAll)
+	if len(got) != 1 {
+		t.Fatalf("limited Walk = %v", got)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	root := setupTree(t, "a/cat.jpg", "dog.jpg")
+
+	w, err := watcher.New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	index := NewIndex(root)
+	go index.Run(w)
+
+	q, _ := ParseQuery("*.jpg")
+
+	waitForResults := func(want []string) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got := index.Search("/", q, 10, keepAll)
+			if index.Ready() && reflect.DeepEqual(got, want) {
+				return
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("Search = %v, want %v", got, want)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitForResults([]string{"/a/cat.jpg", "/dog.jpg"})
+
+	os.WriteFile(filepath.Join(root, "new.jpg"), nil, 0o644)
+	waitForResults([]string{"/a/cat.jpg", "/dog.jpg", "/new.jpg"})
+
+	os.RemoveAll(filepath.Join(root, "a"))
+	waitForResults([]string{"/dog.jpg", "/new.jpg"})
+
+	if got := index.Search("/a", q, 10, keepAll); len(got) != 0 {
+		t.Fatalf("removed dir still indexed: %v", got)
+	}
+}
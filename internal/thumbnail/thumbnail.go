@@ -0,0 +1,193 @@
+// Package thumbnail generates small JPEG previews of images
+// and caches them on disk
+package thumbnail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Images with more pixels than this are not decoded,
+// which keeps crafted files from exhausting memory
+const maxPixels = 64 * 1024 * 1024
+
+const jpegQuality = 80
+
+var (
+	// ErrUnsupported is returned for files that are not
+	// images in one of the supported formats
+	ErrUnsupported = errors.New("unsupported image format")
+
+	// ErrTooLarge is returned for images above maxPixels
+	ErrTooLarge = errors.New("image is too large")
+)
+
+var extensions = map[string]bool{
+	".bmp":  true,
+	".gif":  true,
+	".jpeg": true,
+	".jpg":  true,
+	".png":  true,
+	".tif":  true,
+	".tiff": true,
+	".webp": true,
+}
+
+// Supported reports whether a thumbnail can be made
+// for the file name from its extension
+func Supported(name string) bool {
+	return extensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// Cache stores thumbnails in a directory, keyed by the path,
+// modification time and size of the image they were made from
+type Cache struct {
+	dir  string
+	size int
+
+	// Limits how many images are decoded at once
+	sem chan struct{}
+}
+
+// NewCache creates a cache in dir for thumbnails
+// fitting in a size by size square
+func NewCache(dir string, size int) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Cache{
+		dir:  dir,
+		size: size,
+		sem:  make(chan struct{}, runtime.NumCPU()),
+	}, nil
+}
+
+// Get returns the path to the thumbnail of the image at name,
+// generating it from src when it is not cached yet. name is the
+// absolute path of the image, keeping apart the dirs sharing a cache
+func (c *Cache) Get(name string, info fs.FileInfo, src io.ReadSeeker) (string, error) {
+	if !Supported(name) {
+		return "", ErrUnsupported
+	}
+
+	nameKey := hashKey(name)
+	cached := filepath.Join(c.dir, fmt.Sprintf("%v-%x-%x.jpg", nameKey, info.ModTime().UnixNano(), info.Size()))
+
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+
+	c.sem <- struct{}{}
+	defer func() { <-c.sem }()
+
+	thumb, err := c.generate(src)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.store(cached, thumb); err != nil {
+		return "", err
+	}
+
+	// Thumbnails of earlier versions of the file are no longer reachable
+	stale, _ := filepath.Glob(filepath.Join(c.dir, nameKey+"-*.jpg"))
+	for _, old := range stale {
+		if old != cached {
+			os.Remove(old)
+		}
+	}
+
+	return cached, nil
+}
+
+// generate decodes src and scales it down to fit the cache size
+func (c *Cache) generate(src io.ReadSeeker) (image.Image, error) {
+	config, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	bounds := img.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), c.size)
+
+	// JPEG has no alpha so transparent areas are drawn on white
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(thumb, thumb.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(thumb, thumb.Bounds(), img, bounds, draw.Over, nil)
+
+	return thumb, nil
+}
+
+// store writes thumb to path through a temp file so
+// readers never see a partial thumbnail
+func (c *Cache) store(path string, thumb image.Image) error {
+	tmp, err := os.CreateTemp(c.dir, ".thumb-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := jpeg.Encode(tmp, thumb, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// fit scales width and height down to fit in a size by size
+// square, keeping the aspect ratio. Smaller images are kept as is
+func fit(width int, height int, size int) (int, int) {
+	if width <= size && height <= size {
+		return max(width, 1), max(height, 1)
+	}
+
+	if width >= height {
+		return size, max(height*size/width, 1)
+	}
+
+	return max(width*size/height, 1), size
+}
+
+func hashKey(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,165 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePNG writes a width by height PNG to dir and returns its path
+func writePNG(t *testing.T, dir string, name string, width int, height int) string {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func getThumbnail(t *testing.T, c *Cache, name string, p string) (string, error) {
+	t.Helper()
+
+	src, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.Get(name, info, src)
+}
+
+func TestGet(t *testing.T) {
+	base := t.TempDir()
+
+	c, err := NewCache(filepath.Join(base, "cache"), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := writePNG(t, base, "wide.png", 400, 100)
+
+	thumb, err := getThumbnail(t, c, "/wide.png", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(thumb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := img.Bounds().Size(); got != image.Pt(64, 16) {
+		t.Fatalf("thumbnail size = %v, want 64x16", got)
+	}
+
+	cached, err := getThumbnail(t, c, "/wide.png", src)
+	if err != nil || cached != thumb {
+		t.Fatalf("cached thumbnail = %v, %v, want %v", cached, err, thumb)
+	}
+
+	// A changed file gets a new thumbnail and the old one is dropped
+	writePNG(t, base, "wide.png", 100, 400)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(src, later, later)
+
+	updated, err := getThumbnail(t, c, "/wide.png", src)
+	if err != nil || updated == thumb {
+		t.Fatalf("updated thumbnail = %v, %v", updated, err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(base, "cache"))
+	if len(entries) != 1 {
+		t.Fatalf("cache entries = %v, want only the latest thumbnail", entries)
+	}
+}
+
+func TestGetKeepsSmallImages(t *testing.T) {
+	base := t.TempDir()
+
+	c, err := NewCache(filepath.Join(base, "cache"), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumb, err := getThumbnail(t, c, "/small.png", writePNG(t, base, "small.png", 10, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(thumb)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width != 10 || config.Height != 20 {
+		t.Fatalf("thumbnail = %+v, %v, want 10x20", config, err)
+	}
+}
+
+func TestGetRejectsUnsupported(t *testing.T) {
+	base := t.TempDir()
+
+	c, err := NewCache(filepath.Join(base, "cache"), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := filepath.Join(base, "notes.txt")
+	os.WriteFile(text, []byte("not an image"), 0o644)
+
+	if _, err := getThumbnail(t, c, "/notes.txt", text); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("text file err = %v, want %v", err, ErrUnsupported)
+	}
+
+	fake := filepath.Join(base, "fake.png")
+	os.WriteFile(fake, []byte(strings.Repeat("x", 100)), 0o644)
+
+	if _, err := getThumbnail(t, c, "/fake.png", fake); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("corrupt image err = %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		width, height, size int
+		wantW, wantH        int
+	}{
+		{400, 100, 64, 64, 16},
+		{100, 400, 64, 16, 64},
+		{10, 10, 64, 10, 10},
+		{1000, 1, 64, 64, 1},
+	}
+
+	for _, tt := range tests {
+		if w, h := fit(tt.width, tt.height, tt.size); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fit(%v, %v, %v) = %v, %v, want %v, %v", tt.width, tt.height, tt.size, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/localtunnel/go-localtunnel"
+)
+
+// Localtunnel opens tunnels on a localtunnel server, such
+// as loca.lt or a self hosted one
+type Localtunnel struct {
+	// The server handing out tunnels, e.g. https://loca.lt
+	BaseURL string
+}
+
+// Open registers a tunnel with the server. The registration
+// cannot be cancelled, so ctx is only checked before it
+func (l *Localtunnel) Open(ctx context.Context, port int) (Tunnel, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	listener, err := localtunnel.Listen(localtunnel.Options{BaseURL: l.BaseURL})
+	if err != nil {
+		return nil, err
+	}
+
+	return serve(listener, listener.URL(), fmt.Sprintf("localhost:%v", port), nil), nil
+}
+
+// Origins returns the subdomains of the server the tunnels get
+func (l *Localtunnel) Origins() []string {
+	u, err := url.Parse(l.BaseURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%v://*.%v", u.Scheme, u.Host)}
+}
+
+// ForwardsClients is true, the server proxies the requests
+// and appends the address of each client
+func (l *Localtunnel) ForwardsClients() bool {
+	return true
+}
@@ -0,0 +1,105 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// Wait before the first attempt to reopen a tunnel, doubled
+	// after each failed attempt up to MAX_BACKOFF
+	MIN_BACKOFF = time.Second
+	MAX_BACKOFF = 2 * time.Minute
+)
+
+// Reconnector keeps a tunnel of a provider open, reopening it
+// with exponential backoff when it fails to open or drops
+type Reconnector struct {
+	Provider Provider
+
+	// The local port tunnelled
+	Port int
+
+	// Zero values use MIN_BACKOFF and MAX_BACKOFF
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Called when a tunnel is open
+	OnUp func(t Tunnel)
+
+	// Called when a tunnel failed to open or dropped, with the
+	// wait before the next attempt
+	OnDown func(err error, retryIn time.Duration)
+}
+
+// Run keeps the tunnel open until ctx is done, closing it then.
+// It returns ErrDisabled at once for the none provider
+func (r *Reconnector) Run(ctx context.Context) error {
+	minBackoff := r.MinBackoff
+	if minBackoff == 0 {
+		minBackoff = MIN_BACKOFF
+	}
+
+	maxBackoff := r.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = MAX_BACKOFF
+	}
+
+	backoff := minBackoff
+
+	for {
+		t, err := r.Provider.Open(ctx, r.Port)
+		if errors.Is(err, ErrDisabled) {
+			return err
+		}
+
+		if err == nil {
+			backoff = minBackoff
+
+			if r.OnUp != nil {
+				r.OnUp(t)
+			}
+
+			err = wait(ctx, t)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if r.OnDown != nil {
+			r.OnDown(err, backoff)
+		}
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// wait returns why t dropped, or closes it once ctx is done
+func wait(ctx context.Context, t Tunnel) error {
+	done := make(chan error, 1)
+	go func() { done <- t.Wait() }()
+
+	select {
+	case err := <-done:
+		t.Close()
+
+		if err == nil {
+			err = ErrClosed
+		}
+		return err
+	case <-ctx.Done():
+		t.Close()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,67 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/tunnel/tunneltest"
+)
+
+func TestReconnectorReopensDroppedTunnels(t *testing.T) {
+	server := tunneltest.NewServer()
+	defer server.Close()
+
+	up := make(chan Tunnel, 10)
+	down := make(chan error, 10)
+
+	r := &Reconnector{
+		Provider:   &Localtunnel{BaseURL: server.URL},
+		Port:       localServer(t),
+		MinBackoff: 10 * time.Millisecond,
+		OnUp:       func(t Tunnel) { up <- t },
+		OnDown:     func(err error, retryIn time.Duration) { down <- err },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result := make(chan error, 1)
+	go func() { result <- r.Run(ctx) }()
+
+	next := func(want string) {
+		t.Helper()
+
+		select {
+		case <-up:
+			if want != "up" {
+				t.Fatalf("tunnel up, want %v", want)
+			}
+		case err := <-down:
+			if want != "down" {
+				t.Fatalf("tunnel down with %v, want %v", err, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no tunnel event, want %v", want)
+		}
+	}
+
+	next("up")
+	server.Drop()
+	next("down")
+	next("up")
+
+	cancel()
+
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v, want context.Canceled", err)
+	}
+}
+
+func TestReconnectorStopsForDisabledProvider(t *testing.T) {
+	r := &Reconnector{Provider: Disabled{}, Port: 8080}
+
+	if err := r.Run(context.Background()); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Run = %v, want ErrDisabled", err)
+	}
+}
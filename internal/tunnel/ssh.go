@@ -0,0 +1,169 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// How often the SSH server is checked to notice dropped connections
+const sshKeepAlive = 30 * time.Second
+
+// SSH opens reverse tunnels on an SSH server, like ssh -R
+type SSH struct {
+	// The SSH server, as host:port
+	Host string
+
+	// The user logged in as
+	User string
+
+	// The private key used to log in
+	KeyFile string
+
+	// The known_hosts file checking the key of the server,
+	// ~/.ssh/known_hosts when empty
+	KnownHosts string
+
+	// The address the server listens on for the tunnel
+	RemoteAddr string
+
+	// The URL the tunnel is reached at, http://host:port of
+	// the remote address on the server when empty
+	PublicURL string
+}
+
+func (s *SSH) clientConfig() (*ssh.ClientConfig, error) {
+	if s.Host == "" || s.User == "" || s.KeyFile == "" {
+		return nil, errors.New("the ssh tunnel needs a host, user and key")
+	}
+
+	key, err := os.ReadFile(s.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh key: %w", err)
+	}
+
+	knownHostsFile := s.KnownHosts
+	if knownHostsFile == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		knownHostsFile = filepath.Join(homeDir, ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// Open logs in to the server and has it listen on the remote address
+func (s *SSH) Open(ctx context.Context, port int) (Tunnel, error) {
+	clientConfig, err := s.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	publicURL, err := s.url()
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", s.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, s.Host, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	client := ssh.NewClient(clientConn, chans, reqs)
+
+	listener, err := client.Listen("tcp", s.RemoteAddr)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to listen on %v: %w", s.RemoteAddr, err)
+	}
+
+	go keepAlive(client)
+
+	return serve(listener, publicURL, fmt.Sprintf("localhost:%v", port), client.Close), nil
+}
+
+// keepAlive closes client once the server stops answering,
+// which ends the tunnel
+func keepAlive(client *ssh.Client) {
+	ticker := time.NewTicker(sshKeepAlive)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			client.Close()
+			return
+		}
+	}
+}
+
+func (s *SSH) url() (string, error) {
+	if s.PublicURL != "" {
+		return s.PublicURL, nil
+	}
+
+	host, _, err := net.SplitHostPort(s.Host)
+	if err != nil {
+		return "", err
+	}
+
+	_, port, err := net.SplitHostPort(s.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+// Origins returns the origin of the URL the tunnel is reached at
+func (s *SSH) Origins() []string {
+	publicURL, err := s.url()
+	if err != nil {
+		return nil
+	}
+
+	o, err := origin(publicURL)
+	if err != nil {
+		return nil
+	}
+
+	return []string{o}
+}
+
+// ForwardsClients is false, the connections are forwarded
+// as they are
+func (s *SSH) ForwardsClients() bool {
+	return false
+}
@@ -0,0 +1,190 @@
+// Package tunnel exposes the local web server remotely through
+// a configurable provider
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+)
+
+// ErrDisabled is returned when opening a tunnel of the none provider
+var ErrDisabled = errors.New("tunnel is disabled")
+
+// ErrClosed is why a tunnel closed by someone else dropped
+var ErrClosed = errors.New("tunnel was closed")
+
+// Tunnel forwards the connections made to its URL to a local port
+type Tunnel interface {
+	// URL returns the address the tunnel is reached at
+	URL() string
+
+	// Wait blocks until the tunnel is closed, returning nil,
+	// or drops, returning why
+	Wait() error
+
+	Close() error
+}
+
+// Provider opens tunnels to local ports
+type Provider interface {
+	Open(ctx context.Context, port int) (Tunnel, error)
+
+	// Origins returns the CORS origins of pages served through
+	// the tunnels, which may use a * wildcard
+	Origins() []string
+
+	// ForwardsClients reports whether the server of the tunnels
+	// appends the address of remote clients to X-Forwarded-For.
+	// Otherwise the header comes from the clients themselves
+	ForwardsClients() bool
+}
+
+// New returns the provider selected by tc
+func New(tc *config.TunnelConfig) (Provider, error) {
+	switch tc.GetProvider() {
+	case config.TUNNEL_LOCALTUNNEL:
+		return &Localtunnel{BaseURL: tc.GetBaseURL()}, nil
+	case config.TUNNEL_SSH:
+		return &SSH{
+			Host:       tc.GetSSHHost(),
+			User:       tc.GetSSHUser(),
+			KeyFile:    tc.GetSSHKey(),
+			KnownHosts: tc.GetSSHKnownHosts(),
+			RemoteAddr: tc.GetSSHRemoteAddr(),
+			PublicURL:  tc.GetPublicURL(),
+		}, nil
+	case config.TUNNEL_NONE, "":
+		return Disabled{}, nil
+	default:
+		return nil, fmt.Errorf("unknown tunnel provider %q", tc.GetProvider())
+	}
+}
+
+// Disabled is the none provider, which never opens a tunnel
+type Disabled struct{}
+
+func (Disabled) Open(ctx context.Context, port int) (Tunnel, error) {
+	return nil, ErrDisabled
+}
+
+func (Disabled) Origins() []string {
+	return nil
+}
+
+func (Disabled) ForwardsClients() bool {
+	return false
+}
+
+// origin returns the scheme and host of rawURL
+func origin(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URL", rawURL)
+	}
+
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// listenerTunnel forwards the connections accepted by a
+// listener on a remote server to a local address
+type listenerTunnel struct {
+	listener  net.Listener
+	url       string
+	localAddr string
+
+	// Closes what the listener depends on, may be nil
+	closer func() error
+
+	closed atomic.Bool
+	done   chan struct{}
+	err    error
+	once   sync.Once
+}
+
+func serve(listener net.Listener, url string, localAddr string, closer func() error) *listenerTunnel {
+	t := &listenerTunnel{
+		listener:  listener,
+		url:       url,
+		localAddr: localAddr,
+		closer:    closer,
+		done:      make(chan struct{}),
+	}
+
+	go t.serve()
+
+	return t
+}
+
+func (t *listenerTunnel) serve() {
+	defer close(t.done)
+
+	for {
+		remote, err := t.listener.Accept()
+		if err != nil {
+			if !t.closed.Load() {
+				t.err = err
+			}
+			return
+		}
+
+		go t.forward(remote)
+	}
+}
+
+// forward copies between remote and a new connection to the local address
+func (t *listenerTunnel) forward(remote net.Conn) {
+	local, err := net.Dial("tcp", t.localAddr)
+	if err != nil {
+		remote.Close()
+		return
+	}
+
+	go func() {
+		io.Copy(remote, local)
+		remote.Close()
+	}()
+
+	io.Copy(local, remote)
+	local.Close()
+}
+
+func (t *listenerTunnel) URL() string {
+	return t.url
+}
+
+func (t *listenerTunnel) Wait() error {
+	<-t.done
+	return t.err
+}
+
+func (t *listenerTunnel) Close() error {
+	var err error
+
+	t.once.Do(func() {
+		t.closed.Store(true)
+
+		err = t.listener.Close()
+
+		if t.closer != nil {
+			if closeErr := t.closer(); err == nil {
+				err = closeErr
+			}
+		}
+
+		<-t.done
+	})
+
+	return err
+}
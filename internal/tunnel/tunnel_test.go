@@ -0,0 +1,122 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/internal/tunnel/tunneltest"
+)
+
+// localServer serves a greeting and returns its port
+func localServer(t *testing.T) int {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	t.Cleanup(local.Close)
+
+	return local.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestLocaltunnelForwardsRequests(t *testing.T) {
+	server := tunneltest.NewServer()
+	defer server.Close()
+
+	provider := &Localtunnel{BaseURL: server.URL}
+
+	tunnel, err := provider.Open(context.Background(), localServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tunnel.URL() != server.PublicURL {
+		t.Errorf("URL = %q, want %q", tunnel.URL(), server.PublicURL)
+	}
+
+	res, err := http.Get(tunnel.URL() + "/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if string(body) != "hello /files" {
+		t.Errorf("body = %q, want %q", body, "hello /files")
+	}
+
+	if err := tunnel.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tunnel.Wait(); err != nil {
+		t.Errorf("Wait after Close = %v, want nil", err)
+	}
+}
+
+func TestLocaltunnelReportsDrops(t *testing.T) {
+	server := tunneltest.NewServer()
+	defer server.Close()
+
+	tunnel, err := (&Localtunnel{BaseURL: server.URL}).Open(context.Background(), localServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+
+	server.Drop()
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- tunnel.Wait() }()
+
+	select {
+	case err := <-waitErr:
+		if err == nil {
+			t.Error("Wait after a drop = nil, want an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after a drop")
+	}
+}
+
+func TestNewSelectsProvider(t *testing.T) {
+	provider, err := New(config.NewTunnelConfig().SetBaseURL("https://tunnel.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := provider.Origins(); !slices.Equal(got, []string{"https://*.tunnel.example.com"}) {
+		t.Errorf("localtunnel origins = %v", got)
+	}
+
+	provider, err = New(config.NewTunnelConfig().
+		SetProvider(config.TUNNEL_SSH).
+		SetSSHHost("example.com:22").
+		SetSSHRemoteAddr("0.0.0.0:9000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := provider.Origins(); !slices.Equal(got, []string{"http://example.com:9000"}) {
+		t.Errorf("ssh origins = %v", got)
+	}
+
+	provider, err = New(config.NewTunnelConfig().SetProvider(config.TUNNEL_NONE))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Open(context.Background(), 8080); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Open of the none provider = %v, want ErrDisabled", err)
+	}
+
+	if _, err := New(config.NewTunnelConfig().SetProvider("ngrok")); err == nil {
+		t.Error("New accepted an unknown provider")
+	}
+}
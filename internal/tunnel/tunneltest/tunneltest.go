@@ -0,0 +1,171 @@
+// Package tunneltest runs a local stand-in for a localtunnel
+// server, for testing tunnels without reaching the internet
+package tunneltest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Connections a client keeps open for requests
+const MAX_CONN_COUNT = 4
+
+// Server hands out a single tunnel. Requests to its public
+// URL are sent through the connections of the tunnel client
+type Server struct {
+	// The base URL clients register tunnels with
+	URL string
+
+	// The URL the tunnel is reached at
+	PublicURL string
+
+	api     *httptest.Server
+	public  *httptest.Server
+	clients net.Listener
+	conns   chan net.Conn
+
+	mu   sync.Mutex
+	open []net.Conn
+}
+
+// NewServer starts a server, which is stopped by Close
+func NewServer() *Server {
+	s := &Server{
+		conns: make(chan net.Conn, MAX_CONN_COUNT),
+	}
+
+	s.listen()
+
+	s.public = httptest.NewServer(http.HandlerFunc(s.forward))
+	s.api = httptest.NewServer(http.HandlerFunc(s.register))
+
+	s.URL = s.api.URL
+	s.PublicURL = s.public.URL
+
+	return s
+}
+
+// listen starts accepting the connections of a new tunnel client
+func (s *Server) listen() {
+	clients, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s.clients = clients
+
+	go s.accept(clients)
+}
+
+// register answers the registration of a tunnel
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	port := s.clients.Addr().(*net.TCPAddr).Port
+	s.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":             "test",
+		"port":           port,
+		"max_conn_count": MAX_CONN_COUNT,
+		"url":            s.PublicURL,
+	})
+}
+
+// accept queues the connections of the tunnel client
+func (s *Server) accept(clients net.Listener) {
+	for {
+		conn, err := clients.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if clients != s.clients {
+			// Accepted as the server was dropped
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.open = append(s.open, conn)
+		s.mu.Unlock()
+
+		s.conns <- conn
+	}
+}
+
+// forward sends r through a connection of the tunnel client
+func (s *Server) forward(w http.ResponseWriter, r *http.Request) {
+	var conn net.Conn
+
+	select {
+	case conn = <-s.conns:
+	case <-r.Context().Done():
+		return
+	}
+	defer conn.Close()
+
+	// Each connection carries a single request, the client
+	// opens a new one once it is closed
+	r.Header.Set("Connection", "close")
+
+	if err := r.Write(conn); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	for key, values := range res.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(res.StatusCode)
+
+	io.Copy(w, res.Body)
+}
+
+// Drop closes the connections of the tunnel client, as when
+// the server restarts. Tunnels registered later work again
+func (s *Server) Drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.close()
+	s.listen()
+}
+
+// close stops accepting connections and closes those accepted
+func (s *Server) close() {
+	s.clients.Close()
+
+	for _, conn := range s.open {
+		conn.Close()
+	}
+	s.open = nil
+
+	for {
+		select {
+		case <-s.conns:
+		default:
+			return
+		}
+	}
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.close()
+	s.mu.Unlock()
+
+	s.api.Close()
+	s.public.Close()
+}
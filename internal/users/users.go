@@ -0,0 +1,337 @@
+// Package users keeps the accounts of the file server and
+// decides what each may do below the paths granted to it
+package users
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/crypto"
+	"github.com/Owbird/SVault-Engine/internal/utils"
+	"github.com/ostafen/clover"
+)
+
+const (
+	// Can list, download and preview files
+	ROLE_VIEWER = "viewer"
+
+	// Can also upload files and create directories
+	ROLE_UPLOADER = "uploader"
+
+	// Can also rename, move and delete files
+	ROLE_ADMIN = "admin"
+)
+
+const (
+	// Actions checked against the role of a user
+	PERM_READ   = "read"
+	PERM_UPLOAD = "upload"
+	PERM_MODIFY = "modify"
+	PERM_DELETE = "delete"
+)
+
+var rolePerms = map[string][]string{
+	ROLE_VIEWER:   {PERM_READ},
+	ROLE_UPLOADER: {PERM_READ, PERM_UPLOAD},
+	ROLE_ADMIN:    {PERM_READ, PERM_UPLOAD, PERM_MODIFY, PERM_DELETE},
+}
+
+const usersCollection = "users"
+
+// How often and how long apart opening the database is tried
+// while the server or another CLI call holds it
+const (
+	openAttempts   = 10
+	openRetryDelay = 100 * time.Millisecond
+)
+
+var (
+	ErrNotFound      = errors.New("user not found")
+	ErrExists        = errors.New("user already exists")
+	ErrInvalidRole   = errors.New("invalid role, use viewer, uploader or admin")
+	ErrInvalidName   = errors.New("invalid user name")
+	ErrInvalidPath   = errors.New("invalid path, use a slash rooted path like /photos")
+	ErrEmptyPassword = errors.New("password cannot be empty")
+)
+
+// User is an account of the file server
+type User struct {
+	Name         string `clover:"name"`
+	PasswordHash string `clover:"passwordHash"`
+	Role         string `clover:"role"`
+
+	// Slash rooted path prefixes the user can access,
+	// including the mount name when mounts are served
+	Paths []string `clover:"paths"`
+}
+
+// Can reports whether the role of the user allows perm
+func (u User) Can(perm string) bool {
+	return slices.Contains(rolePerms[u.Role], perm)
+}
+
+// CanAccess reports whether the slash rooted p is at
+// or below one of the paths granted to the user
+func (u User) CanAccess(p string) bool {
+	p = path.Clean("/" + p)
+
+	for _, granted := range u.Paths {
+		if granted == "/" || p == granted || strings.HasPrefix(p, granted+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanTraverse reports whether the slash rooted p can be listed to
+// reach a granted path, e.g. / and /photos for a grant of /photos/2024.
+// Only the entries leading to granted paths should be shown
+func (u User) CanTraverse(p string) bool {
+	p = path.Clean("/" + p)
+
+	for _, granted := range u.Paths {
+		if p == "/" || strings.HasPrefix(granted, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanSee reports whether the slash rooted p can be shown in a
+// listing, being either accessible or on the way to a granted path
+func (u User) CanSee(p string) bool {
+	return u.CanAccess(p) || u.CanTraverse(p)
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := rolePerms[role]
+	return ok
+}
+
+// cleanGrant validates a granted path and normalizes it
+func cleanGrant(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", ErrInvalidPath
+	}
+
+	return path.Clean(p), nil
+}
+
+// StoreDir returns the directory of the users database
+// in the svault dir
+func StoreDir() (string, error) {
+	svaultDir, err := utils.GetSVaultDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(svaultDir, "users"), nil
+}
+
+// Store keeps the users in the clover database at dir.
+// The database is only opened while a call runs so the
+// CLI can manage users while the server is running,
+// a call waiting briefly while another holds it
+type Store struct {
+	dir    string
+	crypto *crypto.Crypto
+}
+
+func NewStore(dir string) *Store {
+	return &Store{
+		dir:    dir,
+		crypto: crypto.NewCrypto(),
+	}
+}
+
+// open opens the database, waiting for whoever holds it to close it
+func (s *Store) open() (*clover.DB, error) {
+	for attempt := 1; ; attempt++ {
+		db, err := clover.Open(s.dir)
+
+		// Clover keeps only the message of the lock error
+		if err == nil || attempt == openAttempts || !strings.Contains(err.Error(), "directory lock") {
+			return db, err
+		}
+
+		time.Sleep(openRetryDelay)
+	}
+}
+
+func (s *Store) withDB(fn func(db *clover.DB) error) error {
+	db, err := s.open()
+	if err != nil {
+		return fmt.Errorf("failed to open users database: %w", err)
+	}
+	defer db.Close()
+
+	hasCollection, err := db.HasCollection(usersCollection)
+	if err != nil {
+		return err
+	}
+
+	if !hasCollection {
+		if err := db.CreateCollection(usersCollection); err != nil {
+			return err
+		}
+	}
+
+	return fn(db)
+}
+
+func byName(name string) *clover.Criteria {
+	return clover.Field("name").Eq(name)
+}
+
+// Add creates a user with access to paths
+func (s *Store) Add(name string, password string, role string, paths ...string) error {
+	if name == "" || strings.ContainsAny(name, ":/") {
+		return ErrInvalidName
+	}
+
+	if password == "" {
+		return ErrEmptyPassword
+	}
+
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+
+	user := User{
+		Name:         name,
+		PasswordHash: s.crypto.Hash(password),
+		Role:         role,
+		Paths:        []string{},
+	}
+
+	for _, p := range paths {
+		granted, err := cleanGrant(p)
+		if err != nil {
+			return err
+		}
+
+		user.Paths = append(user.Paths, granted)
+	}
+
+	return s.withDB(func(db *clover.DB) error {
+		exists, err := db.Query(usersCollection).Where(byName(name)).Exists()
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return ErrExists
+		}
+
+		_, err = db.InsertOne(usersCollection, clover.NewDocumentOf(user))
+		return err
+	})
+}
+
+// Remove deletes a user
+func (s *Store) Remove(name string) error {
+	return s.withDB(func(db *clover.DB) error {
+		query := db.Query(usersCollection).Where(byName(name))
+
+		exists, err := query.Exists()
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return ErrNotFound
+		}
+
+		return query.Delete()
+	})
+}
+
+// Grant gives a user access to everything below p
+func (s *Store) Grant(name string, p string) error {
+	granted, err := cleanGrant(p)
+	if err != nil {
+		return err
+	}
+
+	return s.withDB(func(db *clover.DB) error {
+		user, err := findUser(db, name)
+		if err != nil {
+			return err
+		}
+
+		if slices.Contains(user.Paths, granted) {
+			return nil
+		}
+
+		return db.Query(usersCollection).Where(byName(name)).Update(map[string]interface{}{
+			"paths": append(user.Paths, granted),
+		})
+	})
+}
+
+// Get returns a user by name
+func (s *Store) Get(name string) (User, error) {
+	var user User
+
+	err := s.withDB(func(db *clover.DB) error {
+		var err error
+		user, err = findUser(db, name)
+		return err
+	})
+
+	return user, err
+}
+
+// List returns all users
+func (s *Store) List() ([]User, error) {
+	users := []User{}
+
+	err := s.withDB(func(db *clover.DB) error {
+		docs, err := db.Query(usersCollection).Sort(clover.SortOption{Field: "name", Direction: 1}).FindAll()
+		if err != nil {
+			return err
+		}
+
+		for _, doc := range docs {
+			var user User
+			if err := doc.Unmarshal(&user); err != nil {
+				return err
+			}
+
+			users = append(users, user)
+		}
+
+		return nil
+	})
+
+	return users, err
+}
+
+// VerifyPassword reports whether password is the one of user
+func (s *Store) VerifyPassword(user User, password string) bool {
+	return s.crypto.VerifyHash(password, user.PasswordHash)
+}
+
+func findUser(db *clover.DB, name string) (User, error) {
+	doc, err := db.Query(usersCollection).Where(byName(name)).FindFirst()
+	if err != nil {
+		return User{}, err
+	}
+
+	if doc == nil {
+		return User{}, ErrNotFound
+	}
+
+	var user User
+	err = doc.Unmarshal(&user)
+
+	return user, err
+}
@@ -0,0 +1,111 @@
+package users
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ostafen/clover"
+)
+
+func TestUserPaths(t *testing.T) {
+	user := User{Role: ROLE_VIEWER, Paths: []string{"/photos/2024"}}
+
+	tests := []struct {
+		path              string
+		access, traversal bool
+	}{
+		{"/", false, true},
+		{"/photos", false, true},
+		{"/photos/2024", true, false},
+		{"/photos/2024/a.jpg", true, false},
+		{"/photos/2023", false, false},
+		{"/photos/20245", false, false},
+		{"/docs", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := user.CanAccess(tt.path); got != tt.access {
+			t.Errorf("CanAccess(%q) = %v, want %v", tt.path, got, tt.access)
+		}
+		if got := user.CanTraverse(tt.path); got != tt.traversal {
+			t.Errorf("CanTraverse(%q) = %v, want %v", tt.path, got, tt.traversal)
+		}
+	}
+
+	if !user.Can(PERM_READ) || user.Can(PERM_UPLOAD) {
+		t.Error("viewer permissions are wrong")
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	if err := store.Add("ann", "secret", ROLE_UPLOADER, "/photos"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Add("ann", "secret", ROLE_VIEWER, "/"); !errors.Is(err, ErrExists) {
+		t.Errorf("duplicate Add error = %v, want %v", err, ErrExists)
+	}
+
+	if err := store.Add("bob", "secret", "owner", "/"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("invalid role error = %v, want %v", err, ErrInvalidRole)
+	}
+
+	if err := store.Add("bob", "secret", ROLE_VIEWER, "docs"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("relative path error = %v, want %v", err, ErrInvalidPath)
+	}
+
+	if err := store.Grant("ann", "/docs/"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := store.Get("ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(user.Paths) != 2 || user.Paths[1] != "/docs" {
+		t.Errorf("paths = %v, want [/photos /docs]", user.Paths)
+	}
+
+	if !store.VerifyPassword(user, "secret") || store.VerifyPassword(user, "wrong") {
+		t.Error("password verification is wrong")
+	}
+
+	if err := store.Remove("ann"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get("ann"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Remove error = %v, want %v", err, ErrNotFound)
+	}
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 0 {
+		t.Errorf("users = %v, want none", list)
+	}
+}
+
+func TestStoreWaitsForLock(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := clover.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(3 * openRetryDelay)
+		db.Close()
+	}()
+
+	if err := NewStore(dir).Add("ann", "secret", ROLE_VIEWER, "/"); err != nil {
+		t.Errorf("Add while locked = %v", err)
+	}
+}
@@ -1,10 +1,12 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func GetSVaultDir() (string, error) {
@@ -16,21 +18,95 @@ func GetSVaultDir() (string, error) {
 	return filepath.Join(userDir, ".svault"), nil
 }
 
-func GetLocalIp() (string, error) {
-	addrs, err := net.InterfaceAddrs()
+// Prefixes of the interfaces of containers, VMs and VPNs,
+// only picked when there is no other
+var virtualInterfaces = []string{
+	"docker", "br-", "veth", "virbr", "vboxnet", "vmnet", "lxc", "lxd", "cni", "flannel",
+	"tun", "tap", "wg", "utun", "tailscale", "zt",
+}
+
+// interfaceIPv4 returns the first IPv4 address of iface
+func interfaceIPv4(iface *net.Interface) net.IP {
+	addrs, err := iface.Addrs()
 	if err != nil {
-		return "0.0.0.0", err
+		return nil
 	}
 
 	for _, addr := range addrs {
-		ip, ok := addr.(*net.IPNet)
-		if ok && !ip.IP.IsLoopback() {
-			if ip.IP.To4() != nil {
-				return ip.IP.String(), nil
+		if ip, ok := addr.(*net.IPNet); ok && ip.IP.To4() != nil {
+			return ip.IP.To4()
+		}
+	}
+
+	return nil
+}
+
+// LocalInterface returns the interface named name and its IPv4
+// address. Without a name, it picks the one the local network is
+// most likely on, skipping those of containers, VMs and VPNs
+func LocalInterface(name string) (*net.Interface, net.IP, error) {
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ip := interfaceIPv4(iface)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("interface %v has no IPv4 address", name)
+		}
+
+		return iface, ip, nil
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var best *net.Interface
+	var bestIP net.IP
+	bestScore := 0
+
+	for i := range interfaces {
+		iface := &interfaces[i]
+
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		ip := interfaceIPv4(iface)
+		if ip == nil {
+			continue
+		}
+
+		score := 1
+
+		virtual := iface.Flags&net.FlagPointToPoint != 0
+		for _, prefix := range virtualInterfaces {
+			if strings.HasPrefix(iface.Name, prefix) {
+				virtual = true
+			}
+		}
+
+		if !virtual {
+			score += 2
+
+			if ip.IsPrivate() {
+				score++
 			}
 		}
+
+		if score > bestScore {
+			best, bestIP, bestScore = iface, ip, score
+		}
+	}
+
+	if best == nil {
+		return nil, nil, errors.New("no network interface with an IPv4 address")
 	}
-	return "0.0.0.0", nil
+
+	return best, bestIP, nil
 }
 
 func FmtBytes(bytes int64) string {
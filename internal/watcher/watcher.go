@@ -0,0 +1,236 @@
+// Package watcher reports changes anywhere under a directory tree
+package watcher
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// A file or directory was created or moved in
+	CREATE = "create"
+
+	// A file or directory was removed
+	REMOVE = "remove"
+
+	// A file or directory was moved away. The new name,
+	// if still under the tree, is reported as a CREATE
+	RENAME = "rename"
+
+	// The content of a file changed
+	WRITE = "write"
+
+	// Events were lost and subscribers should reload
+	// whatever state they keep about the tree
+	RESYNC = "resync"
+)
+
+// Events buffered per subscriber before new ones are dropped
+const subscriberBuffer = 256
+
+// Event is a change to a path under the watched directory
+type Event struct {
+	Op string
+
+	// Path relative to the watched directory, slash separated
+	// and rooted, e.g. "/photos/cat.jpg"
+	Path string
+}
+
+// Watcher watches a directory and all directories below it
+type Watcher struct {
+	dir     string
+	watcher *fsnotify.Watcher
+
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+// New starts watching dir recursively
+func New(dir string) (*Watcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		dir:         dir,
+		watcher:     fsWatcher,
+		subscribers: map[chan Event]bool{},
+	}
+
+	if err := w.addTree(dir); err != nil {
+		fsWatcher.Close()
+		return nil, err
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// Subscribe returns a channel receiving every event until
+// Unsubscribe or Close is called. A subscriber that falls behind
+// misses events and is sent a RESYNC once it catches up
+func (w *Watcher) Subscribe() chan Event {
+	ch := make(chan Event, subscriberBuffer)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.subscribers != nil {
+		w.subscribers[ch] = false
+	} else {
+		close(ch)
+	}
+
+	return ch
+}
+
+// Unsubscribe stops sending events to ch and closes it
+func (w *Watcher) Unsubscribe(ch chan Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.subscribers[ch]; ok {
+		delete(w.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Close stops watching and closes all subscriber channels
+func (w *Watcher) Close() error {
+	err := w.watcher.Close()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.subscribers {
+		close(ch)
+	}
+	w.subscribers = nil
+
+	return err
+}
+
+func (w *Watcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+
+			w.handle(event)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.publish(Event{Op: RESYNC, Path: "/"})
+			}
+		}
+	}
+}
+
+func (w *Watcher) handle(event fsnotify.Event) {
+	name := w.relative(event.Name)
+	if name == "" {
+		return
+	}
+
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Lstat(event.Name)
+		if err == nil && info.IsDir() {
+			// Anything created inside before the watch was
+			// added has no event of its own
+			w.addTree(event.Name)
+			w.publishTree(event.Name)
+			return
+		}
+
+		w.publish(Event{Op: CREATE, Path: name})
+	case event.Has(fsnotify.Remove):
+		w.publish(Event{Op: REMOVE, Path: name})
+	case event.Has(fsnotify.Rename):
+		w.publish(Event{Op: RENAME, Path: name})
+	case event.Has(fsnotify.Write):
+		w.publish(Event{Op: WRITE, Path: name})
+	}
+}
+
+// addTree watches dir and the directories below it.
+// Symlinks are not followed
+func (w *Watcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The tree may change while it is walked
+			if p == dir {
+				return err
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			return w.watcher.Add(p)
+		}
+
+		return nil
+	})
+}
+
+// publishTree sends a CREATE for dir and everything below it
+func (w *Watcher) publishTree(dir string) {
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil {
+			w.publish(Event{Op: CREATE, Path: w.relative(p)})
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) publish(event Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch, missed := range w.subscribers {
+		if missed {
+			select {
+			case ch <- Event{Op: RESYNC, Path: "/"}:
+				w.subscribers[ch] = false
+			default:
+				continue
+			}
+		}
+
+		select {
+		case ch <- event:
+		default:
+			w.subscribers[ch] = true
+		}
+	}
+}
+
+// relative converts an absolute path under the watched dir
+// into a slash rooted path. Returns "" for paths outside it
+func (w *Watcher) relative(p string) string {
+	rel, err := filepath.Rel(w.dir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+
+	if rel == "." {
+		return "/"
+	}
+
+	return "/" + filepath.ToSlash(rel)
+}
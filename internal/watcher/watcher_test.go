@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFor reads events until one matches op and path
+func waitFor(t *testing.T, events chan Event, op string, path string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case event := <-events:
+			if event.Op == op && event.Path == path {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no %v event for %v", op, path)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	events := w.Subscribe()
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, events, CREATE, "/a.txt")
+
+	// Files in new directories are watched too
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, events, CREATE, "/sub")
+
+	time.Sleep(50 * time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(dir, "sub", "deep", "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, events, CREATE, "/sub/deep/b.txt")
+
+	if err := os.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, events, RENAME, "/a.txt")
+	waitFor(t, events, CREATE, "/sub/c.txt")
+
+	if err := os.Remove(filepath.Join(dir, "sub", "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, events, REMOVE, "/sub/c.txt")
+}
+
+func TestWatcherClose(t *testing.T) {
+	w, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := w.Subscribe()
+	other := w.Subscribe()
+	w.Unsubscribe(other)
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-events; ok {
+		t.Fatal("subscription still open after Close")
+	}
+
+	if _, ok := <-w.Subscribe(); ok {
+		t.Fatal("subscribing to a closed watcher returned an open channel")
+	}
+}
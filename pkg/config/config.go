@@ -17,6 +17,18 @@ type AppConfig struct {
 
 	// The notification configuration
 	notification *config.NotifConfig
+
+	// The tunnel configuration
+	tunnel *config.TunnelConfig
+}
+
+// mountEntry is a [[server.mounts]] table of svault.toml
+type mountEntry struct {
+	Name         string `mapstructure:"name"`
+	Path         string `mapstructure:"path"`
+	AllowUploads bool   `mapstructure:"allowUploads"`
+	AllowModify  bool   `mapstructure:"allowModify"`
+	AllowDelete  bool   `mapstructure:"allowDelete"`
 }
 
 // Gets the app configuration from
@@ -40,25 +52,104 @@ func NewAppConfig() *AppConfig {
 
 	viper.SetDefault("server.name", fmt.Sprintf("%v's Server", hostname))
 	viper.SetDefault("server.allowUploads", false)
+	viper.SetDefault("server.allowModify", false)
+	viper.SetDefault("server.allowDelete", false)
+	viper.SetDefault("server.symlinks", "within")
+	viper.SetDefault("server.maxUploadSize", 0)
+	viper.SetDefault("server.overwritePolicy", "rename")
+	viper.SetDefault("server.searchIndex", false)
+	viper.SetDefault("server.showHidden", true)
+	viper.SetDefault("server.liveUpdates", true)
+	viper.SetDefault("server.themeDir", "")
+	viper.SetDefault("server.rateLimit", 0)
+	viper.SetDefault("server.rateBurst", 50)
+	viper.SetDefault("server.uploadLimit", 0)
+	viper.SetDefault("server.downloadLimit", 0)
+	viper.SetDefault("server.connUploadLimit", 0)
+	viper.SetDefault("server.connDownloadLimit", 0)
+	viper.SetDefault("server.metrics", false)
+	viper.SetDefault("server.metricsAddr", "")
 	viper.SetDefault("notification.allowNotif", true)
+	viper.SetDefault("tunnel.provider", "localtunnel")
+	viper.SetDefault("tunnel.baseURL", "https://loca.lt")
+	viper.SetDefault("tunnel.sshHost", "")
+	viper.SetDefault("tunnel.sshUser", "")
+	viper.SetDefault("tunnel.sshKey", "")
+	viper.SetDefault("tunnel.sshKnownHosts", "")
+	viper.SetDefault("tunnel.sshRemoteAddr", "localhost:8080")
+	viper.SetDefault("tunnel.publicURL", "")
 
 	err = viper.ReadInConfig()
 	if err != nil {
 		viper.SafeWriteConfig()
 	}
 
+	mounts := readMounts()
+
 	config := &AppConfig{
 		server:       config.NewServerConfig(),
 		notification: config.NewNotifConfig(),
+		tunnel:       config.NewTunnelConfig(),
 	}
 
 	config.server.SetName(viper.GetString("server.name"))
 	config.server.SetAllowUploads(viper.GetBool("server.allowUploads"))
+	config.server.SetAllowModify(viper.GetBool("server.allowModify"))
+	config.server.SetAllowDelete(viper.GetBool("server.allowDelete"))
+	config.server.SetSymlinkPolicy(viper.GetString("server.symlinks"))
+	config.server.SetMaxUploadSize(viper.GetInt64("server.maxUploadSize"))
+	config.server.SetOverwritePolicy(viper.GetString("server.overwritePolicy"))
+	config.server.SetSearchIndex(viper.GetBool("server.searchIndex"))
+	config.server.SetShowHidden(viper.GetBool("server.showHidden"))
+	config.server.SetLiveUpdates(viper.GetBool("server.liveUpdates"))
+	config.server.SetThemeDir(viper.GetString("server.themeDir"))
+	config.server.SetRateLimit(viper.GetFloat64("server.rateLimit"))
+	config.server.SetRateBurst(viper.GetInt("server.rateBurst"))
+	config.server.SetUploadLimit(viper.GetInt64("server.uploadLimit"))
+	config.server.SetDownloadLimit(viper.GetInt64("server.downloadLimit"))
+	config.server.SetConnUploadLimit(viper.GetInt64("server.connUploadLimit"))
+	config.server.SetConnDownloadLimit(viper.GetInt64("server.connDownloadLimit"))
+	config.server.SetMetrics(viper.GetBool("server.metrics"))
+	config.server.SetMetricsAddr(viper.GetString("server.metricsAddr"))
 	config.notification.SetAllowNotif(viper.GetBool("notification.allowNotif"))
+	config.tunnel.SetProvider(viper.GetString("tunnel.provider"))
+	config.tunnel.SetBaseURL(viper.GetString("tunnel.baseURL"))
+	config.tunnel.SetSSHHost(viper.GetString("tunnel.sshHost"))
+	config.tunnel.SetSSHUser(viper.GetString("tunnel.sshUser"))
+	config.tunnel.SetSSHKey(viper.GetString("tunnel.sshKey"))
+	config.tunnel.SetSSHKnownHosts(viper.GetString("tunnel.sshKnownHosts"))
+	config.tunnel.SetSSHRemoteAddr(viper.GetString("tunnel.sshRemoteAddr"))
+	config.tunnel.SetPublicURL(viper.GetString("tunnel.publicURL"))
+
+	for _, mount := range mounts {
+		config.server.AddMount(mount)
+	}
 
 	return config
 }
 
+// readMounts returns the mounts listed in svault.toml
+func readMounts() []*config.MountConfig {
+	entries := []mountEntry{}
+	if err := viper.UnmarshalKey("server.mounts", &entries); err != nil {
+		log.Fatalf("Failed to read server.mounts: %v", err)
+	}
+
+	mounts := []*config.MountConfig{}
+	for _, entry := range entries {
+		if !config.ValidMountName(entry.Name) {
+			log.Fatalf("Invalid mount name %q", entry.Name)
+		}
+
+		mounts = append(mounts, config.NewMountConfig(entry.Name, entry.Path).
+			SetAllowUploads(entry.AllowUploads).
+			SetAllowModify(entry.AllowModify).
+			SetAllowDelete(entry.AllowDelete))
+	}
+
+	return mounts
+}
+
 // GetSeverConfig returns the server configuration
 func (ac *AppConfig) GetSeverConfig() *config.ServerConfig {
 	return ac.server
@@ -69,11 +160,53 @@ func (ac *AppConfig) GetNotifConfig() *config.NotifConfig {
 	return ac.notification
 }
 
+// GetTunnelConfig returns the tunnel configuration
+func (ac *AppConfig) GetTunnelConfig() *config.TunnelConfig {
+	return ac.tunnel
+}
+
 // Save saves the server configuration to svault.toml
 func (ac *AppConfig) Save() error {
 	viper.Set("server.name", ac.server.GetName())
 	viper.Set("server.allowUploads", ac.server.GetAllowUploads())
+	viper.Set("server.allowModify", ac.server.GetAllowModify())
+	viper.Set("server.allowDelete", ac.server.GetAllowDelete())
+	viper.Set("server.symlinks", string(ac.server.GetSymlinkPolicy()))
+	viper.Set("server.maxUploadSize", ac.server.GetMaxUploadSize())
+	viper.Set("server.overwritePolicy", ac.server.GetOverwritePolicy())
+	viper.Set("server.searchIndex", ac.server.GetSearchIndex())
+	viper.Set("server.showHidden", ac.server.GetShowHidden())
+	viper.Set("server.liveUpdates", ac.server.GetLiveUpdates())
+	viper.Set("server.themeDir", ac.server.GetThemeDir())
+	viper.Set("server.rateLimit", ac.server.GetRateLimit())
+	viper.Set("server.rateBurst", ac.server.GetRateBurst())
+	viper.Set("server.uploadLimit", ac.server.GetUploadLimit())
+	viper.Set("server.downloadLimit", ac.server.GetDownloadLimit())
+	viper.Set("server.connUploadLimit", ac.server.GetConnUploadLimit())
+	viper.Set("server.connDownloadLimit", ac.server.GetConnDownloadLimit())
+	viper.Set("server.metrics", ac.server.GetMetrics())
+	viper.Set("server.metricsAddr", ac.server.GetMetricsAddr())
 	viper.Set("notification.allowNotif", ac.notification.GetAllowNotif())
+	viper.Set("tunnel.provider", ac.tunnel.GetProvider())
+	viper.Set("tunnel.baseURL", ac.tunnel.GetBaseURL())
+	viper.Set("tunnel.sshHost", ac.tunnel.GetSSHHost())
+	viper.Set("tunnel.sshUser", ac.tunnel.GetSSHUser())
+	viper.Set("tunnel.sshKey", ac.tunnel.GetSSHKey())
+	viper.Set("tunnel.sshKnownHosts", ac.tunnel.GetSSHKnownHosts())
+	viper.Set("tunnel.sshRemoteAddr", ac.tunnel.GetSSHRemoteAddr())
+	viper.Set("tunnel.publicURL", ac.tunnel.GetPublicURL())
+
+	mounts := []map[string]interface{}{}
+	for _, mount := range ac.server.GetMounts() {
+		mounts = append(mounts, map[string]interface{}{
+			"name":         mount.GetName(),
+			"path":         mount.GetDir(),
+			"allowUploads": mount.GetAllowUploads(),
+			"allowModify":  mount.GetAllowModify(),
+			"allowDelete":  mount.GetAllowDelete(),
+		})
+	}
+	viper.Set("server.mounts", mounts)
 
 	return viper.WriteConfig()
 }
@@ -0,0 +1,274 @@
+// Package events delivers the logs of the file server to any
+// number of subscribers without the server waiting on them
+package events
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+// Events queued for each subscriber. Events published while
+// the queue of a subscriber is full are dropped for it
+const SUBSCRIBER_BUFFER = 256
+
+// Subscriber handles the events of a Bus. Each subscriber is
+// called from its own goroutine, one event at a time in order
+type Subscriber interface {
+	HandleEvent(event models.ServerLog)
+}
+
+// SubscriberFunc is a function handling events
+type SubscriberFunc func(event models.ServerLog)
+
+func (f SubscriberFunc) HandleEvent(event models.ServerLog) {
+	f(event)
+}
+
+// blockingSubscriber is a Subscriber that may block,
+// which gives up once stop is closed
+type blockingSubscriber interface {
+	handleEventUntil(event models.ServerLog, stop <-chan struct{})
+}
+
+type subscription struct {
+	subscriber Subscriber
+	queue      chan models.ServerLog
+
+	// Closed once unsubscribed, for blocked subscribers to give up
+	stop chan struct{}
+	done chan struct{}
+}
+
+// deliver hands event to the subscriber
+func (sub *subscription) deliver(event models.ServerLog) {
+	if blocking, ok := sub.subscriber.(blockingSubscriber); ok {
+		blocking.handleEventUntil(event, sub.stop)
+		return
+	}
+
+	sub.subscriber.HandleEvent(event)
+}
+
+// end stops delivering once the queued events are handled
+// or the subscriber gives up on them
+func (sub *subscription) end() {
+	close(sub.queue)
+	close(sub.stop)
+}
+
+// Bus fans published events out to its subscribers. Publishing never
+// blocks, and a nil Bus drops every event
+type Bus struct {
+	mu      sync.RWMutex
+	subs    []*subscription
+	closed  bool
+	dropped atomic.Uint64
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe delivers the events published from now on to
+// subscriber until unsubscribe is called
+func (b *Bus) Subscribe(subscriber Subscriber) (unsubscribe func()) {
+	sub := &subscription{
+		subscriber: subscriber,
+		queue:      make(chan models.ServerLog, SUBSCRIBER_BUFFER),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		defer close(sub.done)
+
+		for event := range sub.queue {
+			sub.deliver(event)
+		}
+	}()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		sub.end()
+		return func() {}
+	}
+
+	b.subs = append(b.subs, sub)
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() { b.remove(sub) })
+	}
+}
+
+// remove stops delivering to sub once its queued events are handled
+func (b *Bus) remove(sub *subscription) {
+	b.mu.Lock()
+
+	i := slices.Index(b.subs, sub)
+	if i < 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	b.subs = slices.Delete(b.subs, i, i+1)
+	sub.end()
+
+	b.mu.Unlock()
+
+	<-sub.done
+}
+
+// Publish queues event for every subscriber
+func (b *Bus) Publish(event models.ServerLog) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subs {
+		select {
+		case sub.queue <- event:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns how many deliveries were dropped because
+// a subscriber fell behind
+func (b *Bus) Dropped() uint64 {
+	if b == nil {
+		return 0
+	}
+
+	return b.dropped.Load()
+}
+
+// Close stops the bus once the subscribers handled
+// their queued events. Later events are dropped
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+
+	b.closed = true
+	subs := b.subs
+	b.subs = nil
+
+	for _, sub := range subs {
+		sub.end()
+	}
+
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		<-sub.done
+	}
+}
+
+// channelSubscriber sends the events to its channel
+type channelSubscriber chan<- models.ServerLog
+
+func (ch channelSubscriber) HandleEvent(event models.ServerLog) {
+	ch <- event
+}
+
+func (ch channelSubscriber) handleEventUntil(event models.ServerLog, stop <-chan struct{}) {
+	// Events with room in ch are delivered even once stopped
+	select {
+	case ch <- event:
+		return
+	default:
+	}
+
+	select {
+	case ch <- event:
+	case <-stop:
+	}
+}
+
+// Channel sends the events to ch. A slow reader of ch only
+// makes the events it cannot keep up with be dropped, and
+// unsubscribing gives up on the events ch was not read for
+func Channel(ch chan<- models.ServerLog) Subscriber {
+	return channelSubscriber(ch)
+}
+
+// onlySubscriber passes the events of its types to subscriber
+type onlySubscriber struct {
+	subscriber Subscriber
+	types      []string
+}
+
+func (o onlySubscriber) HandleEvent(event models.ServerLog) {
+	if slices.Contains(o.types, event.Type) {
+		o.subscriber.HandleEvent(event)
+	}
+}
+
+func (o onlySubscriber) handleEventUntil(event models.ServerLog, stop <-chan struct{}) {
+	if !slices.Contains(o.types, event.Type) {
+		return
+	}
+
+	if blocking, ok := o.subscriber.(blockingSubscriber); ok {
+		blocking.handleEventUntil(event, stop)
+		return
+	}
+
+	o.subscriber.HandleEvent(event)
+}
+
+// Only passes the events of the given types to subscriber
+func Only(subscriber Subscriber, types ...string) Subscriber {
+	return onlySubscriber{subscriber: subscriber, types: types}
+}
+
+// Slog writes the events to logger, errors at the error level
+// and access logs with their fields as attributes
+func Slog(logger *slog.Logger) Subscriber {
+	return SubscriberFunc(func(event models.ServerLog) {
+		attrs := []slog.Attr{slog.String("type", event.Type)}
+
+		if event.Access != nil {
+			attrs = append(attrs,
+				slog.String("remote_ip", event.Access.RemoteIP),
+				slog.String("method", event.Access.Method),
+				slog.String("path", event.Access.Path),
+				slog.Int("status", event.Access.Status),
+				slog.Int64("bytes", event.Access.Bytes),
+				slog.Duration("duration", event.Access.Duration),
+			)
+
+			if event.Access.User != "" {
+				attrs = append(attrs, slog.String("user", event.Access.User))
+			}
+		}
+
+		if event.Error != nil {
+			attrs = append(attrs, slog.Any("error", event.Error))
+			logger.LogAttrs(context.Background(), slog.LevelError, event.Error.Error(), attrs...)
+			return
+		}
+
+		logger.LogAttrs(context.Background(), slog.LevelInfo, event.Message, attrs...)
+	})
+}
@@ -0,0 +1,180 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+func TestBusFansOut(t *testing.T) {
+	bus := NewBus()
+
+	first := make(chan models.ServerLog, 10)
+	second := make(chan models.ServerLog, 10)
+
+	bus.Subscribe(Channel(first))
+	unsubscribe := bus.Subscribe(Channel(second))
+
+	bus.Publish(models.ServerLog{Message: "one"})
+	unsubscribe()
+	bus.Publish(models.ServerLog{Message: "two"})
+	bus.Close()
+
+	if len(first) != 2 || len(second) != 1 {
+		t.Errorf("delivered %v and %v events, want 2 and 1", len(first), len(second))
+	}
+
+	if event := <-first; event.Message != "one" {
+		t.Errorf("first event = %q, want in publish order", event.Message)
+	}
+}
+
+func TestPublishNeverBlocks(t *testing.T) {
+	bus := NewBus()
+
+	// Nobody reads this channel
+	bus.Subscribe(Channel(make(chan models.ServerLog)))
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < SUBSCRIBER_BUFFER*2; i++ {
+			bus.Publish(models.ServerLog{Message: "event"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a stalled subscriber")
+	}
+
+	if bus.Dropped() == 0 {
+		t.Error("no events reported as dropped")
+	}
+
+	var nilBus *Bus
+	nilBus.Publish(models.ServerLog{Message: "dropped"})
+}
+
+func TestChannelDeliversUntilUnsubscribed(t *testing.T) {
+	bus := NewBus()
+
+	ch := make(chan models.ServerLog)
+	bus.Subscribe(Only(Channel(ch), models.API_LOG))
+
+	for i := 0; i < 3; i++ {
+		bus.Publish(models.ServerLog{Message: "event", Type: models.API_LOG})
+	}
+
+	// Unbuffered channels get every event, read or not yet
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %v was not delivered", i)
+		}
+	}
+
+	// Nobody reads this channel anymore
+	bus.Publish(models.ServerLog{Message: "event", Type: models.API_LOG})
+
+	done := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on an unread channel")
+	}
+}
+
+func TestOnly(t *testing.T) {
+	bus := NewBus()
+
+	ch := make(chan models.ServerLog, 10)
+	bus.Subscribe(Only(Channel(ch), models.ACCESS_LOG))
+
+	bus.Publish(models.ServerLog{Type: models.API_LOG})
+	bus.Publish(models.ServerLog{Type: models.ACCESS_LOG})
+	bus.Close()
+
+	if len(ch) != 1 || (<-ch).Type != models.ACCESS_LOG {
+		t.Error("Only passed events of other types")
+	}
+}
+
+func TestTyped(t *testing.T) {
+	bus := NewBus()
+
+	got := []Event{}
+	bus.Subscribe(Typed(func(event Event) {
+		got = append(got, event)
+	}))
+
+	bus.PublishEvent(RemoteURL{URL: "https://example.com"})
+	bus.PublishEvent(Access{Record: models.AccessLog{Method: "GET", Path: "/", Status: 200}})
+	bus.Publish(models.ServerLog{Type: "unknown", Message: "hello"})
+	bus.Close()
+
+	if len(got) != 3 {
+		t.Fatalf("delivered %v events, want 3", len(got))
+	}
+
+	if url, ok := got[0].(RemoteURL); !ok || url.URL != "https://example.com" {
+		t.Errorf("first event = %#v, want the remote URL", got[0])
+	}
+
+	if access, ok := got[1].(Access); !ok || access.Record.Path != "/" {
+		t.Errorf("second event = %#v, want the access record", got[1])
+	}
+
+	if api, ok := got[2].(APILog); !ok || api.Message != "hello" {
+		t.Errorf("third event = %#v, want an API log", got[2])
+	}
+}
+
+func TestSlog(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	bus := NewBus()
+	bus.Subscribe(Slog(slog.New(slog.NewJSONHandler(buf, nil))))
+
+	bus.Publish(models.ServerLog{Type: models.API_LOG, Error: errors.New("failed")})
+	bus.Publish(models.ServerLog{
+		Type:    models.ACCESS_LOG,
+		Message: "GET /",
+		Access:  &models.AccessLog{Method: "GET", Path: "/", Status: 200},
+	})
+	bus.Close()
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("logged %v lines, want 2", len(lines))
+	}
+
+	records := []map[string]any{}
+	for _, line := range lines {
+		record := map[string]any{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	if records[0]["level"] != "ERROR" || records[0]["msg"] != "failed" {
+		t.Errorf("error record = %v", records[0])
+	}
+
+	if records[1]["level"] != "INFO" || records[1]["path"] != "/" || records[1]["status"] != float64(200) {
+		t.Errorf("access record = %v", records[1])
+	}
+}
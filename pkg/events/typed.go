@@ -0,0 +1,120 @@
+package events
+
+import (
+	"fmt"
+
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+// Event is a log of the file server as its own type, one of
+// APILog, NetworkURL, RemoteURL, Access, TunnelUp and TunnelDown
+type Event interface {
+	// Log returns the event as published on the bus
+	Log() models.ServerLog
+}
+
+// APILog is a message or error of the API
+type APILog struct {
+	Message string
+	Err     error
+}
+
+// NetworkURL is the URL of the web UI on the local network,
+// or why it is not served
+type NetworkURL struct {
+	URL string
+	Err error
+}
+
+// RemoteURL is the URL of the web UI through the tunnel,
+// or why the tunnel could not be set up
+type RemoteURL struct {
+	URL string
+	Err error
+}
+
+// Access is a request handled by the server
+type Access struct {
+	Record models.AccessLog
+}
+
+// TunnelUp is published whenever the tunnel opens
+type TunnelUp struct {
+	URL string
+}
+
+// TunnelDown is published whenever the tunnel drops or fails to
+// open. Message tells when it is tried again
+type TunnelDown struct {
+	Err     error
+	Message string
+}
+
+func (e APILog) Log() models.ServerLog {
+	return models.ServerLog{Type: models.API_LOG, Message: e.Message, Error: e.Err}
+}
+
+func (e NetworkURL) Log() models.ServerLog {
+	return models.ServerLog{Type: models.SERVE_WEB_UI_NETWORK, Message: e.URL, Error: e.Err}
+}
+
+func (e RemoteURL) Log() models.ServerLog {
+	return models.ServerLog{Type: models.SERVE_WEB_UI_REMOTE, Message: e.URL, Error: e.Err}
+}
+
+func (e Access) Log() models.ServerLog {
+	record := e.Record
+
+	return models.ServerLog{
+		Type:    models.ACCESS_LOG,
+		Message: accessMessage(record),
+		Access:  &record,
+	}
+}
+
+func (e TunnelUp) Log() models.ServerLog {
+	return models.ServerLog{Type: models.TUNNEL_UP, Message: e.URL}
+}
+
+func (e TunnelDown) Log() models.ServerLog {
+	return models.ServerLog{Type: models.TUNNEL_DOWN, Message: e.Message, Error: e.Err}
+}
+
+// accessMessage summarizes a request for the log
+func accessMessage(record models.AccessLog) string {
+	return fmt.Sprintf("%v %v %v %v", record.RemoteIP, record.Method, record.Path, record.Status)
+}
+
+// Parse returns the typed event of a log. Logs of unknown
+// types are returned as API logs
+func Parse(l models.ServerLog) Event {
+	switch l.Type {
+	case models.SERVE_WEB_UI_NETWORK:
+		return NetworkURL{URL: l.Message, Err: l.Error}
+	case models.SERVE_WEB_UI_REMOTE:
+		return RemoteURL{URL: l.Message, Err: l.Error}
+	case models.ACCESS_LOG:
+		if l.Access != nil {
+			return Access{Record: *l.Access}
+		}
+	case models.TUNNEL_UP:
+		return TunnelUp{URL: l.Message}
+	case models.TUNNEL_DOWN:
+		return TunnelDown{Err: l.Error, Message: l.Message}
+	}
+
+	return APILog{Message: l.Message, Err: l.Error}
+}
+
+// Typed passes the events to fn as their own types,
+// for handling them with a type switch
+func Typed(fn func(event Event)) Subscriber {
+	return SubscriberFunc(func(l models.ServerLog) {
+		fn(Parse(l))
+	})
+}
+
+// PublishEvent publishes a typed event
+func (b *Bus) PublishEvent(event Event) {
+	b.Publish(event.Log())
+}
@@ -1,10 +1,15 @@
 package models
 
+import "time"
+
 const (
 	// File Server Log Types
 	API_LOG               = "api_log"
 	SERVE_WEB_UI_NETWORK    = "serve_web_ui_network"
 	SERVE_WEB_UI_REMOTE   = "serve_web_ui_remote"
+	ACCESS_LOG            = "access_log"
+	TUNNEL_UP             = "tunnel_up"
+	TUNNEL_DOWN           = "tunnel_down"
 )
 
 type Notification struct {
@@ -22,12 +27,42 @@ type ServerLog struct {
 	// Type of log from the file server.
 	// [api_log]: Log for the API
 	// [serve_web_ui_local]: Contains local url
-	// [serve_web_ui_remote]: Contains remote link
+	// [serve_web_ui_remote]: Contains remote link, or why the tunnel could not be set up
+	// [access_log]: Contains the access record of a request
+	// [tunnel_up]: Contains remote link once the tunnel is open
+	// [tunnel_down]: Why the tunnel dropped or failed to open
 	Type string
 
 	Message string
 
 	Error error
+
+	// The request handled, set for access logs
+	Access *AccessLog
+}
+
+type AccessLog struct {
+	// When the request was received
+	Time time.Time `json:"time"`
+
+	// Address of the client
+	RemoteIP string `json:"remote_ip"`
+
+	Method string `json:"method"`
+
+	// URL path and query of the request
+	Path  string `json:"path"`
+	Query string `json:"query,omitempty"`
+
+	// Status code and size in bytes of the response
+	Status int   `json:"status"`
+	Bytes  int64 `json:"bytes"`
+
+	// How long the request took
+	Duration time.Duration `json:"duration"`
+
+	// The user the request was authenticated as, if any
+	User string `json:"user,omitempty"`
 }
 
 type FileShareProgress struct {
@@ -0,0 +1,74 @@
+// Package qrcode renders QR codes of the server and share
+// URLs for phones to scan
+package qrcode
+
+import (
+	"strings"
+
+	"rsc.io/qr"
+)
+
+const (
+	// Light modules around the code, which scanners need to find it
+	QUIET_ZONE = 4
+
+	// Pixels of a module in PNG images
+	PNG_SCALE = 8
+
+	// Prefix of wormhole codes read by phone apps such as Warp
+	WORMHOLE_URI_SCHEME = "wormhole-transfer:"
+)
+
+// PNG returns a PNG image of the QR code of text
+func PNG(text string) ([]byte, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return nil, err
+	}
+
+	code.Scale = PNG_SCALE
+
+	return code.PNG(), nil
+}
+
+// Terminal returns the QR code of text drawn with block characters,
+// two modules a line. Light modules are drawn in the foreground
+// colour, so the code scans on dark terminals
+func Terminal(text string) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+
+	light := func(x, y int) bool {
+		return !code.Black(x, y)
+	}
+
+	var b strings.Builder
+
+	for y := -QUIET_ZONE; y < code.Size+QUIET_ZONE; y += 2 {
+		for x := -QUIET_ZONE; x < code.Size+QUIET_ZONE; x++ {
+			top := light(x, y)
+			bottom := y+1 < code.Size+QUIET_ZONE && light(x, y+1)
+
+			switch {
+			case top && bottom:
+				b.WriteRune('█')
+			case top:
+				b.WriteRune('▀')
+			case bottom:
+				b.WriteRune('▄')
+			default:
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+
+	return b.String(), nil
+}
+
+// WormholeURI returns the text of the QR code of a wormhole code
+func WormholeURI(code string) string {
+	return WORMHOLE_URI_SCHEME + code
+}
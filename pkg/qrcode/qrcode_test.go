@@ -0,0 +1,57 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPNG(t *testing.T) {
+	data, err := PNG("http://192.168.1.20:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := img.Bounds().Dx()
+	if size != img.Bounds().Dy() || size%PNG_SCALE != 0 {
+		t.Errorf("image is %v, want a square of whole modules", img.Bounds())
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	code, err := Terminal("http://192.168.1.20:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(code, "\n"), "\n")
+
+	width := utf8.RuneCountInString(lines[0])
+	if want := (width + 1) / 2; len(lines) != want {
+		t.Errorf("got %v lines, want %v for a width of %v", len(lines), want, width)
+	}
+
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(line); n != width {
+			t.Errorf("line %v has %v characters, want %v", i, n, width)
+		}
+	}
+
+	// The quiet zone is light
+	if lines[0] != strings.Repeat("█", width) {
+		t.Errorf("first line %q is not light", lines[0])
+	}
+}
+
+func TestWormholeURI(t *testing.T) {
+	if got := WormholeURI("7-guitarist-revenge"); got != "wormhole-transfer:7-guitarist-revenge" {
+		t.Errorf("WormholeURI = %q", got)
+	}
+}
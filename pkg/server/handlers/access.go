@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/accesslog"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+type accessKey struct{}
+
+// AccessLogger records every request on the bus
+// and in the access log file, when there is one
+type AccessLogger struct {
+	bus    *events.Bus
+	logger *accesslog.Logger
+	tunnel *TunnelState
+}
+
+func NewAccessLogger(bus *events.Bus, logger *accesslog.Logger, tunnel *TunnelState) *AccessLogger {
+	return &AccessLogger{
+		bus:    bus,
+		logger: logger,
+		tunnel: tunnel,
+	}
+}
+
+// statusWriter records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the flusher
+// of the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// setAccessUser records the user a request was authenticated as,
+// as the access log wraps the middleware authenticating it
+func setAccessUser(r *http.Request, name string) {
+	if record, ok := r.Context().Value(accessKey{}).(*models.AccessLog); ok {
+		record.User = name
+	}
+}
+
+// Middleware records the requests to next once they are handled
+func (a *AccessLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record := &models.AccessLog{
+			Time:     time.Now(),
+			RemoteIP: a.tunnel.clientIP(r),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Query:    r.URL.RawQuery,
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), accessKey{}, record)))
+
+		record.Status = sw.status
+		if record.Status == 0 {
+			record.Status = http.StatusOK
+		}
+		record.Bytes = sw.bytes
+		record.Duration = time.Since(record.Time)
+
+		if a.logger != nil {
+			if err := a.logger.Write(*record); err != nil {
+				a.bus.PublishEvent(events.APILog{
+					Err: fmt.Errorf("failed to write access log: %w", err),
+				})
+			}
+		}
+
+		a.bus.PublishEvent(events.Access{Record: *record})
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/accesslog"
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+func TestAccessLoggerRecordsRequests(t *testing.T) {
+	dir := t.TempDir()
+
+	logger, err := accesslog.NewLogger(dir, accesslog.MAX_SIZE, accesslog.MAX_BACKUPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	store := users.NewStore(t.TempDir())
+	if err := store.Add("ann", "secret", users.ROLE_VIEWER, "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus()
+	defer bus.Close()
+
+	logCh := make(chan models.ServerLog, 10)
+	bus.Subscribe(events.Only(events.Channel(logCh), models.ACCESS_LOG))
+
+	handler := NewAccessLogger(bus, logger, nil).Middleware(
+		NewAuth(bus, store).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("short"))
+		})),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/download?file=/a.txt", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.SetBasicAuth("ann", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	l := <-logCh
+	if l.Type != models.ACCESS_LOG || l.Access == nil {
+		t.Fatalf("log = %+v, want an access log", l)
+	}
+
+	records, err := accesslog.Query(dir, accesslog.Filter{Path: "/a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("records = %v, want 1", records)
+	}
+
+	record := records[0]
+	if record.RemoteIP != "10.0.0.1" || record.Method != http.MethodGet || record.Path != "/download" ||
+		record.Status != http.StatusTeapot || record.Bytes != 5 || record.User != "ann" {
+		t.Errorf("record = %+v", record)
+	}
+}
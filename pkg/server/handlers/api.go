@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Owbird/SVault-Engine/internal/users"
+)
+
+// APIError is the body of every failed API response
+type APIError struct {
+	// Human readable description of the failure
+	Error string `json:"error"`
+
+	// HTTP status code of the response
+	Status int `json:"status"`
+}
+
+// APIFiles is the body returned when listing a directory
+type APIFiles struct {
+	// The listed directory relative to the served dir
+	Path string `json:"path"`
+
+	// The files on the requested page
+	Files []File `json:"files"`
+
+	// The key the files are sorted by, directories first
+	Sort string `json:"sort"`
+
+	// Either "asc" or "desc"
+	Order string `json:"order"`
+
+	// The requested page, starting at 1
+	Page int `json:"page"`
+
+	PerPage int `json:"per_page"`
+
+	// Number of files in the directory across all pages
+	Total int `json:"total"`
+}
+
+// Pages returns the number of pages in the listing
+func (f APIFiles) Pages() int {
+	if f.PerPage <= 0 {
+		return 1
+	}
+
+	return max(1, (f.Total+f.PerPage-1)/f.PerPage)
+}
+
+// APIConfig exposes the server configuration to clients
+type APIConfig struct {
+	// The server label to be displayed
+	Name string `json:"name"`
+
+	// Whether uploads are accepted
+	AllowUploads bool `json:"allow_uploads"`
+
+	// Whether files can be renamed and moved and directories created
+	AllowModify bool `json:"allow_modify"`
+
+	// Whether files and directories can be deleted
+	AllowDelete bool `json:"allow_delete"`
+
+	// Maximum size of an upload request in bytes, 0 for no limit
+	MaxUploadSize int64 `json:"max_upload_size"`
+
+	// What happens when an upload targets an existing file
+	OverwritePolicy string `json:"overwrite_policy"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeJSONError reports err with the status mapped by errorStatus.
+// Server side failures are not echoed back to the client
+func writeJSONError(w http.ResponseWriter, err error, msg string) {
+	status := errorStatus(err)
+
+	var httpErr *httpError
+	if errors.As(err, &httpErr) || status != http.StatusInternalServerError {
+		msg = msg + ": " + err.Error()
+	}
+
+	writeJSON(w, status, APIError{
+		Error:  msg,
+		Status: status,
+	})
+}
+
+// APIFilesHandler lists the directory in the dir query, sorted
+// and paginated by the sort, order, page and per_page queries
+func (h *Handlers) APIFilesHandler(w http.ResponseWriter, r *http.Request) {
+	listing, err := h.listFiles(r, r.URL.Query().Get("dir"), parseListOptions(r.URL.Query()))
+	if err != nil {
+		writeJSONError(w, err, "Failed to list files")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, listing)
+}
+
+// APIDownloadHandler sends the file in the file query, or an
+// archive of the dir query or of several file queries
+func (h *Handlers) APIDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.download(w, r); err != nil {
+		writeJSONError(w, err, "Failed to download file")
+	}
+}
+
+// APIUploadHandler stores the files of a multipart request
+// and returns their details
+func (h *Handlers) APIUploadHandler(w http.ResponseWriter, r *http.Request) {
+	files, err := h.saveUploads(w, r)
+	if err != nil {
+		writeJSONError(w, err, "Failed to upload files")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, files)
+}
+
+// APIInfoHandler returns the details of the path in the file query
+func (h *Handlers) APIInfoHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("file")
+
+	if err := h.authorize(r, users.PERM_READ, name); err != nil {
+		writeJSONError(w, err, "Failed to get file info")
+		return
+	}
+
+	file, err := h.statFile(name)
+	if err != nil {
+		writeJSONError(w, err, "Failed to get file info")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, file)
+}
+
+// APIConfigHandler returns the server configuration,
+// limited to what the user of the request may do
+func (h *Handlers) APIConfigHandler(w http.ResponseWriter, r *http.Request) {
+	config := h.indexHTMLConfig(r)
+
+	writeJSON(w, http.StatusOK, APIConfig{
+		Name:            config.Name,
+		AllowUploads:    config.AllowUploads,
+		AllowModify:     config.AllowModify,
+		AllowDelete:     config.AllowDelete,
+		MaxUploadSize:   h.serverConfig.GetMaxUploadSize(),
+		OverwritePolicy: h.serverConfig.GetOverwritePolicy(),
+	})
+}
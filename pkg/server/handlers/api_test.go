@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIFilesHandler(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files?dir=/sub", nil)
+	rec := httptest.NewRecorder()
+
+	h.APIFilesHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", rec.Code, http.StatusOK)
+	}
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+
+	var body APIFiles
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Path != "/sub" || len(body.Files) != 1 {
+		t.Fatalf("unexpected listing %+v", body)
+	}
+
+	file := body.Files[0]
+	if file.Name != "file.txt" || file.Path != "/sub/file.txt" || file.Size != 4 || file.ModTime.IsZero() {
+		t.Fatalf("unexpected file %+v", file)
+	}
+
+	if file.MimeType != "text/plain; charset=utf-8" {
+		t.Fatalf("MimeType = %q", file.MimeType)
+	}
+}
+
+func TestAPIErrorBodies(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		target     string
+		wantStatus int
+	}{
+		{"traversal", h.APIFilesHandler, "/api/v1/files?dir=../", http.StatusForbidden},
+		{"missing dir", h.APIFilesHandler, "/api/v1/files?dir=/missing", http.StatusNotFound},
+		{"missing query", h.APIDownloadHandler, "/api/v1/download", http.StatusBadRequest},
+		{"download dir", h.APIDownloadHandler, "/api/v1/download?file=/sub", http.StatusNotFound},
+		{"info traversal", h.APIInfoHandler, "/api/v1/info?file=../secret.txt", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			var body APIError
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != tt.wantStatus || body.Status != tt.wantStatus || body.Error == "" {
+				t.Fatalf("got %v %+v, want status %v", rec.Code, body, tt.wantStatus)
+			}
+		})
+	}
+}
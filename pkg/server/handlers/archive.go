@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+const (
+	// Archive formats accepted in the format query
+	ARCHIVE_ZIP    = "zip"
+	ARCHIVE_TAR_GZ = "tar.gz"
+)
+
+// archiveWriter streams files into an archive format
+type archiveWriter interface {
+	// addDir adds an empty directory entry
+	addDir(name string, info fs.FileInfo) error
+
+	// addFile adds a file entry with the contents of r
+	addFile(name string, info fs.FileInfo, r io.Reader) error
+
+	// Close flushes the archive without closing the underlying writer
+	Close() error
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (z *zipArchive) addDir(name string, info fs.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	header.Name = name + "/"
+
+	_, err = z.zw.CreateHeader(header)
+	return err
+}
+
+func (z *zipArchive) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	header.Name = name
+	header.Method = zip.Deflate
+
+	dst, err := z.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+func (z *zipArchive) Close() error {
+	return z.zw.Close()
+}
+
+type tarGzArchive struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarGzArchive) addDir(name string, info fs.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	header.Name = name + "/"
+
+	return t.tw.WriteHeader(header)
+}
+
+func (t *tarGzArchive) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	// Symlinks allowed by the policy are archived as the file they point to
+	header.Typeflag = tar.TypeReg
+	header.Linkname = ""
+	header.Name = name
+
+	if err := t.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(t.tw, r, info.Size())
+	return err
+}
+
+func (t *tarGzArchive) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+
+	return t.gw.Close()
+}
+
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == ARCHIVE_TAR_GZ {
+		gw := gzip.NewWriter(w)
+
+		return &tarGzArchive{
+			gw: gw,
+			tw: tar.NewWriter(gw),
+		}
+	}
+
+	return &zipArchive{
+		zw: zip.NewWriter(w),
+	}
+}
+
+// download serves the request of the download handlers. A single
+// file is sent as is, directories and multiple files are streamed
+// as an archive in the requested format
+func (h *Handlers) download(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	format := query.Get("format")
+
+	if err := h.authorize(r, users.PERM_READ, append(query["dir"], query["file"]...)...); err != nil {
+		return err
+	}
+
+	switch {
+	case len(query["dir"]) > 0:
+		return h.serveArchive(w, r, query["dir"][:1], format)
+	case len(query["file"]) > 1 || (len(query["file"]) == 1 && format != ""):
+		return h.serveArchive(w, r, query["file"], format)
+	case len(query["file"]) == 1:
+		return h.serveDownload(w, r, query["file"][0])
+	default:
+		return &httpError{status: http.StatusBadRequest, err: fmt.Errorf("missing file or dir")}
+	}
+}
+
+// serveArchive streams the named files and directories as a
+// single archive. Each selection is stored under its base name.
+// Nothing is written to w when an error is returned
+func (h *Handlers) serveArchive(w http.ResponseWriter, r *http.Request, names []string, format string) error {
+	if format == "" {
+		format = ARCHIVE_ZIP
+	}
+
+	if format != ARCHIVE_ZIP && format != ARCHIVE_TAR_GZ {
+		return &httpError{status: http.StatusBadRequest, err: fmt.Errorf("unsupported archive format %v", format)}
+	}
+
+	selections := make([]string, 0, len(names))
+
+	// Validate everything up front, failures midway can only abort the stream
+	for _, name := range names {
+		cleaned, err := fsroot.Clean(name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := h.root.Stat(cleaned); err != nil {
+			return err
+		}
+
+		selections = append(selections, cleaned)
+	}
+
+	archiveName := "files"
+	if len(selections) == 1 && selections[0] != "." {
+		archiveName = path.Base(selections[0])
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": archiveName + "." + format,
+	}))
+	if format == ARCHIVE_ZIP {
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+
+	h.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("Downloading %v as %v", strings.Join(selections, ", "), format),
+	})
+
+	archive := newArchiveWriter(format, w)
+
+	for _, selection := range selections {
+		prefix := path.Base(selection)
+		if selection == "." {
+			prefix = ""
+		}
+
+		err := h.walk(r, selection, func(rel string, info fs.FileInfo) error {
+			name := path.Join(prefix, relativeTo(selection, rel))
+			if name == "" {
+				return nil
+			}
+
+			if info.IsDir() {
+				return archive.addDir(name, info)
+			}
+
+			f, err := h.root.Open(rel)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return archive.addFile(name, info, f)
+		})
+		if err != nil {
+			h.bus.PublishEvent(events.APILog{
+				Err: fmt.Errorf("archive of %v aborted: %w", selection, err),
+			})
+
+			// The status is already sent, aborting the response
+			// keeps the client from taking the archive as complete
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		h.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("archive of %v failed: %w", strings.Join(selections, ", "), err),
+		})
+
+		panic(http.ErrAbortHandler)
+	}
+
+	return nil
+}
+
+// relativeTo returns rel relative to the base dir it was found
+// in, or an empty string for the base itself
+func relativeTo(base string, rel string) string {
+	switch {
+	case rel == base:
+		return ""
+	case base == ".":
+		return rel
+	default:
+		return strings.TrimPrefix(rel, base+"/")
+	}
+}
+
+// walk calls fn for rel and everything below it, using the
+// root so the symlink policy applies. Directories already
+// visited on the current branch are skipped to avoid link loops.
+// Entries a listing of r leaves out are skipped as well
+func (h *Handlers) walk(r *http.Request, rel string, fn func(rel string, info fs.FileInfo) error) error {
+	return h.walkDir(r, rel, nil, fn)
+}
+
+func (h *Handlers) walkDir(r *http.Request, rel string, ancestors []fs.FileInfo, fn func(rel string, info fs.FileInfo) error) error {
+	info, err := h.root.Stat(rel)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(rel, info); err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	for _, ancestor := range ancestors {
+		if os.SameFile(ancestor, info) {
+			return nil
+		}
+	}
+
+	entries, err := h.root.ReadDir(rel)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), uploadTempPrefix) {
+			continue
+		}
+
+		if !h.serverConfig.GetShowHidden() && isHidden(entry.Name()) {
+			continue
+		}
+
+		if !h.visible(r, path.Join(rel, entry.Name())) {
+			continue
+		}
+
+		if err := h.walkDir(r, path.Join(rel, entry.Name()), append(ancestors, info), fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestDownloadDirAsZip(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	if err := os.WriteFile(filepath.Join(base, "served", "sub", ".hidden"), []byte("hidden"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.DownloadFileHandler(rec, httptest.NewRequest(http.MethodGet, "/download?dir=/sub&format=zip", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=sub.zip" {
+		t.Errorf("Content-Disposition = %q, want attachment of sub.zip", got)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, f := range zr.File {
+		got = append(got, f.Name)
+	}
+	sort.Strings(got)
+
+	want := []string{"sub/", "sub/.hidden", "sub/file.txt"}
+	if len(got) != len(want) {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("entries = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDownloadDirAsZipSkipsUnlisted(t *testing.T) {
+	h, base := newTestHandlers(t)
+	h.serverConfig.SetShowHidden(false)
+
+	sub := filepath.Join(base, "served", "sub")
+
+	if err := os.Mkdir(filepath.Join(sub, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{".hidden", ".git/config", uploadTempPrefix + "123"} {
+		if err := os.WriteFile(filepath.Join(sub, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.DownloadFileHandler(rec, httptest.NewRequest(http.MethodGet, "/download?dir=/sub&format=zip", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, f := range zr.File {
+		got = append(got, f.Name)
+	}
+	sort.Strings(got)
+
+	want := []string{"sub/", "sub/file.txt"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+}
+
+func TestDownloadSelectionAsTarGz(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	if err := os.WriteFile(filepath.Join(base, "served", "top.txt"), []byte("top"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.DownloadFileHandler(rec, httptest.NewRequest(http.MethodGet, "/download?file=/top.txt&file=/sub/file.txt&format=tar.gz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{}
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents[header.Name] = string(data)
+	}
+
+	if contents["top.txt"] != "top" || contents["file.txt"] != "file" || len(contents) != 2 {
+		t.Fatalf("unexpected archive contents %v", contents)
+	}
+}
+
+func TestDownloadArchiveRejectsBadRequests(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{"/download?dir=/sub&format=rar", http.StatusBadRequest},
+		{"/download?dir=../", http.StatusForbidden},
+		{"/download?file=/sub/file.txt&file=../secret.txt", http.StatusForbidden},
+		{"/download?dir=/missing", http.StatusNotFound},
+		{"/download", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.DownloadFileHandler(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
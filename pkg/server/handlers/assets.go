@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+)
+
+// The built in templates and assets, so installed binaries
+// work without the source tree
+//
+//go:embed templates
+var embedded embed.FS
+
+// Cache-Control of assets requested with their current version
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// builtinTheme returns the embedded templates dir
+func builtinTheme() fs.FS {
+	theme, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	return theme
+}
+
+// parseTemplates parses the built in templates and then the
+// *.html files of themeDir, which replace those of the same name
+func parseTemplates(themeDir string, funcs template.FuncMap) (*template.Template, error) {
+	tpl, err := template.New("").Funcs(funcs).ParseFS(builtinTheme(), "*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	if themeDir == "" {
+		return tpl, nil
+	}
+
+	overrides, err := filepath.Glob(filepath.Join(themeDir, "*.html"))
+	if err != nil || len(overrides) == 0 {
+		return tpl, err
+	}
+
+	return tpl.ParseFiles(overrides...)
+}
+
+// asset is the content of a file served under /assets
+type asset struct {
+	data    []byte
+	modTime time.Time
+
+	// Hash of data used as the ETag and cache busting version
+	version string
+}
+
+// assetStore serves the UI assets, preferring the files in
+// the assets dir of the theme over the built in ones
+type assetStore struct {
+	builtin fs.FS
+	theme   *fsroot.Root
+
+	mu     sync.Mutex
+	cached map[string]asset
+}
+
+// newAssetStore opens the assets of themeDir, if any
+func newAssetStore(themeDir string) (*assetStore, error) {
+	builtin, err := fs.Sub(builtinTheme(), "assets")
+	if err != nil {
+		return nil, err
+	}
+
+	store := &assetStore{
+		builtin: builtin,
+		cached:  map[string]asset{},
+	}
+
+	if themeDir == "" {
+		return store, nil
+	}
+
+	info, err := os.Stat(themeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open theme dir: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("theme dir %v is not a directory", themeDir)
+	}
+
+	theme, err := fsroot.Open(filepath.Join(themeDir, "assets"), fsroot.SymlinkDeny)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	store.theme = theme
+
+	return store, nil
+}
+
+// get returns the asset called name. Theme files are read on every
+// call so they can be edited while the server runs
+func (s *assetStore) get(name string) (asset, error) {
+	if s.theme != nil {
+		a, err := s.readTheme(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return a, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.cached[name]; ok {
+		return a, nil
+	}
+
+	data, err := fs.ReadFile(s.builtin, name)
+	if err != nil {
+		return asset{}, err
+	}
+
+	// Embedded files have no modification time
+	a := asset{data: data, version: version(data)}
+	s.cached[name] = a
+
+	return a, nil
+}
+
+func (s *assetStore) readTheme(name string) (asset, error) {
+	f, err := s.theme.Open(name)
+	if err != nil {
+		return asset{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return asset{}, err
+	}
+	if info.IsDir() {
+		return asset{}, fs.ErrNotExist
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return asset{}, err
+	}
+
+	return asset{data: data, modTime: info.ModTime(), version: version(data)}, nil
+}
+
+// url returns the path of the asset called name with its version,
+// letting browsers cache it until it changes
+func (s *assetStore) url(name string) string {
+	a, err := s.get(name)
+	if err != nil {
+		return "/assets/" + name
+	}
+
+	return fmt.Sprintf("/assets/%v?v=%v", name, a.version)
+}
+
+func version(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (h *Handlers) GetAssets(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+
+	a, err := h.assets.get(file)
+	if err != nil {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeType(file))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+a.version+`"`)
+
+	// Unversioned requests are revalidated with the ETag
+	if r.URL.Query().Get("v") == a.version {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	http.ServeContent(w, r, file, a.modTime, bytes.NewReader(a.data))
+}
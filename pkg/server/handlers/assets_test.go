@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func getAsset(h *Handlers, file string, query string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/assets/"+file+query, nil)
+	req.SetPathValue("file", file)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	h.GetAssets(rec, req)
+
+	return rec
+}
+
+func TestGetAssetsCaching(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	rec := getAsset(h, "index.js", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v", rec.Code)
+	}
+
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/javascript") {
+		t.Errorf("Content-Type = %v", got)
+	}
+
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("unversioned Cache-Control = %v", got)
+	}
+
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	rec = getAsset(h, "index.js", "", http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %v, want %v", rec.Code, http.StatusNotModified)
+	}
+
+	url := h.assets.url("index.js")
+	_, query, _ := strings.Cut(url, "?")
+
+	rec = getAsset(h, "index.js", "?"+query, nil)
+	if got := rec.Header().Get("Cache-Control"); got != immutableCacheControl {
+		t.Errorf("versioned Cache-Control = %v", got)
+	}
+}
+
+func TestThemeDirOverrides(t *testing.T) {
+	theme := t.TempDir()
+
+	os.MkdirAll(filepath.Join(theme, "assets"), 0o755)
+	os.WriteFile(filepath.Join(theme, "assets", "index.js"), []byte("// themed"), 0o644)
+	os.WriteFile(filepath.Join(theme, "preview.html"), []byte(`{{ define "preview.html" }}themed{{ end }}`), 0o644)
+
+	assets, err := newAssetStore(theme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := assets.get("index.js")
+	if err != nil || string(a.data) != "// themed" {
+		t.Fatalf("index.js = %q, %v, want the theme file", a.data, err)
+	}
+
+	// Assets missing from the theme come from the built in ones
+	if _, err := assets.get("preview.css"); err != nil {
+		t.Fatalf("preview.css: %v", err)
+	}
+
+	if _, err := assets.get("../preview.html"); err == nil {
+		t.Fatal("served a file outside the theme assets")
+	}
+
+	tpl, err := parseTemplates(theme, template.FuncMap{
+		"fmtBytes": func(int64) string { return "" },
+		"add":      func(a, b int) int { return a + b },
+		"hasThumb": func(string) bool { return false },
+		"asset":    assets.url,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &strings.Builder{}
+	if err := tpl.ExecuteTemplate(out, "preview.html", nil); err != nil || out.String() != "themed" {
+		t.Fatalf("preview.html = %q, %v", out, err)
+	}
+
+	// Templates missing from the theme come from the built in ones
+	if tpl.Lookup("index.html") == nil {
+		t.Fatal("built in index.html missing")
+	}
+}
+
+func TestPagesAreSelfContained(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	pages := []struct {
+		url     string
+		handler http.HandlerFunc
+	}{
+		{"/?dir=/sub", h.GetFilesHandler},
+		{"/search?q=file", h.SearchHandler},
+		{"/preview?file=/sub/file.txt", h.PreviewFileHandler},
+	}
+
+	assetURL := regexp.MustCompile(`"/assets/([\w.]+)\?v=\w+"`)
+
+	for _, page := range pages {
+		rec := httptest.NewRecorder()
+		page.handler(rec, httptest.NewRequest(http.MethodGet, page.url, nil))
+
+		if got := rec.Header().Get("Content-Security-Policy"); got != pageCSP {
+			t.Errorf("%v Content-Security-Policy = %q", page.url, got)
+		}
+
+		body := rec.Body.String()
+		if strings.Contains(body, "http://") || strings.Contains(body, "https://") {
+			t.Errorf("%v loads external resources", page.url)
+		}
+
+		assets := assetURL.FindAllStringSubmatch(body, -1)
+		if len(assets) == 0 {
+			t.Errorf("%v links no assets", page.url)
+		}
+
+		for _, asset := range assets {
+			if rec := getAsset(h, asset[1], "", nil); rec.Code != http.StatusOK {
+				t.Errorf("%v links missing asset %v", page.url, asset[1])
+			}
+		}
+	}
+}
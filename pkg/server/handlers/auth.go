@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+// How long users are kept before being read again,
+// picking up changes made with the CLI
+const usersReloadInterval = 5 * time.Second
+
+type userKey struct{}
+
+var errForbidden = &httpError{
+	status: http.StatusForbidden,
+	err:    errors.New("access denied"),
+}
+
+// Auth checks the HTTP Basic credentials of requests against
+// the users store. Without any users every request is let through,
+// and until the store has been read once every request is refused
+type Auth struct {
+	bus   *events.Bus
+	store *users.Store
+
+	mu     sync.Mutex
+	users  map[string]users.User
+	ready  bool
+	loaded time.Time
+
+	// Held while the users are read from the store
+	loading sync.Mutex
+
+	// Digests of the last password verified for each user,
+	// sparing a bcrypt check on every request
+	verified map[string][32]byte
+}
+
+func NewAuth(bus *events.Bus, store *users.Store) *Auth {
+	return &Auth{
+		bus:      bus,
+		store:    store,
+		users:    map[string]users.User{},
+		verified: map[string][32]byte{},
+	}
+}
+
+// current returns the users, reading them again once stale.
+// Stale users are still returned while they are read again in the
+// background, and kept if the store cannot be read.
+// ok is false until the store has been read successfully
+func (a *Auth) current() (map[string]users.User, bool) {
+	a.mu.Lock()
+	all, ready, fresh := a.users, a.ready, time.Since(a.loaded) < usersReloadInterval
+	a.mu.Unlock()
+
+	if fresh {
+		return all, ready
+	}
+
+	if ready {
+		if a.loading.TryLock() {
+			go func() {
+				defer a.loading.Unlock()
+				a.load()
+			}()
+		}
+
+		return all, true
+	}
+
+	a.loading.Lock()
+	defer a.loading.Unlock()
+
+	a.mu.Lock()
+	fresh = time.Since(a.loaded) < usersReloadInterval
+	a.mu.Unlock()
+
+	if !fresh {
+		a.load()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.users, a.ready
+}
+
+// load reads the users from the store. Reading takes a while and
+// may wait for the CLI, so a.mu is only held to keep the result
+func (a *Auth) load() {
+	list, err := a.store.List()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Failed reads are only tried again once the interval passes
+	a.loaded = time.Now()
+
+	if err != nil {
+		a.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("failed to load users: %w", err),
+		})
+		return
+	}
+
+	loaded := map[string]users.User{}
+	for _, user := range list {
+		loaded[user.Name] = user
+	}
+
+	a.users = loaded
+	a.ready = true
+}
+
+// authenticate returns the user the credentials belong to
+func (a *Auth) authenticate(all map[string]users.User, name string, password string) (users.User, bool) {
+	user, ok := all[name]
+	if !ok {
+		return users.User{}, false
+	}
+
+	// Changing the password changes the hash and the digest with it
+	digest := sha256.Sum256([]byte(user.PasswordHash + "\x00" + password))
+
+	a.mu.Lock()
+	last, cached := a.verified[name]
+	a.mu.Unlock()
+
+	if cached && subtle.ConstantTimeCompare(last[:], digest[:]) == 1 {
+		return user, true
+	}
+
+	if !a.store.VerifyPassword(user, password) {
+		return users.User{}, false
+	}
+
+	a.mu.Lock()
+	a.verified[name] = digest
+	a.mu.Unlock()
+
+	return user, true
+}
+
+// Middleware requires the requests to next to be authenticated
+// once users exist, making the user available to the handlers
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		all, ok := a.current()
+		if !ok {
+			// Letting requests through could expose files to anyone
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Users are unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		if len(all) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name, password, ok := r.BasicAuth()
+		if ok {
+			if user, ok := a.authenticate(all, name, password); ok {
+				setAccessUser(r, user.Name)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+				return
+			}
+
+			a.bus.PublishEvent(events.APILog{
+				Message: fmt.Sprintf("Failed login as %q from %v", name, r.RemoteAddr),
+			})
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="SVault", charset="UTF-8"`)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+	})
+}
+
+// requestUser returns the user a request was authenticated as.
+// ok is false when the server has no users
+func requestUser(r *http.Request) (users.User, bool) {
+	user, ok := r.Context().Value(userKey{}).(users.User)
+	return user, ok
+}
+
+// fullPath returns the path of name as granted to users,
+// including the mount the handlers serve
+func (h *Handlers) fullPath(name string) string {
+	return path.Join("/", h.serverConfig.GetBasePath(), path.Clean("/"+name))
+}
+
+// aclPaths returns the paths of name checked against the grants,
+// the requested one and the one its symlinks lead to in the root
+func (h *Handlers) aclPaths(name string) []string {
+	paths := []string{h.fullPath(name)}
+
+	// Paths the policy refuses fail when used, the lexical check suffices
+	resolved, err := h.root.Resolve(name)
+	if err != nil {
+		return paths
+	}
+
+	rel, err := filepath.Rel(h.root.RealName(), resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return paths
+	}
+
+	if p := h.fullPath(filepath.ToSlash(rel)); p != paths[0] {
+		paths = append(paths, p)
+	}
+
+	return paths
+}
+
+// authorize checks that the user of r may perform perm on names
+func (h *Handlers) authorize(r *http.Request, perm string, names ...string) error {
+	user, ok := requestUser(r)
+	if !ok {
+		return nil
+	}
+
+	if !user.Can(perm) {
+		return errForbidden
+	}
+
+	for _, name := range names {
+		for _, p := range h.aclPaths(name) {
+			if !user.CanAccess(p) {
+				return errForbidden
+			}
+		}
+	}
+
+	return nil
+}
+
+// authorizeList checks that the user of r may list dir,
+// either granted or on the way to a granted path
+func (h *Handlers) authorizeList(r *http.Request, dir string) error {
+	user, ok := requestUser(r)
+	if !ok {
+		return nil
+	}
+
+	if !user.Can(users.PERM_READ) {
+		return errForbidden
+	}
+
+	for _, p := range h.aclPaths(dir) {
+		if !user.CanSee(p) {
+			return errForbidden
+		}
+	}
+
+	return nil
+}
+
+// visible reports whether name can be shown to the user of r
+func (h *Handlers) visible(r *http.Request, name string) bool {
+	user, ok := requestUser(r)
+	if !ok {
+		return true
+	}
+
+	for _, p := range h.aclPaths(name) {
+		if !user.CanSee(p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// userCan reports whether the user of r, if any, has perm
+func userCan(r *http.Request, perm string) bool {
+	user, ok := requestUser(r)
+	return !ok || user.Can(perm)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/ostafen/clover"
+)
+
+// newAuthMux serves h behind an Auth with a viewer granted /sub
+func newAuthMux(t *testing.T, h *Handlers) http.Handler {
+	t.Helper()
+
+	store := users.NewStore(t.TempDir())
+	if err := store.Add("viewer", "secret", users.ROLE_VIEWER, "/sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	registerTestRoutes(mux, h)
+
+	return NewAuth(h.bus, store).Middleware(mux)
+}
+
+func registerTestRoutes(mux *http.ServeMux, h *Handlers) {
+	mux.HandleFunc("GET /api/v1/files", h.APIFilesHandler)
+	mux.HandleFunc("GET /api/v1/download", h.APIDownloadHandler)
+	mux.HandleFunc("POST /api/v1/mkdir", h.APIMkdirHandler)
+	mux.HandleFunc("POST /api/v1/delete", h.APIDeleteHandler)
+}
+
+func TestAuthRequiresLogin(t *testing.T) {
+	h, _ := newTestHandlers(t)
+	handler := newAuthMux(t, h)
+
+	for _, password := range []string{"", "wrong"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+		if password != "" {
+			req.SetBasicAuth("viewer", password)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("password %q status = %v, want %v", password, rec.Code, http.StatusUnauthorized)
+		}
+
+		if !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic") {
+			t.Errorf("password %q missing Basic challenge", password)
+		}
+	}
+}
+
+func TestAuthRefusesUntilUsersLoad(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	dir := t.TempDir()
+
+	// Holding the database open keeps the store from reading it
+	db, err := clover.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mux := http.NewServeMux()
+	registerTestRoutes(mux, h)
+	handler := NewAuth(h.bus, users.NewStore(dir)).Middleware(mux)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %v, want %v", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestAuthEnforcesPathsAndRole(t *testing.T) {
+	h, base := newTestHandlers(t)
+	h.serverConfig.SetAllowModify(true).SetAllowDelete(true)
+	handler := newAuthMux(t, h)
+
+	os.WriteFile(filepath.Join(base, "served", "top.txt"), []byte("top"), 0o644)
+	os.Mkdir(filepath.Join(base, "served", "private"), 0o755)
+
+	// Links within the root still lead out of the grant
+	os.Symlink(filepath.Join(base, "served", "top.txt"), filepath.Join(base, "served", "sub", "top-link.txt"))
+	os.Symlink(filepath.Join(base, "served", "private"), filepath.Join(base, "served", "sub", "private-link"))
+
+	tests := []struct {
+		method, target, body string
+		wantStatus           int
+	}{
+		{http.MethodGet, "/api/v1/files?dir=/sub", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/download?file=/sub/file.txt", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/download?file=/top.txt", "", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/download?dir=/", "", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/download?file=/sub/top-link.txt", "", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/files?dir=/sub/private-link", "", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/mkdir", `{"path":"/sub/new"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/v1/delete", `{"path":"/sub/file.txt"}`, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.SetBasicAuth("viewer", "secret")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%v %v status = %v, want %v", tt.method, tt.target, rec.Code, tt.wantStatus)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "served", "sub", "file.txt")); err != nil {
+		t.Errorf("viewer deleted a file: %v", err)
+	}
+}
+
+func TestAuthFiltersListing(t *testing.T) {
+	h, base := newTestHandlers(t)
+	handler := newAuthMux(t, h)
+
+	os.WriteFile(filepath.Join(base, "served", "top.txt"), []byte("top"), 0o644)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files?dir=/", nil)
+	req.SetBasicAuth("viewer", "secret")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", rec.Code, http.StatusOK)
+	}
+
+	listing := APIFiles{}
+	if err := json.NewDecoder(rec.Body).Decode(&listing); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listing.Files) != 1 || listing.Files[0].Name != "sub" {
+		t.Errorf("files = %v, want only sub", listing.Files)
+	}
+}
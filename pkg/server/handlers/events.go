@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/watcher"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+// Comments sent on idle streams so proxies and tunnels keep them open
+const eventsKeepAlive = 25 * time.Second
+
+var errLiveUpdatesDisabled = &httpError{
+	status: http.StatusNotFound,
+	err:    errors.New("live updates are disabled on this server"),
+}
+
+// FileRow defines the data passed to the file-row
+// and file-card templates
+type FileRow struct {
+	File         File
+	Query        string
+	ServerConfig IndexHTMLConfig
+}
+
+// Row returns the data to render file as part of the listing
+func (i IndexHTML) Row(file File) FileRow {
+	return FileRow{
+		File:         file,
+		Query:        i.Query,
+		ServerConfig: i.ServerConfig,
+	}
+}
+
+// DirEvent is sent to browsers when an entry of the
+// directory they are viewing changes
+type DirEvent struct {
+	// One of "create", "remove", "rename", "write" or "resync"
+	Op string `json:"op"`
+
+	// Path of the entry relative to the served dir
+	Path string `json:"path"`
+
+	// Details of created and written entries
+	File *File `json:"file,omitempty"`
+
+	// Rendered table row and grid card of created and written entries
+	Row  string `json:"row,omitempty"`
+	Card string `json:"card,omitempty"`
+}
+
+// EventsHandler streams changes to the entries of the directory
+// in the dir query as Server-Sent Events
+func (h *Handlers) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.serverConfig.GetLiveUpdates() {
+		http.Error(w, "Failed to watch directory", errorStatus(errLiveUpdatesDisabled))
+		return
+	}
+
+	dir, err := fsroot.Clean(r.URL.Query().Get("dir"))
+	if err == nil {
+		_, err = h.root.Stat(dir)
+	}
+	if err != nil {
+		http.Error(w, "Failed to watch directory", errorStatus(err))
+		return
+	}
+	dir = path.Join("/", dir)
+
+	if err := h.authorizeList(r, dir); err != nil {
+		http.Error(w, "Failed to watch directory", errorStatus(err))
+		return
+	}
+
+	wt, err := h.getWatcher()
+	if err != nil {
+		h.bus.PublishEvent(events.APILog{
+			Err: err,
+		})
+		http.Error(w, "Failed to watch directory", http.StatusInternalServerError)
+		return
+	}
+
+	changes := wt.Subscribe()
+	defer wt.Unsubscribe(changes)
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tells the browser how long to wait before reconnecting
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	h.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("Live updates for %v connected by %v", dir, r.RemoteAddr),
+	})
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+
+		case event, ok := <-changes:
+			if !ok {
+				return
+			}
+
+			dirEvent, ok := h.dirEvent(r, event, dir)
+			if !ok {
+				continue
+			}
+
+			data, err := json.Marshal(dirEvent)
+			if err != nil {
+				continue
+			}
+
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// dirEvent converts a watcher event into the event sent to
+// the browser of r viewing dir. Events for other directories, temp
+// files, hidden files when they are not shown and entries the
+// user cannot see are dropped
+func (h *Handlers) dirEvent(r *http.Request, event watcher.Event, dir string) (DirEvent, bool) {
+	if event.Op == watcher.RESYNC {
+		return DirEvent{Op: event.Op, Path: dir}, true
+	}
+
+	name := path.Base(event.Path)
+
+	if path.Dir(event.Path) != dir || strings.HasPrefix(name, uploadTempPrefix) {
+		return DirEvent{}, false
+	}
+
+	if !h.serverConfig.GetShowHidden() && isHidden(name) {
+		return DirEvent{}, false
+	}
+
+	if !h.visible(r, event.Path) {
+		return DirEvent{}, false
+	}
+
+	dirEvent := DirEvent{Op: event.Op, Path: event.Path}
+
+	if event.Op != watcher.CREATE && event.Op != watcher.WRITE {
+		return dirEvent, true
+	}
+
+	// Entries the symlink policy hides are not announced
+	file, err := h.statFile(event.Path)
+	if err != nil {
+		return DirEvent{}, false
+	}
+
+	row := IndexHTML{ServerConfig: h.indexHTMLConfig(r)}.Row(file)
+
+	rowHTML, cardHTML := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := tmpl.ExecuteTemplate(rowHTML, "file-row", row); err != nil {
+		return DirEvent{}, false
+	}
+	if err := tmpl.ExecuteTemplate(cardHTML, "file-card", row); err != nil {
+		return DirEvent{}, false
+	}
+
+	dirEvent.File = &file
+	dirEvent.Row = rowHTML.String()
+	dirEvent.Card = cardHTML.String()
+
+	return dirEvent, true
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/watcher"
+)
+
+func TestEventsHandler(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(h.EventsHandler))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?dir=/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %v, content type = %v", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	// The stream is open once the retry interval arrives
+	if line := <-lines; !strings.HasPrefix(line, "retry:") {
+		t.Fatalf("first line = %q", line)
+	}
+
+	served := filepath.Join(base, "served")
+	os.WriteFile(filepath.Join(served, "other.txt"), []byte("other"), 0o644)
+	os.WriteFile(filepath.Join(served, "sub", "new.txt"), []byte("new"), 0o644)
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed before the create event")
+			}
+
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+
+			var event DirEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatal(err)
+			}
+
+			if event.Path == "/other.txt" {
+				t.Fatalf("got event for another directory: %+v", event)
+			}
+
+			if event.Op != watcher.CREATE {
+				continue
+			}
+
+			if event.Path != "/sub/new.txt" || event.File == nil || event.File.Name != "new.txt" {
+				t.Fatalf("create event = %+v", event)
+			}
+
+			if !strings.Contains(event.Row, `data-path="/sub/new.txt"`) || !strings.Contains(event.Card, "new.txt") {
+				t.Fatalf("rendered row = %q, card = %q", event.Row, event.Card)
+			}
+
+			return
+		case <-timeout:
+			t.Fatal("timed out waiting for the create event")
+		}
+	}
+}
+
+func TestEventsHandlerRejects(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	tests := []struct {
+		dir        string
+		wantStatus int
+	}{
+		{"../", http.StatusForbidden},
+		{"/missing", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.EventsHandler(rec, httptest.NewRequest(http.MethodGet, "/events?dir="+tt.dir, nil))
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("dir %q status = %v, want %v", tt.dir, rec.Code, tt.wantStatus)
+		}
+	}
+
+	h.serverConfig.SetLiveUpdates(false)
+
+	rec := httptest.NewRecorder()
+	h.EventsHandler(rec, httptest.NewRequest(http.MethodGet, "/events?dir=/", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("disabled status = %v, want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDirEventFiltersHidden(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	os.WriteFile(filepath.Join(base, "served", ".hidden"), []byte("hidden"), 0o644)
+
+	r := httptest.NewRequest(http.MethodGet, "/events?dir=/", nil)
+
+	if _, ok := h.dirEvent(r, watcher.Event{Op: watcher.CREATE, Path: "/.hidden"}, "/"); !ok {
+		t.Fatal("hidden file dropped while hidden files are shown")
+	}
+
+	h.serverConfig.SetShowHidden(false)
+
+	if _, ok := h.dirEvent(r, watcher.Event{Op: watcher.CREATE, Path: "/.hidden"}, "/"); ok {
+		t.Fatal("hidden file announced while hidden files are not shown")
+	}
+
+	if _, ok := h.dirEvent(r, watcher.Event{Op: watcher.CREATE, Path: "/" + uploadTempPrefix + "x"}, "/"); ok {
+		t.Fatal("upload temp file announced")
+	}
+}
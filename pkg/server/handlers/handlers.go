@@ -3,253 +3,438 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
+	"io/fs"
 	"log"
+	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/search"
+	"github.com/Owbird/SVault-Engine/internal/thumbnail"
+	"github.com/Owbird/SVault-Engine/internal/users"
 	"github.com/Owbird/SVault-Engine/internal/utils"
-	"github.com/Owbird/SVault-Engine/pkg/models"
+	"github.com/Owbird/SVault-Engine/internal/watcher"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+	"golang.org/x/net/webdav"
 )
 
 type Handlers struct {
-	logCh        chan models.ServerLog
+	bus          *events.Bus
 	dir          string
+	root         *fsroot.Root
+	assets       *assetStore
+	uploads      *resumableUploads
+	thumbs       *thumbnail.Cache
+	davLocks     webdav.LockSystem
+	index        *search.Index
+	watcher      *watcher.Watcher
+	watcherMu    sync.Mutex
 	serverConfig *config.ServerConfig
 	notifConfig  *config.NotifConfig
+	urls         *ServerURLs
 }
 
 type File struct {
 	// The name of the file
 	Name string `json:"name"`
 
+	// The path of the file relative to the served dir
+	Path string `json:"path"`
+
 	// Whether it's a file or directory
 	IsDir bool `json:"is_dir"`
 
 	// Size of the file in bytes
-	Size string `json:"size"`
+	Size int64 `json:"size"`
+
+	// Last modification time of the file
+	ModTime time.Time `json:"mod_time"`
+
+	// MIME type guessed from the file extension.
+	// Empty for directories
+	MimeType string `json:"mime_type,omitempty"`
 }
 
 type IndexHTMLConfig struct {
 	Name         string
 	AllowUploads bool
+	AllowModify  bool
+	AllowDelete  bool
+	LiveUpdates  bool
+
+	// URL path of the mount being shown, "" at the root
+	Base string
 }
 
 // IndexHTML defines the data passed to the index.html
 // template file
 type IndexHTML struct {
-	Files        []File
-	CurrentPath  string
+	Files       []File
+	CurrentPath string
+	Query       string
+
+	// Sorting and pagination of the listing
+	Sort  string
+	Order string
+	Page  int
+	Pages int
+	Total int
+
 	ServerConfig IndexHTMLConfig
 }
 
-var tmpl *template.Template
-
-func getCwd() string {
-	_, filename, _, ok := runtime.Caller(0)
-	if !ok {
-		log.Fatalln("Failed to get templates dir")
-	}
+// httpError carries the status code an error
+// should be reported with
+type httpError struct {
+	status int
+	err    error
+}
 
-	cwd := filepath.Dir(filename)
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
 
-	return cwd
+func (e *httpError) Unwrap() error {
+	return e.err
 }
 
+var tmpl *template.Template
+
+// Content-Security-Policy of the web UI pages. Everything they load
+// comes from this server. data: images are the icons in app.css
+const pageCSP = "default-src 'none'; script-src 'self'; style-src 'self'; " +
+	"img-src 'self' data:; media-src 'self'; frame-src 'self'; connect-src 'self'; " +
+	"form-action 'self'; base-uri 'none'; frame-ancestors 'none'"
+
 func NewHandlers(
-	logCh chan models.ServerLog,
+	bus *events.Bus,
 	dir string,
 	serverConfig *config.ServerConfig,
 	notifConfig *config.NotifConfig,
 ) *Handlers {
-	cwd := getCwd()
+	assets, err := newAssetStore(serverConfig.GetThemeDir())
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	tpl, err := template.ParseGlob(filepath.Join(cwd, "templates/*.html"))
+	tpl, err := parseTemplates(serverConfig.GetThemeDir(), template.FuncMap{
+		"fmtBytes": utils.FmtBytes,
+		"add":      func(a, b int) int { return a + b },
+		"hasThumb": thumbnail.Supported,
+		"asset":    assets.url,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	tmpl = tpl
 
-	return &Handlers{
-		logCh:        logCh,
+	root, err := fsroot.Open(dir, serverConfig.GetSymlinkPolicy())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	svaultDir, err := utils.GetSVaultDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Mounts keep their partial uploads and thumbnails apart
+	mountDir := filepath.FromSlash(serverConfig.GetBasePath())
+
+	thumbs, err := thumbnail.NewCache(filepath.Join(svaultDir, "cache", "thumbnails", mountDir), thumbnailSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	h := &Handlers{
+		bus:          bus,
 		dir:          dir,
+		root:         root,
+		assets:       assets,
+		uploads:      newResumableUploads(filepath.Join(svaultDir, "uploads", mountDir)),
+		thumbs:       thumbs,
+		davLocks:     webdav.NewMemLS(),
 		serverConfig: serverConfig,
 		notifConfig:  notifConfig,
 	}
+
+	if serverConfig.GetSearchIndex() {
+		h.startIndex()
+	}
+
+	return h
 }
 
-func (h *Handlers) GetFileUpload(w http.ResponseWriter, r *http.Request) {
-	h.logCh <- models.ServerLog{
-		Message: "Receiving files",
-		Type:    models.API_LOG,
+// getWatcher returns the watcher of the served dir,
+// starting it on first use
+func (h *Handlers) getWatcher() (*watcher.Watcher, error) {
+	h.watcherMu.Lock()
+	defer h.watcherMu.Unlock()
+
+	if h.watcher != nil {
+		return h.watcher, nil
 	}
 
-	reader, err := r.MultipartReader()
+	w, err := watcher.New(h.root.RealName())
 	if err != nil {
-		log.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to watch %v: %w", h.dir, err)
 	}
 
-	uploadDir := r.FormValue("uploadDir")
+	h.watcher = w
 
-	for {
-		part, err := reader.NextPart()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	return w, nil
+}
 
-		// Handle file parts only
-		if part.FileName() != "" {
-			filePath := filepath.Join(h.dir, uploadDir, part.FileName())
-
-			dst, err := os.Create(filePath)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			defer dst.Close()
-
-			if _, err := io.Copy(dst, part); err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			h.logCh <- models.ServerLog{
-				Message: fmt.Sprintf("File received at %v", filePath),
-				Type:    models.API_LOG,
-			}
-
-			h.notifConfig.SendNotification(models.Notification{
-				Title: "File received",
-				Body:  fmt.Sprintf("File %v received", part.FileName()),
-			})
-		}
+// Close stops the watcher of the served dir if it was started
+func (h *Handlers) Close() error {
+	h.watcherMu.Lock()
+	defer h.watcherMu.Unlock()
+
+	if h.watcher == nil {
+		return nil
 	}
 
-	return
+	err := h.watcher.Close()
+	h.watcher = nil
+
+	return err
 }
 
-func (h *Handlers) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
+// startIndex builds the search index in the background and keeps
+// it current with a watcher. Search walks the tree until it is ready
+func (h *Handlers) startIndex() {
+	w, err := h.getWatcher()
+	if err != nil {
+		h.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("search index disabled: %w", err),
+		})
+		return
+	}
 
-	if len(query["file"]) > 0 {
-		if filepath.Dir(query["file"][0]) == ".." || filepath.Base(query["file"][0]) == ".." {
-			http.Error(w, "Failed to download file", http.StatusInternalServerError)
-			return
+	h.index = search.NewIndex(h.root.RealName())
 
+	go func() {
+		if err := h.index.Run(w); err != nil {
+			h.bus.PublishEvent(events.APILog{
+				Err: fmt.Errorf("failed to index %v: %w", h.dir, err),
+			})
 		}
+	}()
+}
 
-		file := filepath.Join(h.dir, query["file"][0])
+func (h *Handlers) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.download(w, r); err != nil {
+		http.Error(w, "Failed to download file", errorStatus(err))
+	}
+}
 
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%v", filepath.Base(file)))
-		w.Header().Set("Content-Type", "application/octet-stream")
+// serveDownload sends the named file as an attachment.
+// Nothing is written to w when an error is returned
+func (h *Handlers) serveDownload(w http.ResponseWriter, r *http.Request, name string) error {
+	file, err := h.root.Resolve(name)
+	if err != nil {
+		h.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("rejected download of %v: %w", name, err),
+		})
+		return err
+	}
 
-		h.logCh <- models.ServerLog{
-			Message: fmt.Sprintf("Downloading %v", file),
-			Type:    models.API_LOG,
-		}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
 
-		http.ServeFile(w, r, file)
-		return
+	if info.IsDir() {
+		return &httpError{status: http.StatusNotFound, err: fmt.Errorf("%v is a directory", name)}
 	}
 
-	http.Error(w, "Failed to download file", http.StatusBadRequest)
-	return
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": path.Base(name),
+	}))
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	h.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("Downloading %v", file),
+	})
+
+	http.ServeFile(w, r, file)
+	return nil
 }
 
 func (h *Handlers) GetFilesHandler(w http.ResponseWriter, r *http.Request) {
-	files := []File{}
-
-	query := r.URL.Query()
+	listing, err := h.listFiles(r, r.URL.Query().Get("dir"), parseListOptions(r.URL.Query()))
+	if err != nil {
+		http.Error(w, "Failed to list files", errorStatus(err))
+		return
+	}
 
-	var fullPath string
-	var currentPath string
+	setPageHeaders(w)
+	tmpl.ExecuteTemplate(w, "index.html", IndexHTML{
+		Files:        listing.Files,
+		CurrentPath:  listing.Path,
+		Sort:         listing.Sort,
+		Order:        listing.Order,
+		Page:         listing.Page,
+		Pages:        listing.Pages(),
+		Total:        listing.Total,
+		ServerConfig: h.indexHTMLConfig(r),
+	})
+}
 
-	if len(query["dir"]) > 0 {
-		currentPath = query["dir"][0]
+// setPageHeaders sets the security headers of the web UI pages
+func setPageHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", pageCSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "same-origin")
+}
 
-		if filepath.Base(currentPath) == ".." {
-			http.Error(w, "Failed to list files", http.StatusInternalServerError)
-			return
+// indexHTMLConfig returns the server settings the listing template
+// uses, limited to what the user of r may do
+func (h *Handlers) indexHTMLConfig(r *http.Request) IndexHTMLConfig {
+	return IndexHTMLConfig{
+		Name:         h.serverConfig.GetName(),
+		AllowUploads: h.serverConfig.GetAllowUploads() && userCan(r, users.PERM_UPLOAD),
+		AllowModify:  h.serverConfig.GetAllowModify() && userCan(r, users.PERM_MODIFY),
+		AllowDelete:  h.serverConfig.GetAllowDelete() && userCan(r, users.PERM_DELETE),
+		LiveUpdates:  h.serverConfig.GetLiveUpdates(),
+		Base:         h.serverConfig.GetBasePath(),
+	}
+}
 
-		}
+// listFiles lists one page of the contents of dir sorted by opts,
+// leaving out what the user of r cannot see
+func (h *Handlers) listFiles(r *http.Request, dir string, opts listOptions) (APIFiles, error) {
+	listing := APIFiles{
+		Path:    "/",
+		Files:   []File{},
+		Sort:    opts.sort,
+		Order:   opts.order,
+		Page:    opts.page,
+		PerPage: opts.perPage,
+	}
 
-		fullPath = filepath.Join(h.dir, currentPath)
+	cleaned, err := fsroot.Clean(dir)
+	if err != nil {
+		return listing, err
+	}
 
-	} else {
-		currentPath = "/"
-		fullPath = h.dir
+	if cleaned != "." {
+		listing.Path = "/" + cleaned
 	}
 
-	h.logCh <- models.ServerLog{
-		Message: fmt.Sprintf("Getting files for %v", fullPath),
-		Type:    models.API_LOG,
+	if err := h.authorizeList(r, listing.Path); err != nil {
+		return listing, err
 	}
 
-	dirFiles, err := os.ReadDir(fullPath)
+	h.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("Getting files for %v", filepath.Join(h.dir, listing.Path)),
+	})
+
+	dirFiles, err := h.root.ReadDir(listing.Path)
 	if err != nil {
-		http.Error(w, "Failed to list files", http.StatusInternalServerError)
-		return
+		return listing, err
 	}
 
+	files := []File{}
+
 	for _, file := range dirFiles {
+		// Uploads in progress are not part of the listing
+		if strings.HasPrefix(file.Name(), uploadTempPrefix) {
+			continue
+		}
 
-		info, err := file.Info()
-		if err != nil {
-			http.Error(w, "Failed to list files", http.StatusInternalServerError)
-			return
+		if !h.serverConfig.GetShowHidden() && isHidden(file.Name()) {
+			continue
 		}
 
-		fmtedFile := File{
-			Name:  file.Name(),
-			IsDir: file.IsDir(),
+		if !h.visible(r, path.Join(listing.Path, file.Name())) {
+			continue
 		}
 
-		if !fmtedFile.IsDir {
-			fmtedFile.Size = utils.FmtBytes(info.Size())
+		// Dangling links and ones the policy rejects are left out
+		fmtedFile, err := h.statFile(path.Join(listing.Path, file.Name()))
+		if errors.Is(err, fs.ErrNotExist) || fsroot.IsDenied(err) {
+			continue
+		}
+		if err != nil {
+			return listing, err
 		}
 
 		files = append(files, fmtedFile)
 	}
 
-	tmpl.ExecuteTemplate(w, "index.html", IndexHTML{
-		Files:       files,
-		CurrentPath: currentPath,
-		ServerConfig: IndexHTMLConfig{
-			Name:         h.serverConfig.GetName(),
-			AllowUploads: h.serverConfig.GetAllowUploads(),
-		},
-	})
+	sortFiles(files, opts)
+
+	listing.Total = len(files)
+	listing.Files = paginate(files, opts)
+
+	return listing, nil
 }
 
-func (h *Handlers) GetAssets(w http.ResponseWriter, r *http.Request) {
-	cwd := getCwd()
+// statFile describes the named file. Stats go through the
+// root so allowed symlinks report their target
+func (h *Handlers) statFile(name string) (File, error) {
+	cleaned, err := fsroot.Clean(name)
+	if err != nil {
+		return File{}, err
+	}
 
-	path := r.URL.Path
-	data, err := os.ReadFile(filepath.Join(cwd, "templates", path))
+	info, err := h.root.Stat(cleaned)
 	if err != nil {
-		fmt.Print(err)
+		return File{}, err
 	}
-	if strings.HasSuffix(path, "js") {
-		w.Header().Set("Content-Type", "text/javascript")
+
+	file := File{
+		Name:    path.Base("/" + cleaned),
+		Path:    path.Join("/", cleaned),
+		IsDir:   info.IsDir(),
+		ModTime: info.ModTime(),
 	}
-	_, err = w.Write(data)
-	if err != nil {
-		fmt.Print(err)
+
+	if !file.IsDir {
+		file.Size = info.Size()
+		file.MimeType = mimeType(file.Name)
+	}
+
+	return file, nil
+}
+
+// mimeType guesses the MIME type of a file from its extension
+func mimeType(name string) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+
+	return "application/octet-stream"
+}
+
+// errorStatus maps errors from handling a request
+// to the HTTP status to respond with
+func errorStatus(err error) int {
+	var httpErr *httpError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.status
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case fsroot.IsDenied(err):
+		return http.StatusForbidden
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
 	}
 }
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+// newTestHandlers serves a temp dir next to a secret file
+// that must never be reachable
+func newTestHandlers(t *testing.T) (*Handlers, string) {
+	t.Helper()
+
+	base := t.TempDir()
+	served := filepath.Join(base, "served")
+
+	// Keep the svault dir used for partial uploads out of the real home
+	t.Setenv("HOME", filepath.Join(base, "home"))
+
+	if err := os.MkdirAll(filepath.Join(served, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(base, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(served, "sub", "file.txt"), []byte("file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus()
+	t.Cleanup(bus.Close)
+
+	h := NewHandlers(
+		bus,
+		served,
+		config.NewServerConfig().SetAllowUploads(true),
+		config.NewNotifConfig(),
+	)
+	t.Cleanup(func() { h.Close() })
+
+	return h, base
+}
+
+func TestDownloadFileHandlerRejectsTraversal(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	tests := []struct {
+		file       string
+		wantStatus int
+	}{
+		{"/sub/file.txt", http.StatusOK},
+		{"sub/../sub/file.txt", http.StatusOK},
+		{"../secret.txt", http.StatusForbidden},
+		{"/../secret.txt", http.StatusForbidden},
+		{"sub/../../secret.txt", http.StatusForbidden},
+		{"a/../../secret.txt", http.StatusForbidden},
+		{"/sub/../../../../secret.txt", http.StatusForbidden},
+		{"/sub", http.StatusNotFound},
+		{"/missing.txt", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/download?file="+url.QueryEscape(tt.file), nil)
+			rec := httptest.NewRecorder()
+
+			h.DownloadFileHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+
+			if strings.Contains(rec.Body.String(), "secret") {
+				t.Fatalf("response leaked the secret file")
+			}
+		})
+	}
+}
+
+func TestDownloadFileHandlerQuotesFilename(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	name := `my "file"; x.txt`
+	if err := os.WriteFile(filepath.Join(base, "served", name), []byte("file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.DownloadFileHandler(rec, httptest.NewRequest(http.MethodGet, "/download?file="+url.QueryEscape("/"+name), nil))
+
+	_, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+	if err != nil || params["filename"] != name {
+		t.Fatalf("Content-Disposition = %q, want filename %q", rec.Header().Get("Content-Disposition"), name)
+	}
+}
+
+func TestGetFilesHandlerRejectsTraversal(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	tests := []struct {
+		dir        string
+		wantStatus int
+	}{
+		{"/", http.StatusOK},
+		{"/sub", http.StatusOK},
+		{"..", http.StatusForbidden},
+		{"/..", http.StatusForbidden},
+		{"sub/../..", http.StatusForbidden},
+		{"a/../../", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?dir="+url.QueryEscape(tt.dir), nil)
+			rec := httptest.NewRecorder()
+
+			h.GetFilesHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+
+			if strings.Contains(rec.Body.String(), "secret.txt") {
+				t.Fatalf("listing leaked the parent dir")
+			}
+		})
+	}
+}
+
+func TestGetFileUploadRejectsTraversal(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	tests := []struct {
+		uploadDir  string
+		wantStatus int
+	}{
+		{"/sub", http.StatusOK},
+		{"..", http.StatusForbidden},
+		{"sub/../..", http.StatusForbidden},
+		{"/../../", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uploadDir, func(t *testing.T) {
+			body := &strings.Builder{}
+			body.WriteString("--boundary\r\n")
+			body.WriteString("Content-Disposition: form-data; name=\"uploadDir\"\r\n\r\n")
+			body.WriteString(tt.uploadDir + "\r\n")
+			body.WriteString("--boundary\r\n")
+			body.WriteString("Content-Disposition: form-data; name=\"file\"; filename=\"planted.txt\"\r\n\r\n")
+			body.WriteString("planted\r\n")
+			body.WriteString("--boundary--\r\n")
+
+			req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body.String()))
+			req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+			rec := httptest.NewRecorder()
+
+			h.GetFileUpload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %v", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			if _, err := os.Stat(filepath.Join(base, "planted.txt")); err == nil {
+				t.Fatalf("upload escaped the served dir")
+			}
+		})
+	}
+}
+
+func TestGetAssetsRejectsTraversal(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	for _, file := range []string{"../index.html", "../../handlers.go"} {
+		req := httptest.NewRequest(http.MethodGet, "/assets/x", nil)
+		req.SetPathValue("file", file)
+		rec := httptest.NewRecorder()
+
+		h.GetAssets(rec, req)
+
+		if rec.Code == http.StatusOK {
+			body, _ := io.ReadAll(rec.Body)
+			t.Fatalf("GetAssets(%q) served %d bytes", file, len(body))
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Listing sort keys
+	SORT_NAME  = "name"
+	SORT_SIZE  = "size"
+	SORT_MTIME = "mtime"
+	SORT_TYPE  = "type"
+
+	// Listing sort orders
+	ORDER_ASC  = "asc"
+	ORDER_DESC = "desc"
+)
+
+const (
+	// Entries per page when the per_page query is absent
+	defaultPageSize = 100
+
+	// Entries per page at most, whatever the per_page query
+	maxPageSize = 1000
+)
+
+// listOptions controls the order and page of a listing
+type listOptions struct {
+	sort    string
+	order   string
+	page    int
+	perPage int
+}
+
+// parseListOptions reads the sort, order, page and per_page
+// queries, falling back to defaults for missing or invalid values
+func parseListOptions(query url.Values) listOptions {
+	opts := listOptions{
+		sort:    SORT_NAME,
+		order:   ORDER_ASC,
+		page:    1,
+		perPage: defaultPageSize,
+	}
+
+	switch s := query.Get("sort"); s {
+	case SORT_SIZE, SORT_MTIME, SORT_TYPE:
+		opts.sort = s
+	}
+
+	if query.Get("order") == ORDER_DESC {
+		opts.order = ORDER_DESC
+	}
+
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		opts.page = page
+	}
+
+	if perPage, err := strconv.Atoi(query.Get("per_page")); err == nil && perPage > 0 {
+		opts.perPage = min(perPage, maxPageSize)
+	}
+
+	return opts
+}
+
+// isHidden reports whether name is a dotfile
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// hasHiddenSegment reports whether the slash separated p
+// is a dotfile or inside a dot directory
+func hasHiddenSegment(p string) bool {
+	for _, segment := range strings.Split(p, "/") {
+		if isHidden(segment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortFiles orders files by opts, keeping directories first
+func sortFiles(files []File, opts listOptions) {
+	less := func(a, b File) bool {
+		switch opts.sort {
+		case SORT_SIZE:
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case SORT_MTIME:
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		case SORT_TYPE:
+			if a.MimeType != b.MimeType {
+				return a.MimeType < b.MimeType
+			}
+		}
+
+		if an, bn := strings.ToLower(a.Name), strings.ToLower(b.Name); an != bn {
+			return an < bn
+		}
+
+		return a.Name < b.Name
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].IsDir != files[j].IsDir {
+			return files[i].IsDir
+		}
+
+		if opts.order == ORDER_DESC {
+			return less(files[j], files[i])
+		}
+
+		return less(files[i], files[j])
+	})
+}
+
+// paginate returns the page of files selected by opts
+func paginate(files []File, opts listOptions) []File {
+	start := (opts.page - 1) * opts.perPage
+	if start >= len(files) {
+		return []File{}
+	}
+
+	return files[start:min(start+opts.perPage, len(files))]
+}
+
+// NextOrder returns the order a click on the column
+// sorted by key should apply
+func (i IndexHTML) NextOrder(key string) string {
+	if i.Sort == key && i.Order == ORDER_ASC {
+		return ORDER_DESC
+	}
+
+	return ORDER_ASC
+}
+
+// SortIndicator returns the arrow shown on the
+// column the listing is sorted by
+func (i IndexHTML) SortIndicator(key string) string {
+	switch {
+	case i.Sort != key:
+		return ""
+	case i.Order == ORDER_DESC:
+		return "▼"
+	default:
+		return "▲"
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+)
+
+// listNames lists the served dir through the API with query
+func listNames(t *testing.T, h *Handlers, query string) (APIFiles, []string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.APIFilesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files?dir=/&"+query, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	listing := APIFiles{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, file := range listing.Files {
+		names = append(names, file.Name)
+	}
+
+	return listing, names
+}
+
+func setupListing(t *testing.T) *Handlers {
+	t.Helper()
+
+	h, base := newTestHandlers(t)
+
+	served := filepath.Join(base, "served")
+	now := time.Now()
+
+	files := []struct {
+		name    string
+		content string
+		age     time.Duration
+	}{
+		{"b.txt", "bb", 3 * time.Hour},
+		{"A.png", "aaaa", 1 * time.Hour},
+		{"c.json", "c", 2 * time.Hour},
+		{".hidden", "hidden", 4 * time.Hour},
+	}
+
+	for _, file := range files {
+		p := filepath.Join(served, file.name)
+		if err := os.WriteFile(p, []byte(file.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		mtime := now.Add(-file.age)
+		os.Chtimes(p, mtime, mtime)
+	}
+
+	return h
+}
+
+func TestListFilesSorting(t *testing.T) {
+	h := setupListing(t)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "sub,.hidden,A.png,b.txt,c.json"},
+		{"sort=name&order=desc", "sub,c.json,b.txt,A.png,.hidden"},
+		{"sort=size", "sub,c.json,b.txt,A.png,.hidden"},
+		{"sort=size&order=desc", "sub,.hidden,A.png,b.txt,c.json"},
+		{"sort=mtime", "sub,.hidden,b.txt,c.json,A.png"},
+		{"sort=type", "sub,c.json,.hidden,A.png,b.txt"},
+		{"sort=bogus&order=bogus", "sub,.hidden,A.png,b.txt,c.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, names := listNames(t, h, tt.query)
+
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Fatalf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListFilesPagination(t *testing.T) {
+	h := setupListing(t)
+
+	listing, names := listNames(t, h, "per_page=2&page=2")
+
+	if strings.Join(names, ",") != "A.png,b.txt" {
+		t.Fatalf("page 2 = %v", names)
+	}
+
+	if listing.Total != 5 || listing.Page != 2 || listing.PerPage != 2 || listing.Pages() != 3 {
+		t.Fatalf("listing = %+v", listing)
+	}
+
+	if _, names := listNames(t, h, "per_page=2&page=9"); len(names) != 0 {
+		t.Fatalf("page past the end = %v", names)
+	}
+
+	if listing, _ := listNames(t, h, "per_page=100000"); listing.PerPage != maxPageSize {
+		t.Fatalf("per_page = %v, want %v", listing.PerPage, maxPageSize)
+	}
+}
+
+func TestListFilesHidesDotfiles(t *testing.T) {
+	h := setupListing(t)
+	h.serverConfig.SetShowHidden(false)
+
+	listing, names := listNames(t, h, "")
+
+	if strings.Join(names, ",") != "sub,A.png,b.txt,c.json" || listing.Total != 4 {
+		t.Fatalf("names = %v, total = %v", names, listing.Total)
+	}
+}
+
+func TestListFilesSkipsDanglingLinks(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	served := filepath.Join(base, "served")
+	if err := os.Symlink(filepath.Join(base, "missing"), filepath.Join(served, "gone")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []string{"follow", "within", "deny"} {
+		t.Run(policy, func(t *testing.T) {
+			linked := NewHandlers(h.bus, served, config.NewServerConfig().SetSymlinkPolicy(policy), config.NewNotifConfig())
+			t.Cleanup(func() { linked.Close() })
+
+			if _, names := listNames(t, linked, ""); strings.Join(names, ",") != "sub" {
+				t.Fatalf("names = %v, want sub", names)
+			}
+		})
+	}
+}
+
+func TestGetFilesHandlerPagination(t *testing.T) {
+	h := setupListing(t)
+
+	rec := httptest.NewRecorder()
+	h.GetFilesHandler(rec, httptest.NewRequest(http.MethodGet, "/?dir=/&sort=size&order=desc&per_page=2", nil))
+
+	body := rec.Body.String()
+
+	if rec.Code != http.StatusOK || !strings.Contains(body, "Page 1 of 3") {
+		t.Fatalf("status = %v: %v", rec.Code, body)
+	}
+
+	// The column sorted ascending by a click is the opposite order
+	if !strings.Contains(body, "sort=size&order=asc") {
+		t.Fatal("size column does not toggle the order")
+	}
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+var errModifyDisabled = &httpError{
+	status: http.StatusForbidden,
+	err:    errors.New("modifying files is not allowed on this server"),
+}
+
+var errDeleteDisabled = &httpError{
+	status: http.StatusForbidden,
+	err:    errors.New("deleting files is not allowed on this server"),
+}
+
+// MkdirRequest is the body of a request creating a directory
+type MkdirRequest struct {
+	// Path of the new directory relative to the served dir
+	Path string `json:"path"`
+}
+
+// RenameRequest is the body of a request renaming a file
+// or directory in place
+type RenameRequest struct {
+	// Path of the file relative to the served dir
+	Path string `json:"path"`
+
+	// The new name, without any directory
+	Name string `json:"name"`
+}
+
+// MoveRequest is the body of a request moving a file
+// or directory into another directory
+type MoveRequest struct {
+	// Path of the file relative to the served dir
+	Path string `json:"path"`
+
+	// Directory to move the file into, relative to the served dir
+	To string `json:"to"`
+}
+
+// DeleteRequest is the body of a request deleting a file
+// or directory with its contents
+type DeleteRequest struct {
+	// Path of the file relative to the served dir
+	Path string `json:"path"`
+}
+
+// decodeJSON reads a small JSON request body into v
+func decodeJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(v); err != nil {
+		return &httpError{status: http.StatusBadRequest, err: err}
+	}
+
+	return nil
+}
+
+// logMutation reports the outcome of a change to the served dir
+func (h *Handlers) logMutation(r *http.Request, err error, format string, args ...any) {
+	action := fmt.Sprintf(format, args...)
+
+	if err != nil {
+		h.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("%v failed for %v: %w", action, r.RemoteAddr, err),
+		})
+		return
+	}
+
+	h.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("%v by %v", action, r.RemoteAddr),
+	})
+}
+
+// APIMkdirHandler creates an empty directory. Allowed when either
+// uploads or modifications are, as folder uploads need it
+func (h *Handlers) APIMkdirHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.serverConfig.GetAllowUploads() && !h.serverConfig.GetAllowModify() {
+		writeJSONError(w, errModifyDisabled, "Failed to create directory")
+		return
+	}
+
+	request := MkdirRequest{}
+	if err := decodeJSON(r, &request); err != nil {
+		writeJSONError(w, err, "Failed to create directory")
+		return
+	}
+
+	dir, err := fsroot.Clean(request.Path)
+	if err == nil && dir == "." {
+		err = &httpError{status: http.StatusBadRequest, err: errors.New("missing directory name")}
+	}
+	if err == nil {
+		err = h.authorizeMkdir(r, dir)
+	}
+	if err == nil {
+		err = h.root.Mkdir(dir, 0o755)
+	}
+	if errors.Is(err, fs.ErrExist) {
+		err = errFileExists(dir)
+	}
+
+	h.logMutation(r, err, "Created directory %v", filepath.Join(h.dir, request.Path))
+
+	if err != nil {
+		writeJSONError(w, err, "Failed to create directory")
+		return
+	}
+
+	file, err := h.statFile(dir)
+	if err != nil {
+		writeJSONError(w, err, "Failed to create directory")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, file)
+}
+
+// authorizeMkdir checks that the user of r may create dir,
+// through a permission the server allows creating it with
+func (h *Handlers) authorizeMkdir(r *http.Request, dir string) error {
+	var err error = errForbidden
+
+	if h.serverConfig.GetAllowUploads() {
+		err = h.authorize(r, users.PERM_UPLOAD, dir)
+	}
+
+	if err != nil && h.serverConfig.GetAllowModify() {
+		err = h.authorize(r, users.PERM_MODIFY, dir)
+	}
+
+	return err
+}
+
+// APIRenameHandler gives a file or directory a new name
+// in the same directory
+func (h *Handlers) APIRenameHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.serverConfig.GetAllowModify() {
+		writeJSONError(w, errModifyDisabled, "Failed to rename")
+		return
+	}
+
+	request := RenameRequest{}
+	if err := decodeJSON(r, &request); err != nil {
+		writeJSONError(w, err, "Failed to rename")
+		return
+	}
+
+	if request.Name == "" || request.Name == "." || request.Name == ".." || strings.ContainsAny(request.Name, `/\`) {
+		writeJSONError(w, &httpError{status: http.StatusBadRequest, err: errors.New("invalid name")}, "Failed to rename")
+		return
+	}
+
+	src, err := fsroot.Clean(request.Path)
+	if err != nil {
+		writeJSONError(w, err, "Failed to rename")
+		return
+	}
+
+	dst := path.Join(path.Dir(src), request.Name)
+
+	err = h.authorize(r, users.PERM_MODIFY, src, dst)
+	if err == nil {
+		err = h.move(src, dst)
+	}
+	h.logMutation(r, err, "Renamed %v to %v", filepath.Join(h.dir, src), request.Name)
+
+	if err != nil {
+		writeJSONError(w, err, "Failed to rename")
+		return
+	}
+
+	h.writeFile(w, dst)
+}
+
+// APIMoveHandler moves a file or directory into another directory
+func (h *Handlers) APIMoveHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.serverConfig.GetAllowModify() {
+		writeJSONError(w, errModifyDisabled, "Failed to move")
+		return
+	}
+
+	request := MoveRequest{}
+	if err := decodeJSON(r, &request); err != nil {
+		writeJSONError(w, err, "Failed to move")
+		return
+	}
+
+	src, err := fsroot.Clean(request.Path)
+	if err != nil {
+		writeJSONError(w, err, "Failed to move")
+		return
+	}
+
+	to, err := fsroot.Clean(request.To)
+	if err != nil {
+		writeJSONError(w, err, "Failed to move")
+		return
+	}
+
+	var info fs.FileInfo
+
+	err = h.authorize(r, users.PERM_MODIFY, src, to)
+	if err == nil {
+		info, err = h.root.Stat(to)
+	}
+	if err == nil && !info.IsDir() {
+		err = &httpError{status: http.StatusBadRequest, err: fmt.Errorf("%v is not a directory", request.To)}
+	}
+
+	// A directory cannot be moved into itself
+	if err == nil && (to == src || strings.HasPrefix(to, src+"/")) {
+		err = &httpError{status: http.StatusBadRequest, err: errors.New("cannot move a directory into itself")}
+	}
+
+	dst := path.Join(to, path.Base(src))
+
+	if err == nil {
+		err = h.move(src, dst)
+	}
+
+	h.logMutation(r, err, "Moved %v to %v", filepath.Join(h.dir, src), filepath.Join(h.dir, to))
+
+	if err != nil {
+		writeJSONError(w, err, "Failed to move")
+		return
+	}
+
+	h.writeFile(w, dst)
+}
+
+// move renames src to dst without replacing anything at dst
+func (h *Handlers) move(src string, dst string) error {
+	if _, err := h.root.Lstat(src); err != nil {
+		return err
+	}
+
+	if src == dst {
+		return nil
+	}
+
+	err := h.root.RenameNoReplace(src, dst)
+	if errors.Is(err, fs.ErrExist) {
+		return errFileExists(dst)
+	}
+
+	return err
+}
+
+// APIDeleteHandler removes a file, or a directory with its contents
+func (h *Handlers) APIDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.serverConfig.GetAllowDelete() {
+		writeJSONError(w, errDeleteDisabled, "Failed to delete")
+		return
+	}
+
+	request := DeleteRequest{}
+	if err := decodeJSON(r, &request); err != nil {
+		writeJSONError(w, err, "Failed to delete")
+		return
+	}
+
+	err := h.authorize(r, users.PERM_DELETE, request.Path)
+	if err == nil {
+		err = h.root.RemoveAll(request.Path)
+	}
+	h.logMutation(r, err, "Deleted %v", filepath.Join(h.dir, request.Path))
+
+	if err != nil {
+		writeJSONError(w, err, "Failed to delete")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeFile responds with the details of the named file
+func (h *Handlers) writeFile(w http.ResponseWriter, name string) {
+	file, err := h.statFile(name)
+	if err != nil {
+		writeJSONError(w, err, "Failed to get file info")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, file)
+}
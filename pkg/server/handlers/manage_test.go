@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/users"
+)
+
+func TestAPIMkdirHandler(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	tests := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"path": "/sub/new"}`, http.StatusCreated},
+		{`{"path": "/sub/new"}`, http.StatusConflict},
+		{`{"path": "/sub/file.txt"}`, http.StatusConflict},
+		{`{"path": "/"}`, http.StatusBadRequest},
+		{`{"path": "../escaped"}`, http.StatusForbidden},
+		{`{"path": "/missing/new"}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.APIMkdirHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/mkdir", strings.NewReader(tt.body)))
+
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%v status = %v, want %v: %v", tt.body, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(base, "served", "sub", "new")); err != nil || !info.IsDir() {
+		t.Fatalf("directory not created: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "escaped")); err == nil {
+		t.Fatal("directory created outside the served dir")
+	}
+
+	h.serverConfig.SetAllowUploads(false)
+
+	rec := httptest.NewRecorder()
+	h.APIMkdirHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/mkdir", strings.NewReader(`{"path": "/other"}`)))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("disabled status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestAPIMkdirHandlerAllowedByModify(t *testing.T) {
+	h, _ := newTestHandlers(t)
+	h.serverConfig.SetAllowUploads(false).SetAllowModify(true)
+
+	rec := httptest.NewRecorder()
+	h.APIMkdirHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/mkdir", strings.NewReader(`{"path": "/other"}`)))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %v, want %v: %v", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	// Uploading is not allowed on this server, nor is modifying for uploaders
+	store := users.NewStore(t.TempDir())
+	if err := store.Add("uploader", "secret", users.ROLE_UPLOADER, "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	registerTestRoutes(mux, h)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/mkdir", strings.NewReader(`{"path": "/uploaded"}`))
+	req.SetBasicAuth("uploader", "secret")
+
+	rec = httptest.NewRecorder()
+	NewAuth(h.bus, store).Middleware(mux).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("uploader status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestAPIRenameHandler(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.APIRenameHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/rename", strings.NewReader(`{"path": "/sub/file.txt", "name": "renamed.txt"}`)))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("disabled status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	h.serverConfig.SetAllowModify(true)
+
+	if err := os.WriteFile(filepath.Join(base, "served", "sub", "taken.txt"), []byte("taken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"path": "/sub/file.txt", "name": "taken.txt"}`, http.StatusConflict},
+		{`{"path": "/sub/file.txt", "name": "../escaped.txt"}`, http.StatusBadRequest},
+		{`{"path": "/sub/file.txt", "name": ".."}`, http.StatusBadRequest},
+		{`{"path": "../secret.txt", "name": "stolen.txt"}`, http.StatusForbidden},
+		{`{"path": "/", "name": "root"}`, http.StatusForbidden},
+		{`{"path": "/sub/missing.txt", "name": "other.txt"}`, http.StatusNotFound},
+		{`{"path": "/sub/file.txt", "name": "renamed.txt"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.APIRenameHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/rename", strings.NewReader(tt.body)))
+
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%v status = %v, want %v: %v", tt.body, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+	}
+
+	got := servedFiles(t, filepath.Join(base, "served", "sub"))
+	if got["renamed.txt"] != "file" || got["taken.txt"] != "taken" || len(got) != 2 {
+		t.Fatalf("files = %v", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "secret.txt")); err != nil {
+		t.Fatal("secret file was moved")
+	}
+}
+
+func TestAPIMoveHandler(t *testing.T) {
+	h, base := newTestHandlers(t)
+	h.serverConfig.SetAllowModify(true)
+
+	served := filepath.Join(base, "served")
+
+	if err := os.MkdirAll(filepath.Join(served, "sub", "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"path": "/sub", "to": "/sub/nested"}`, http.StatusBadRequest},
+		{`{"path": "/sub", "to": "/sub"}`, http.StatusBadRequest},
+		{`{"path": "/sub/file.txt", "to": "/sub/file.txt"}`, http.StatusBadRequest},
+		{`{"path": "/sub/file.txt", "to": "/missing"}`, http.StatusNotFound},
+		{`{"path": "/sub/file.txt", "to": ".."}`, http.StatusForbidden},
+		{`{"path": "/sub/file.txt", "to": "/"}`, http.StatusOK},
+		{`{"path": "/file.txt", "to": "/"}`, http.StatusOK},
+		{`{"path": "/sub/nested", "to": "/"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.APIMoveHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/move", strings.NewReader(tt.body)))
+
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%v status = %v, want %v: %v", tt.body, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+	}
+
+	if got := servedFiles(t, served); got["file.txt"] != "file" {
+		t.Fatalf("files = %v", got)
+	}
+
+	if info, err := os.Stat(filepath.Join(served, "nested")); err != nil || !info.IsDir() {
+		t.Fatalf("directory not moved: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(served, "sub", "file.txt"), []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.APIMoveHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/move", strings.NewReader(`{"path": "/sub/file.txt", "to": "/"}`)))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("existing target status = %v, want %v", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestAPIDeleteHandler(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.APIDeleteHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/delete", strings.NewReader(`{"path": "/sub"}`)))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("disabled status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	h.serverConfig.SetAllowDelete(true)
+
+	tests := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"path": "/"}`, http.StatusForbidden},
+		{`{"path": ".."}`, http.StatusForbidden},
+		{`{"path": "../secret.txt"}`, http.StatusForbidden},
+		{`{"path": "/sub"}`, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.APIDeleteHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/delete", strings.NewReader(tt.body)))
+
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%v status = %v, want %v: %v", tt.body, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "served", "sub")); err == nil {
+		t.Fatal("directory was not deleted")
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "secret.txt")); err != nil {
+		t.Fatal("secret file was deleted")
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Owbird/SVault-Engine/internal/metrics"
+)
+
+// Route label of requests that did not reach a route, such
+// as those refused by the rate limit or authentication
+const UNMATCHED_ROUTE = "unmatched"
+
+// Method label of requests with methods the server doesn't
+// handle, so clients can't add labels at will
+const OTHER_METHOD = "other"
+
+type routeKey struct{}
+
+// Methods labeled as themselves, those of the web UI, API and WebDAV
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+	"PROPPATCH":        true,
+	"MKCOL":            true,
+	"COPY":             true,
+	"MOVE":             true,
+	"LOCK":             true,
+	"UNLOCK":           true,
+}
+
+// methodLabel returns the method label of r
+func methodLabel(r *http.Request) string {
+	if knownMethods[r.Method] {
+		return r.Method
+	}
+
+	return OTHER_METHOD
+}
+
+// Routes sending files, counted while their responses are written
+var downloadRoutes = map[string]bool{
+	"/download":            true,
+	"GET /view":            true,
+	"GET /api/v1/download": true,
+}
+
+// Metrics counts the requests of the server by route and status,
+// the bytes they transfer and the downloads in progress
+type Metrics struct {
+	requests        *metrics.Vec
+	bytesServed     *metrics.Vec
+	bytesUploaded   *metrics.Vec
+	activeDownloads *metrics.Vec
+}
+
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		requests: registry.Counter(
+			"svault_http_requests_total",
+			"Requests handled by route, method and status code.",
+			"route", "method", "code",
+		),
+		bytesServed: registry.Counter(
+			"svault_http_response_bytes_total",
+			"Bytes of response bodies sent by route.",
+			"route",
+		),
+		bytesUploaded: registry.Counter(
+			"svault_http_request_bytes_total",
+			"Bytes of request bodies received by route.",
+			"route",
+		),
+		activeDownloads: registry.Gauge(
+			"svault_active_downloads",
+			"Downloads being sent.",
+		),
+	}
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
+}
+
+// Middleware counts the requests to next once they are handled,
+// under the route set by Route
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := UNMATCHED_ROUTE
+
+		sw := &statusWriter{ResponseWriter: w}
+
+		body := &countingBody{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), routeKey{}, &route)))
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		m.requests.Inc(route, methodLabel(r), strconv.Itoa(status))
+		m.bytesServed.Add(float64(sw.bytes), route)
+		m.bytesUploaded.Add(float64(body.bytes), route)
+	})
+}
+
+// Route labels the requests to next with pattern, the
+// pattern it is registered under
+func (m *Metrics) Route(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*route = pattern
+		}
+
+		// Files read over WebDAV are downloads too
+		if downloadRoutes[pattern] || (pattern == davPrefix+"/" && r.Method == http.MethodGet) {
+			m.activeDownloads.Inc()
+			defer m.activeDownloads.Dec()
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/metrics"
+)
+
+func TestMetricsCountRequestsByRoute(t *testing.T) {
+	m := NewMetrics(metrics.NewRegistry())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/upload", m.Route("POST /api/v1/upload", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	mux.HandleFunc("/download", m.Route("/download", func(w http.ResponseWriter, r *http.Request) {
+		if got := m.activeDownloads.Value(); got != 1 {
+			t.Errorf("active downloads = %v, want 1", got)
+		}
+		w.Write([]byte("content"))
+	}))
+
+	handler := m.Middleware(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v1/upload", strings.NewReader("uploaded")))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/download?file=a", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("RANDOM-1", "/missing", nil))
+
+	if got := m.requests.Value("POST /api/v1/upload", "POST", "201"); got != 1 {
+		t.Errorf("upload requests = %v, want 1", got)
+	}
+
+	if got := m.bytesUploaded.Value("POST /api/v1/upload"); got != 8 {
+		t.Errorf("uploaded bytes = %v, want 8", got)
+	}
+
+	if got := m.bytesServed.Value("/download"); got != 7 {
+		t.Errorf("served bytes = %v, want 7", got)
+	}
+
+	if got := m.activeDownloads.Value(); got != 0 {
+		t.Errorf("active downloads = %v, want 0", got)
+	}
+
+	if got := m.requests.Value(UNMATCHED_ROUTE, "GET", "404"); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+
+	if got := m.requests.Value(UNMATCHED_ROUTE, OTHER_METHOD, "404"); got != 1 {
+		t.Errorf("requests of unknown methods = %v, want 1", got)
+	}
+}
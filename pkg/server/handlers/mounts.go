@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+)
+
+// APIMount describes a directory served under a name
+type APIMount struct {
+	Name string `json:"name"`
+
+	// URL path the mount is served under, e.g. /photos
+	Path string `json:"path"`
+
+	AllowUploads bool `json:"allow_uploads"`
+	AllowModify  bool `json:"allow_modify"`
+	AllowDelete  bool `json:"allow_delete"`
+}
+
+// MountsHTML defines the data passed to the mounts.html
+// template file
+type MountsHTML struct {
+	Mounts       []APIMount
+	ServerConfig IndexHTMLConfig
+}
+
+// MountsHandlers serves the root of a server serving several
+// directories, where each is chosen from
+type MountsHandlers struct {
+	mounts       []APIMount
+	serverConfig *config.ServerConfig
+	urls         *ServerURLs
+}
+
+// NewMountsHandlers lists mounts, which are each served by
+// handlers of their own under their name.
+// The templates are parsed by the first NewHandlers
+func NewMountsHandlers(serverConfig *config.ServerConfig, mounts []*config.MountConfig) *MountsHandlers {
+	apiMounts := []APIMount{}
+	for _, mount := range mounts {
+		apiMounts = append(apiMounts, APIMount{
+			Name:         mount.GetName(),
+			Path:         "/" + mount.GetName(),
+			AllowUploads: mount.GetAllowUploads(),
+			AllowModify:  mount.GetAllowModify(),
+			AllowDelete:  mount.GetAllowDelete(),
+		})
+	}
+
+	return &MountsHandlers{
+		mounts:       apiMounts,
+		serverConfig: serverConfig,
+	}
+}
+
+// visibleMounts returns the mounts the user of r can see
+func (m *MountsHandlers) visibleMounts(r *http.Request) []APIMount {
+	user, ok := requestUser(r)
+	if !ok {
+		return m.mounts
+	}
+
+	mounts := []APIMount{}
+	for _, mount := range m.mounts {
+		if user.CanSee(mount.Path) {
+			mounts = append(mounts, mount)
+		}
+	}
+
+	return mounts
+}
+
+// GetMountsHandler renders the mount chooser
+func (m *MountsHandlers) GetMountsHandler(w http.ResponseWriter, r *http.Request) {
+	setPageHeaders(w)
+	tmpl.ExecuteTemplate(w, "mounts.html", MountsHTML{
+		Mounts: m.visibleMounts(r),
+		ServerConfig: IndexHTMLConfig{
+			Name: m.serverConfig.GetName(),
+		},
+	})
+}
+
+// APIMountsHandler returns the mounts of the server
+func (m *MountsHandlers) APIMountsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, m.visibleMounts(r))
+}
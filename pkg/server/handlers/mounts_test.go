@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+func TestMountHandlers(t *testing.T) {
+	_, base := newTestHandlers(t)
+
+	photos := config.NewMountConfig("photos", filepath.Join(base, "served")).SetAllowUploads(true)
+	docs := config.NewMountConfig("docs", filepath.Join(base, "served", "sub"))
+
+	serverConfig := config.NewServerConfig().SetName("Team")
+
+	h := NewHandlers(events.NewBus(), photos.GetDir(), serverConfig.ForMount(photos), config.NewNotifConfig())
+	t.Cleanup(func() { h.Close() })
+
+	rec := httptest.NewRecorder()
+	h.GetFilesHandler(rec, httptest.NewRequest(http.MethodGet, "/?dir=/", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{`data-base="/photos"`, `href="/photos/?dir=%2fsub"`, `action="/photos/search"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("listing is missing %s", want)
+		}
+	}
+
+	// Directories are previewed through the mount
+	rec = httptest.NewRecorder()
+	h.PreviewFileHandler(rec, httptest.NewRequest(http.MethodGet, "/preview?file=/sub", nil))
+	if got := rec.Header().Get("Location"); got != "/photos/?dir=/sub" {
+		t.Errorf("preview redirect = %v", got)
+	}
+
+	// Partial uploads of mounts are kept apart
+	if !strings.HasSuffix(h.uploads.dir, filepath.Join("uploads", "photos")) {
+		t.Errorf("uploads dir = %v", h.uploads.dir)
+	}
+
+	m := NewMountsHandlers(serverConfig, []*config.MountConfig{photos, docs})
+
+	rec = httptest.NewRecorder()
+	m.GetMountsHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body = rec.Body.String()
+	for _, want := range []string{`href="/photos/"`, `href="/docs/"`, "read only"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("chooser is missing %s", want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	m.APIMountsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/mounts", nil))
+
+	var mounts []APIMount
+	if err := json.NewDecoder(rec.Body).Decode(&mounts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mounts) != 2 || mounts[0].Path != "/photos" || !mounts[0].AllowUploads || mounts[1].AllowUploads {
+		t.Fatalf("mounts = %+v", mounts)
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+const (
+	PREVIEW_IMAGE    = "image"
+	PREVIEW_VIDEO    = "video"
+	PREVIEW_AUDIO    = "audio"
+	PREVIEW_PDF      = "pdf"
+	PREVIEW_MARKDOWN = "markdown"
+	PREVIEW_TEXT     = "text"
+	PREVIEW_NONE     = "none"
+)
+
+// Text files above this size are not rendered in the preview page
+const maxTextPreviewSize = 2 * 1024 * 1024
+
+// textExtensions are source and config files that the system
+// MIME table usually does not know as text
+var textExtensions = map[string]bool{
+	".c": true, ".cc": true, ".cfg": true, ".conf": true, ".cpp": true,
+	".cs": true, ".dart": true, ".env": true, ".go": true, ".h": true,
+	".hpp": true, ".ini": true, ".java": true, ".kt": true, ".log": true,
+	".lua": true, ".mod": true, ".php": true, ".pl": true, ".py": true,
+	".rb": true, ".rs": true, ".scss": true, ".sh": true, ".sql": true,
+	".sum": true, ".swift": true, ".toml": true, ".ts": true, ".tsx": true,
+	".jsx": true, ".yaml": true, ".yml": true, ".zig": true,
+}
+
+// PreviewHTML defines the data passed to the preview.html
+// template file
+type PreviewHTML struct {
+	File         File
+	Dir          string
+	Kind         string
+	Language     string
+	TooLarge     bool
+	ServerConfig IndexHTMLConfig
+}
+
+// ViewFileHandler sends the file in the file query inline so
+// browsers can display it. Range requests are supported for seeking
+func (h *Handlers) ViewFileHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("file")
+
+	if err := h.authorize(r, users.PERM_READ, name); err != nil {
+		http.Error(w, "Failed to view file", errorStatus(err))
+		return
+	}
+
+	file, err := h.root.Open(name)
+	if err != nil {
+		h.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("rejected view of %v: %w", name, err),
+		})
+		http.Error(w, "Failed to view file", errorStatus(err))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Failed to view file", errorStatus(err))
+		return
+	}
+
+	if info.IsDir() {
+		http.Error(w, "Failed to view file", http.StatusNotFound)
+		return
+	}
+
+	base := path.Base(name)
+
+	// The content type is left to ServeContent, which uses the
+	// extension and falls back to sniffing the content
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", base))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// Served files must not run scripts on the server's origin.
+	// Browsers refuse to show PDFs in a sandbox so they are left out
+	if mimeType(base) != "application/pdf" {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+
+	if r.Header.Get("Range") == "" {
+		h.bus.PublishEvent(events.APILog{
+			Message: fmt.Sprintf("Viewing %v", filepath.Join(h.dir, name)),
+		})
+	}
+
+	http.ServeContent(w, r, base, info.ModTime(), file)
+}
+
+// PreviewFileHandler renders a page showing the file
+// in the file query with a viewer matching its type
+func (h *Handlers) PreviewFileHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("file")
+
+	if err := h.authorize(r, users.PERM_READ, name); err != nil {
+		http.Error(w, "Failed to preview file", errorStatus(err))
+		return
+	}
+
+	file, err := h.statFile(name)
+	if err != nil {
+		http.Error(w, "Failed to preview file", errorStatus(err))
+		return
+	}
+
+	if file.IsDir {
+		http.Redirect(w, r, h.serverConfig.GetBasePath()+"/?dir="+file.Path, http.StatusFound)
+		return
+	}
+
+	kind := h.previewKind(file)
+
+	setPageHeaders(w)
+	tmpl.ExecuteTemplate(w, "preview.html", PreviewHTML{
+		File:     file,
+		Dir:      path.Dir(file.Path),
+		Kind:     kind,
+		Language: strings.TrimPrefix(filepath.Ext(file.Name), "."),
+		TooLarge: (kind == PREVIEW_TEXT || kind == PREVIEW_MARKDOWN) && file.Size > maxTextPreviewSize,
+		ServerConfig: IndexHTMLConfig{
+			Name: h.serverConfig.GetName(),
+			Base: h.serverConfig.GetBasePath(),
+		},
+	})
+}
+
+// previewKind picks the viewer for a file from its MIME type,
+// sniffing the content of files with an unknown extension
+func (h *Handlers) previewKind(file File) string {
+	ext := strings.ToLower(filepath.Ext(file.Name))
+
+	switch {
+	case ext == ".md" || ext == ".markdown":
+		return PREVIEW_MARKDOWN
+	case textExtensions[ext]:
+		return PREVIEW_TEXT
+	}
+
+	mimeType := file.MimeType
+	if mimeType == "application/octet-stream" {
+		mimeType = h.sniff(file.Path)
+	}
+
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return PREVIEW_IMAGE
+	case strings.HasPrefix(mimeType, "video/"):
+		return PREVIEW_VIDEO
+	case strings.HasPrefix(mimeType, "audio/"):
+		return PREVIEW_AUDIO
+	case mimeType == "application/pdf":
+		return PREVIEW_PDF
+	case strings.HasPrefix(mimeType, "text/"),
+		strings.HasSuffix(mimeType, "json"),
+		strings.HasSuffix(mimeType, "xml"),
+		strings.HasSuffix(mimeType, "javascript"):
+		return PREVIEW_TEXT
+	default:
+		return PREVIEW_NONE
+	}
+}
+
+// sniff detects the MIME type of the named file from its first bytes
+func (h *Handlers) sniff(name string) string {
+	file, err := h.root.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ""
+	}
+
+	return http.DetectContentType(head[:n])
+}
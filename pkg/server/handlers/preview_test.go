@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestViewFileHandler(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	served := filepath.Join(base, "served")
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	if err := os.WriteFile(filepath.Join(served, "noext"), png, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file            string
+		wantStatus      int
+		wantContentType string
+	}{
+		{"/sub/file.txt", http.StatusOK, "text/plain; charset=utf-8"},
+		{"/noext", http.StatusOK, "image/png"},
+		{"/sub", http.StatusNotFound, ""},
+		{"/missing.txt", http.StatusNotFound, ""},
+		{"../secret.txt", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ViewFileHandler(rec, httptest.NewRequest(http.MethodGet, "/view?file="+url.QueryEscape(tt.file), nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Fatalf("Content-Type = %v, want %v", got, tt.wantContentType)
+			}
+
+			if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "inline") {
+				t.Fatalf("Content-Disposition = %v", got)
+			}
+
+			if rec.Header().Get("Content-Security-Policy") != "sandbox" {
+				t.Fatal("viewed files are not sandboxed")
+			}
+		})
+	}
+}
+
+func TestViewFileHandlerRange(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/view?file=/sub/file.txt", nil)
+	req.Header.Set("Range", "bytes=1-2")
+
+	rec := httptest.NewRecorder()
+	h.ViewFileHandler(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %v, want %v", rec.Code, http.StatusPartialContent)
+	}
+
+	if rec.Body.String() != "il" || rec.Header().Get("Content-Range") != "bytes 1-2/4" {
+		t.Fatalf("body = %q, Content-Range = %v", rec.Body.String(), rec.Header().Get("Content-Range"))
+	}
+}
+
+func TestPreviewKind(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	served := filepath.Join(base, "served")
+
+	files := map[string]string{
+		"photo.png":  "\x89PNG\r\n\x1a\n",
+		"clip.mp4":   "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom",
+		"song.mp3":   "ID3\x03\x00\x00\x00\x00\x00\x00",
+		"doc.pdf":    "%PDF-1.4",
+		"README.md":  "# readme",
+		"main.go":    "package main",
+		"notes":      "plain text without an extension",
+		"blob.bin":   "\x00\x01\x02\x03",
+		"page.html":  "<script>alert(1)</script>",
+		"data.json":  "{}",
+		"config.yml": "a: b",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(served, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"photo.png", PREVIEW_IMAGE},
+		{"clip.mp4", PREVIEW_VIDEO},
+		{"song.mp3", PREVIEW_AUDIO},
+		{"doc.pdf", PREVIEW_PDF},
+		{"README.md", PREVIEW_MARKDOWN},
+		{"main.go", PREVIEW_TEXT},
+		{"notes", PREVIEW_TEXT},
+		{"blob.bin", PREVIEW_NONE},
+		{"page.html", PREVIEW_TEXT},
+		{"data.json", PREVIEW_TEXT},
+		{"config.yml", PREVIEW_TEXT},
+	}
+
+	for _, tt := range tests {
+		file, err := h.statFile(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := h.previewKind(file); got != tt.want {
+			t.Errorf("previewKind(%v) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewFileHandler(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.PreviewFileHandler(rec, httptest.NewRequest(http.MethodGet, "/preview?file=/sub/file.txt", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `id="text-preview"`) {
+		t.Fatalf("status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.PreviewFileHandler(rec, httptest.NewRequest(http.MethodGet, "/preview?file=/sub", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("directory status = %v, want %v", rec.Code, http.StatusFound)
+	}
+
+	rec = httptest.NewRecorder()
+	h.PreviewFileHandler(rec, httptest.NewRequest(http.MethodGet, "/preview?file=../secret.txt", nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("traversal status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+}
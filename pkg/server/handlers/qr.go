@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Owbird/SVault-Engine/pkg/qrcode"
+)
+
+// ServerURLs are the URLs the server logs. Unlike the address
+// a request was made to, such as localhost, phones can open them
+type ServerURLs struct {
+	// The URL on the local network, "" without one
+	Network string
+
+	// Knows the URL of the tunnel while it is up
+	Tunnel *TunnelState
+}
+
+// base returns the URL of the server to share with the client of
+// r. Clients of the tunnel get its URL, others the network one
+func (u *ServerURLs) base(r *http.Request) string {
+	if u != nil {
+		remote := strings.TrimSuffix(u.Tunnel.URL(), "/")
+		if remote != "" && (u.Network == "" || u.Tunnel.forwarded(r) != "") {
+			return remote
+		}
+
+		if u.Network != "" {
+			return u.Network
+		}
+	}
+
+	return requestBase(r)
+}
+
+// requestBase returns the URL of the server as reached by the
+// client of r. Requests through the tunnel come from the local
+// tunnel client, which forwards the scheme of the remote client
+func requestBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// qrPath returns the path and query the QR code of query points
+// to below base: the listing of the dir query, the page of the
+// path query, or the web UI itself
+func qrPath(query url.Values, base string) string {
+	target := &url.URL{Path: base + "/"}
+
+	switch {
+	case query.Get("dir") != "":
+		target.RawQuery = url.Values{"dir": {path.Join("/", query.Get("dir"))}}.Encode()
+	case query.Get("path") != "":
+		target.Path = path.Join("/", base, query.Get("path"))
+	}
+
+	return target.String()
+}
+
+// serveQR writes a PNG of the QR code of the page given by the
+// query below base, for phones to open
+func serveQR(w http.ResponseWriter, r *http.Request, urls *ServerURLs, base string) {
+	png, err := qrcode.PNG(urls.base(r) + qrPath(r.URL.Query(), base))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// SetURLs gives the URLs the QR codes point to
+func (h *Handlers) SetURLs(urls *ServerURLs) {
+	h.urls = urls
+}
+
+// SetURLs gives the URLs the QR codes point to
+func (m *MountsHandlers) SetURLs(urls *ServerURLs) {
+	m.urls = urls
+}
+
+// QRHandler serves the QR code of the web UI, or of the
+// directory given by the dir query or page given by the path query
+func (h *Handlers) QRHandler(w http.ResponseWriter, r *http.Request) {
+	serveQR(w, r, h.urls, h.serverConfig.GetBasePath())
+}
+
+// QRHandler serves the QR code of the mounts page, or of the
+// page given by the path query
+func (m *MountsHandlers) QRHandler(w http.ResponseWriter, r *http.Request) {
+	serveQR(w, r, m.urls, "")
+}
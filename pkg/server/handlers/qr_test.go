@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRequestBase(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		proto      string
+		want       string
+	}{
+		{"192.168.1.5:5000", "", "http://files.local:8080"},
+		{"127.0.0.1:5000", "https", "https://files.local:8080"},
+		// Only the local tunnel client is trusted with the scheme
+		{"192.168.1.5:5000", "https", "http://files.local:8080"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://files.local:8080/qr", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+
+		if got := requestBase(r); got != tt.want {
+			t.Errorf("requestBase from %v with %q = %q, want %q", tt.remoteAddr, tt.proto, got, tt.want)
+		}
+	}
+}
+
+func TestServerURLsBase(t *testing.T) {
+	tunnel := &TunnelState{}
+	urls := &ServerURLs{Network: "http://192.168.1.5:8080", Tunnel: tunnel}
+
+	local := httptest.NewRequest("GET", "http://localhost:8080/qr", nil)
+	local.RemoteAddr = "127.0.0.1:5000"
+
+	tunneled := httptest.NewRequest("GET", "http://localhost:8080/qr", nil)
+	tunneled.RemoteAddr = "127.0.0.1:5000"
+	tunneled.Header.Set("X-Forwarded-For", "203.0.113.1")
+
+	if got := urls.base(local); got != urls.Network {
+		t.Errorf("base on localhost = %q, want %q", got, urls.Network)
+	}
+
+	tunnel.SetUp("https://svault.example.com/", true)
+
+	if got := urls.base(local); got != urls.Network {
+		t.Errorf("base on localhost with the tunnel up = %q, want %q", got, urls.Network)
+	}
+
+	if got := urls.base(tunneled); got != "https://svault.example.com" {
+		t.Errorf("base through the tunnel = %q, want %q", got, "https://svault.example.com")
+	}
+}
+
+func TestQRPath(t *testing.T) {
+	tests := []struct {
+		query string
+		base  string
+		want  string
+	}{
+		{"", "", "/"},
+		{"", "/photos", "/photos/"},
+		{"path=/sub", "/photos", "/photos/sub"},
+		{"dir=/sub", "", "/?dir=%2Fsub"},
+		{"dir=" + url.QueryEscape("/a b&c=d"), "/photos", "/photos/?dir=%2Fa+b%26c%3Dd"},
+		{"dir=../..", "/photos", "/photos/?dir=%2F"},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+
+		if got := qrPath(query, tt.base); got != tt.want {
+			t.Errorf("qrPath(%q, %q) = %q, want %q", tt.query, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestQRHandlerServesPNG(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.QRHandler(rec, httptest.NewRequest("GET", "/qr?path=/sub", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", rec.Code, http.StatusOK)
+	}
+
+	if got := rec.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("content type = %q, want image/png", got)
+	}
+}
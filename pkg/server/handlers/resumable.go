@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+// Sessions without activity for this long are discarded
+const uploadSessionTTL = 24 * time.Hour
+
+// Header carrying the offset a chunk starts at
+const uploadOffsetHeader = "Upload-Offset"
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+var errUploadNotFound = &httpError{
+	status: http.StatusNotFound,
+	err:    errors.New("upload session not found"),
+}
+
+// UploadSession is the state of a resumable upload.
+// The offset is the size of the partial file on disk
+type UploadSession struct {
+	// Identifier used in the session URL
+	ID string `json:"id"`
+
+	// Name of the file being uploaded
+	Name string `json:"name"`
+
+	// Directory the file is saved in, relative to the served dir
+	Dir string `json:"dir"`
+
+	// Path of the file relative to Dir as sent by folder uploads.
+	// Missing directories are created when the upload completes.
+	// Only used when starting a session, Dir and Name hold the result
+	Path string `json:"path,omitempty"`
+
+	// Total size of the file in bytes
+	Size int64 `json:"size"`
+
+	// Bytes received so far
+	Offset int64 `json:"offset"`
+
+	// When the session was created
+	CreatedAt time.Time `json:"created_at"`
+
+	// Name of the user who created the session,
+	// empty when the server has no users
+	User string `json:"user,omitempty"`
+}
+
+// sessionLock serializes the requests of a session, kept
+// while any request holds or waits for it
+type sessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+// resumableUploads keeps the partial uploads under the svault dir
+type resumableUploads struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+func newResumableUploads(dir string) *resumableUploads {
+	return &resumableUploads{
+		dir:   dir,
+		locks: map[string]*sessionLock{},
+	}
+}
+
+// lock serializes the requests of a single session.
+// Malformed ids are not tracked, loading them fails anyway
+func (ru *resumableUploads) lock(id string) func() {
+	if !uploadIDPattern.MatchString(id) {
+		return func() {}
+	}
+
+	ru.mu.Lock()
+	lock, ok := ru.locks[id]
+	if !ok {
+		lock = &sessionLock{}
+		ru.locks[id] = lock
+	}
+	lock.refs++
+	ru.mu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		ru.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(ru.locks, id)
+		}
+		ru.mu.Unlock()
+	}
+}
+
+func (ru *resumableUploads) metaPath(id string) string {
+	return filepath.Join(ru.dir, id+".json")
+}
+
+func (ru *resumableUploads) partPath(id string) string {
+	return filepath.Join(ru.dir, id+".part")
+}
+
+// load reads a session and its current offset
+func (ru *resumableUploads) load(id string) (UploadSession, error) {
+	session := UploadSession{}
+
+	if !uploadIDPattern.MatchString(id) {
+		return session, errUploadNotFound
+	}
+
+	data, err := os.ReadFile(ru.metaPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return session, errUploadNotFound
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err := json.Unmarshal(data, &session); err != nil {
+		return session, err
+	}
+
+	info, err := os.Stat(ru.partPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return session, errUploadNotFound
+	}
+	if err != nil {
+		return session, err
+	}
+
+	session.Offset = info.Size()
+
+	return session, nil
+}
+
+func (ru *resumableUploads) create(session UploadSession) (UploadSession, error) {
+	if err := os.MkdirAll(ru.dir, 0o700); err != nil {
+		return session, err
+	}
+
+	ru.removeStale()
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return session, err
+	}
+
+	session.ID = hex.EncodeToString(id)
+	session.CreatedAt = time.Now()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return session, err
+	}
+
+	part, err := os.OpenFile(ru.partPath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return session, err
+	}
+	part.Close()
+
+	if err := os.WriteFile(ru.metaPath(session.ID), data, 0o600); err != nil {
+		os.Remove(ru.partPath(session.ID))
+		return session, err
+	}
+
+	return session, nil
+}
+
+// remove discards a session, with its lock held
+func (ru *resumableUploads) remove(id string) {
+	os.Remove(ru.partPath(id))
+	os.Remove(ru.metaPath(id))
+}
+
+// removeStale discards sessions whose partial file
+// has not been written to within the TTL
+func (ru *resumableUploads) removeStale() {
+	entries, err := os.ReadDir(ru.dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !uploadIDPattern.MatchString(id) {
+			continue
+		}
+
+		info, err := os.Stat(ru.partPath(id))
+		if err != nil || time.Since(info.ModTime()) > uploadSessionTTL {
+			unlock := ru.lock(id)
+			ru.remove(id)
+			unlock()
+		}
+	}
+}
+
+// APICreateUploadHandler starts a resumable upload from a JSON
+// body with the name, dir and size of the file
+func (h *Handlers) APICreateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.serverConfig.GetAllowUploads() {
+		writeJSONError(w, errUploadsDisabled, "Failed to start upload")
+		return
+	}
+
+	request := UploadSession{}
+	if err := decodeJSON(r, &request); err != nil {
+		writeJSONError(w, err, "Failed to start upload")
+		return
+	}
+
+	session, err := h.newUploadSession(r, request)
+	if err != nil {
+		writeJSONError(w, err, "Failed to start upload")
+		return
+	}
+
+	h.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("Receiving %v (%v bytes) in chunks", path.Join(session.Dir, session.Name), session.Size),
+	})
+
+	writeJSON(w, http.StatusCreated, session)
+}
+
+// newUploadSession validates an upload requested by the user
+// of r and creates its session
+func (h *Handlers) newUploadSession(r *http.Request, request UploadSession) (UploadSession, error) {
+	if request.Size < 0 {
+		return request, &httpError{status: http.StatusBadRequest, err: errors.New("invalid file size")}
+	}
+
+	if maxSize := h.serverConfig.GetMaxUploadSize(); maxSize > 0 && request.Size > maxSize {
+		return request, &http.MaxBytesError{Limit: maxSize}
+	}
+
+	relPath := request.Path
+	if relPath == "" {
+		relPath = path.Base("/" + request.Name)
+	}
+
+	dir, name, err := h.uploadTarget(request.Dir, relPath)
+	if err != nil {
+		return request, err
+	}
+
+	info, err := h.root.Stat(request.Dir)
+	if err != nil {
+		return request, err
+	}
+
+	if !info.IsDir() {
+		return request, &httpError{status: http.StatusBadRequest, err: fmt.Errorf("%v is not a directory", request.Dir)}
+	}
+
+	target := path.Join(dir, name)
+
+	if err := h.authorize(r, users.PERM_UPLOAD, target); err != nil {
+		return request, err
+	}
+
+	if h.serverConfig.GetOverwritePolicy() == config.OVERWRITE_REJECT {
+		if _, err := h.root.Stat(target); err == nil {
+			return request, errFileExists(target)
+		}
+	}
+
+	session := UploadSession{
+		Name: name,
+		Dir:  path.Join("/", dir),
+		Size: request.Size,
+	}
+
+	if user, ok := requestUser(r); ok {
+		session.User = user.Name
+	}
+
+	return h.uploads.create(session)
+}
+
+// APIUploadStatusHandler returns the session with the offset
+// the next chunk has to start at
+func (h *Handlers) APIUploadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	unlock := h.uploads.lock(id)
+	defer unlock()
+
+	session, err := h.uploads.load(id)
+	if err == nil {
+		err = h.authorizeSession(r, session)
+	}
+	if err != nil {
+		writeJSONError(w, err, "Failed to get upload")
+		return
+	}
+
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	writeJSON(w, http.StatusOK, session)
+}
+
+// APIUploadChunkHandler appends the request body to the session.
+// The Upload-Offset header must match the current offset, on a
+// mismatch the client should resume from the returned offset.
+// The file is saved once the last byte is received
+func (h *Handlers) APIUploadChunkHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.serverConfig.GetAllowUploads() {
+		writeJSONError(w, errUploadsDisabled, "Failed to upload chunk")
+		return
+	}
+
+	id := r.PathValue("id")
+
+	unlock := h.uploads.lock(id)
+	defer unlock()
+
+	session, err := h.uploads.load(id)
+	if err == nil {
+		err = h.authorizeSession(r, session)
+	}
+	if err != nil {
+		writeJSONError(w, err, "Failed to upload chunk")
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil {
+		writeJSONError(w, &httpError{status: http.StatusBadRequest, err: fmt.Errorf("invalid %v header", uploadOffsetHeader)}, "Failed to upload chunk")
+		return
+	}
+
+	if offset != session.Offset {
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+		writeJSONError(w, &httpError{status: http.StatusConflict, err: fmt.Errorf("expected offset %v", session.Offset)}, "Failed to upload chunk")
+		return
+	}
+
+	part, err := os.OpenFile(h.uploads.partPath(id), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		writeJSONError(w, err, "Failed to upload chunk")
+		return
+	}
+
+	// Keep whatever arrived even if the connection drops,
+	// the client resumes from the new offset
+	written, copyErr := io.Copy(part, io.LimitReader(r.Body, session.Size-session.Offset))
+	closeErr := part.Close()
+
+	session.Offset += written
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+
+	if copyErr != nil || closeErr != nil {
+		writeJSONError(w, errors.Join(copyErr, closeErr), "Failed to upload chunk")
+		return
+	}
+
+	if session.Offset < session.Size {
+		writeJSON(w, http.StatusOK, session)
+		return
+	}
+
+	file, err := h.completeUpload(session)
+	if err != nil {
+		writeJSONError(w, err, "Failed to save upload")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, file)
+}
+
+// completeUpload moves a finished session into the served dir
+func (h *Handlers) completeUpload(session UploadSession) (File, error) {
+	dir, err := fsroot.Clean(session.Dir)
+	if err != nil {
+		return File{}, err
+	}
+
+	if err := h.root.MkdirAll(dir, 0o755); err != nil {
+		return File{}, err
+	}
+
+	tmpPath, err := h.moveIntoDir(dir, h.uploads.partPath(session.ID))
+	if err != nil {
+		return File{}, err
+	}
+
+	savedPath, err := h.commitUpload(tmpPath, path.Join(dir, session.Name))
+	if err != nil {
+		os.Remove(tmpPath)
+		h.uploads.remove(session.ID)
+		return File{}, err
+	}
+
+	h.uploads.remove(session.ID)
+
+	h.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("File received at %v", filepath.Join(h.dir, savedPath)),
+	})
+
+	h.notifConfig.SendNotification(models.Notification{
+		Title: "File received",
+		Body:  fmt.Sprintf("File %v received", path.Base(savedPath)),
+	})
+
+	return h.statFile(savedPath)
+}
+
+// moveIntoDir moves src into a temp file inside dir, copying
+// when src lives on another file system
+func (h *Handlers) moveIntoDir(dir string, src string) (string, error) {
+	resolvedDir, err := h.root.Resolve(dir)
+	if err != nil {
+		return "", err
+	}
+
+	placeholder, err := os.CreateTemp(resolvedDir, uploadTempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	placeholder.Close()
+
+	if err := os.Rename(src, placeholder.Name()); err == nil {
+		return placeholder.Name(), nil
+	}
+
+	os.Remove(placeholder.Name())
+
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tmpPath, err := h.writeTemp(dir, f)
+	if err != nil {
+		return "", err
+	}
+
+	os.Remove(src)
+
+	return tmpPath, nil
+}
+
+// APICancelUploadHandler discards a resumable upload
+func (h *Handlers) APICancelUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.serverConfig.GetAllowUploads() {
+		writeJSONError(w, errUploadsDisabled, "Failed to cancel upload")
+		return
+	}
+
+	id := r.PathValue("id")
+
+	unlock := h.uploads.lock(id)
+	defer unlock()
+
+	session, err := h.uploads.load(id)
+	if err == nil {
+		err = h.authorizeSession(r, session)
+	}
+	if err != nil {
+		writeJSONError(w, err, "Failed to cancel upload")
+		return
+	}
+
+	h.uploads.remove(id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeSession checks that the user of r created session and
+// may still upload its file, as sessions are only known by their id
+func (h *Handlers) authorizeSession(r *http.Request, session UploadSession) error {
+	if user, ok := requestUser(r); ok && user.Name != session.User {
+		return errForbidden
+	}
+
+	return h.authorize(r, users.PERM_UPLOAD, path.Join(session.Dir, session.Name))
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/users"
+)
+
+func createUploadSession(t *testing.T, h *Handlers, body string) (*httptest.ResponseRecorder, UploadSession) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.APICreateUploadHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/uploads", strings.NewReader(body)))
+
+	session := UploadSession{}
+	if rec.Code == http.StatusCreated {
+		if err := json.Unmarshal(rec.Body.Bytes(), &session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rec, session
+}
+
+func sendUploadChunk(h *Handlers, id string, offset int64, chunk string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/uploads/"+id, strings.NewReader(chunk))
+	req.SetPathValue("id", id)
+	req.Header.Set(uploadOffsetHeader, strconv.FormatInt(offset, 10))
+
+	rec := httptest.NewRecorder()
+	h.APIUploadChunkHandler(rec, req)
+
+	return rec
+}
+
+func TestResumableUpload(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	rec, session := createUploadSession(t, h, `{"name": "resumed.txt", "dir": "/sub", "size": 11}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	if rec := sendUploadChunk(h, session.ID, 0, "hello "); rec.Code != http.StatusOK {
+		t.Fatalf("first chunk status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	// A client retrying a chunk the server already has is told where to resume
+	rec = sendUploadChunk(h, session.ID, 0, "hello ")
+	if rec.Code != http.StatusConflict || rec.Header().Get(uploadOffsetHeader) != "6" {
+		t.Fatalf("stale chunk status = %v offset = %v", rec.Code, rec.Header().Get(uploadOffsetHeader))
+	}
+
+	statusReq := httptest.NewRequest(http.MethodGet, "/api/v1/uploads/"+session.ID, nil)
+	statusReq.SetPathValue("id", session.ID)
+	statusRec := httptest.NewRecorder()
+	h.APIUploadStatusHandler(statusRec, statusReq)
+
+	if statusRec.Header().Get(uploadOffsetHeader) != "6" {
+		t.Fatalf("status offset = %v", statusRec.Header().Get(uploadOffsetHeader))
+	}
+
+	if rec := sendUploadChunk(h, session.ID, 6, "world"); rec.Code != http.StatusCreated {
+		t.Fatalf("last chunk status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(base, "served", "sub", "resumed.txt"))
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("saved file = %q, %v", data, err)
+	}
+
+	if rec := sendUploadChunk(h, session.ID, 11, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("completed session status = %v", rec.Code)
+	}
+
+	leftovers, _ := os.ReadDir(h.uploads.dir)
+	if len(leftovers) != 0 {
+		t.Fatalf("session state left behind: %v", leftovers)
+	}
+}
+
+func TestResumableUploadRejectsBadSessions(t *testing.T) {
+	h, _ := newTestHandlers(t)
+	h.serverConfig.SetMaxUploadSize(100)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"traversal", `{"name": "x.txt", "dir": "../", "size": 1}`, http.StatusForbidden},
+		{"too large", `{"name": "x.txt", "dir": "/", "size": 1000}`, http.StatusRequestEntityTooLarge},
+		{"missing dir", `{"name": "x.txt", "dir": "/missing", "size": 1}`, http.StatusNotFound},
+		{"empty name", `{"name": "", "dir": "/", "size": 1}`, http.StatusBadRequest},
+		{"dot name", `{"name": "..", "dir": "/", "size": 1}`, http.StatusForbidden},
+		{"path traversal", `{"name": "x.txt", "path": "a/../../x.txt", "dir": "/sub", "size": 1}`, http.StatusForbidden},
+		{"bad json", `{`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := createUploadSession(t, h, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %v", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	if rec := sendUploadChunk(h, "../../etc/passwd", 0, "x"); rec.Code != http.StatusNotFound {
+		t.Fatalf("malformed id status = %v", rec.Code)
+	}
+}
+
+func TestResumableUploadCancel(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	_, session := createUploadSession(t, h, `{"name": "cancelled.txt", "dir": "/", "size": 10}`)
+
+	cancel := func() int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/uploads/"+session.ID, nil)
+		req.SetPathValue("id", session.ID)
+		rec := httptest.NewRecorder()
+		h.APICancelUploadHandler(rec, req)
+		return rec.Code
+	}
+
+	h.serverConfig.SetAllowUploads(false)
+
+	if code := cancel(); code != http.StatusForbidden {
+		t.Fatalf("cancel while uploads are not allowed status = %v", code)
+	}
+
+	h.serverConfig.SetAllowUploads(true)
+
+	if code := cancel(); code != http.StatusNoContent {
+		t.Fatalf("cancel status = %v", code)
+	}
+
+	if rec := sendUploadChunk(h, session.ID, 0, "x"); rec.Code != http.StatusNotFound {
+		t.Fatalf("cancelled session status = %v", rec.Code)
+	}
+}
+
+func TestResumableUploadBelongsToItsUser(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	store := users.NewStore(t.TempDir())
+	for _, name := range []string{"alice", "bob"} {
+		if err := store.Add(name, "secret", users.ROLE_UPLOADER, "/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/uploads", h.APICreateUploadHandler)
+	mux.HandleFunc("PATCH /api/v1/uploads/{id}", h.APIUploadChunkHandler)
+	mux.HandleFunc("DELETE /api/v1/uploads/{id}", h.APICancelUploadHandler)
+	handler := NewAuth(h.bus, store).Middleware(mux)
+
+	send := func(user string, method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.SetBasicAuth(user, "secret")
+		req.Header.Set(uploadOffsetHeader, "0")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("alice", http.MethodPost, "/api/v1/uploads", `{"name": "alice.txt", "dir": "/", "size": 5}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	session := UploadSession{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := send("bob", http.MethodPatch, "/api/v1/uploads/"+session.ID, "bob's"); rec.Code != http.StatusForbidden {
+		t.Fatalf("chunk of another user status = %v", rec.Code)
+	}
+
+	if rec := send("bob", http.MethodDelete, "/api/v1/uploads/"+session.ID, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("cancel by another user status = %v", rec.Code)
+	}
+
+	if rec := send("alice", http.MethodPatch, "/api/v1/uploads/"+session.ID, "hello"); rec.Code != http.StatusCreated {
+		t.Fatalf("chunk status = %v: %v", rec.Code, rec.Body.String())
+	}
+}
+
+func TestResumableUploadLocksOutliveRemove(t *testing.T) {
+	ru := newResumableUploads(t.TempDir())
+	id := strings.Repeat("a", 32)
+
+	unlock := ru.lock(id)
+
+	done := make(chan struct{})
+	go func() {
+		ru.lock(id)()
+		close(done)
+	}()
+
+	// Wait for the second request to queue on the lock
+	for waiting := false; !waiting; {
+		ru.mu.Lock()
+		waiting = ru.locks[id].refs == 2
+		ru.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	ru.remove(id)
+
+	ru.mu.Lock()
+	_, kept := ru.locks[id]
+	ru.mu.Unlock()
+
+	if !kept {
+		t.Fatal("lock removed while a request waits on it")
+	}
+
+	unlock()
+	<-done
+
+	if len(ru.locks) != 0 {
+		t.Errorf("locks = %v, want none once released", ru.locks)
+	}
+}
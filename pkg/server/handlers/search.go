@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/search"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+const (
+	// Results returned when the limit query is absent
+	defaultSearchLimit = 200
+
+	// Results returned at most, whatever the limit query
+	maxSearchLimit = 1000
+)
+
+// APISearchResults is the body returned by a search
+type APISearchResults struct {
+	// The search query
+	Query string `json:"query"`
+
+	// The directory searched, relative to the served dir
+	Path string `json:"path"`
+
+	// Whether the results came from the background index
+	Indexed bool `json:"indexed"`
+
+	Files []File `json:"files"`
+}
+
+// SearchHandler renders the files matching the q query
+// below the dir query
+func (h *Handlers) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	results, err := h.search(r)
+	if err != nil {
+		http.Error(w, "Failed to search files", errorStatus(err))
+		return
+	}
+
+	setPageHeaders(w)
+	tmpl.ExecuteTemplate(w, "index.html", IndexHTML{
+		Files:        results.Files,
+		CurrentPath:  results.Path,
+		Query:        results.Query,
+		ServerConfig: h.indexHTMLConfig(r),
+	})
+}
+
+// APISearchHandler returns the files matching the q query
+// below the dir query
+func (h *Handlers) APISearchHandler(w http.ResponseWriter, r *http.Request) {
+	results, err := h.search(r)
+	if err != nil {
+		writeJSONError(w, err, "Failed to search files")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// search matches file names recursively, from the index
+// when it is built and by walking the tree otherwise
+func (h *Handlers) search(r *http.Request) (APISearchResults, error) {
+	query := r.URL.Query()
+
+	dir, err := fsroot.Clean(query.Get("dir"))
+	if err != nil {
+		return APISearchResults{}, err
+	}
+	dir = path.Join("/", dir)
+
+	q, err := search.ParseQuery(query.Get("q"))
+	if err != nil {
+		return APISearchResults{}, &httpError{status: http.StatusBadRequest, err: err}
+	}
+
+	limit := defaultSearchLimit
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxSearchLimit)
+	}
+
+	// The scope must itself be reachable under the symlink policy
+	if info, err := h.root.Stat(dir); err != nil {
+		return APISearchResults{}, err
+	} else if !info.IsDir() {
+		return APISearchResults{}, &httpError{status: http.StatusBadRequest, err: errors.New("dir is not a directory")}
+	}
+
+	if err := h.authorizeList(r, dir); err != nil {
+		return APISearchResults{}, err
+	}
+
+	results := APISearchResults{
+		Query:   query.Get("q"),
+		Path:    dir,
+		Indexed: h.index != nil && h.index.Ready(),
+		Files:   []File{},
+	}
+
+	// Filtered while searching so they don't count toward the limit
+	keep := func(p string) bool {
+		if strings.HasPrefix(path.Base(p), uploadTempPrefix) {
+			return false
+		}
+
+		if !h.serverConfig.GetShowHidden() && hasHiddenSegment(p) {
+			return false
+		}
+
+		if !h.visible(r, p) {
+			return false
+		}
+
+		// Paths behind symlinks the policy rejects are left out
+		_, err := h.statFile(p)
+		return err == nil
+	}
+
+	var paths []string
+	if results.Indexed {
+		paths = h.index.Search(dir, q, limit, keep)
+	} else {
+		paths, err = search.Walk(h.root.RealName(), dir, q, limit, keep)
+		if err != nil {
+			return APISearchResults{}, err
+		}
+	}
+
+	h.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("Searching %v for %q", dir, results.Query),
+	})
+
+	for _, p := range paths {
+		file, err := h.statFile(p)
+		if err != nil {
+			continue
+		}
+
+		results.Files = append(results.Files, file)
+	}
+
+	return results, nil
+}
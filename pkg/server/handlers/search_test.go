@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+)
+
+func TestAPISearchHandler(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	served := filepath.Join(base, "served")
+
+	h.serverConfig.SetShowHidden(false)
+
+	if err := os.Mkdir(filepath.Join(served, ".hidden"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hidden and temp files sort first and must not use up the limit
+	for _, name := range []string{"sub/other.txt", "photo.jpg", "sub/photo.JPG", ".hidden/photo.jpg", ".photo.jpg", uploadTempPrefix + "photo.jpg"} {
+		if err := os.WriteFile(filepath.Join(served, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A link out of the served dir must not show up in results
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(served, "secret-link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantPaths  []string
+	}{
+		{"q=file", http.StatusOK, []string{"/sub/file.txt"}},
+		{"q=*.txt", http.StatusOK, []string{"/sub/file.txt", "/sub/other.txt"}},
+		{"q=photo&dir=/sub", http.StatusOK, []string{"/sub/photo.JPG"}},
+		{"q=photo&limit=1", http.StatusOK, []string{"/photo.jpg"}},
+		{"q=secret", http.StatusOK, []string{}},
+		{"q=", http.StatusBadRequest, nil},
+		{"q=[a", http.StatusBadRequest, nil},
+		{"q=secret&dir=..", http.StatusForbidden, nil},
+		{"q=x&dir=/missing", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.APISearchHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %v", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			results := APISearchResults{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+				t.Fatal(err)
+			}
+
+			paths := []string{}
+			for _, file := range results.Files {
+				paths = append(paths, file.Path)
+			}
+
+			if len(paths) != len(tt.wantPaths) {
+				t.Fatalf("paths = %v, want %v", paths, tt.wantPaths)
+			}
+
+			for i := range paths {
+				if paths[i] != tt.wantPaths[i] {
+					t.Fatalf("paths = %v, want %v", paths, tt.wantPaths)
+				}
+			}
+		})
+	}
+}
+
+func TestAPISearchHandlerFollowsLinkedRoot(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(filepath.Join(base, "served"), link); err != nil {
+		t.Fatal(err)
+	}
+
+	linked := NewHandlers(h.bus, link, config.NewServerConfig(), config.NewNotifConfig())
+	t.Cleanup(func() { linked.Close() })
+
+	rec := httptest.NewRecorder()
+	linked.APISearchHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?q=file", nil))
+
+	results := APISearchResults{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results.Files) != 1 || results.Files[0].Path != "/sub/file.txt" {
+		t.Errorf("files = %v, want /sub/file.txt", results.Files)
+	}
+}
@@ -1,23 +1,493 @@
+// URL path of the mount being shown, "" when a single dir is served
+const BASE = document.body.dataset.base ?? "";
+
+// Names are set as text, they may contain markup
+const breadcrumbLink = (href, text) => {
+  const link = document.createElement("a");
+  link.href = href;
+  link.className = "text-teal-600 hover:underline";
+  link.textContent = text;
+  return link;
+};
+
 const cookBreadCrumbs = (path, container) => {
   const segments = path.split("/").filter(Boolean);
 
   const breadcrumbItems = segments.map((segment, index) => {
     const isLast = index === segments.length - 1;
-    const url = "?dir=/" + segments.slice(0, index + 1).join("/");
-    return isLast
-      ? `<span class="text-gray-500">${segment}</span>`
-      : `<a href="${url}" class="text-teal-600 hover:underline">${segment}</a>`;
+    const dir = "/" + segments.slice(0, index + 1).join("/");
+
+    if (!isLast) {
+      return breadcrumbLink(`${BASE}/?dir=${encodeURIComponent(dir)}`, segment);
+    }
+
+    const current = document.createElement("span");
+    current.className = "text-gray-500";
+    current.textContent = segment;
+    return current;
+  });
+
+  // Mounts are listed at the root of the server
+  if (BASE) {
+    breadcrumbItems.unshift(breadcrumbLink(`${BASE}/`, BASE.slice(1)));
+  }
+
+  const list = document.createElement("ol");
+  list.className = "flex space-x-2 text-sm";
+
+  const home = document.createElement("li");
+  home.append(breadcrumbLink("/", "Home"));
+  list.append(home);
+
+  for (const item of breadcrumbItems) {
+    const li = document.createElement("li");
+    li.append("/ ", item);
+    list.append(li);
+  }
+
+  container.replaceChildren(list);
+};
+
+// Size of each chunk sent to the resumable upload API
+const UPLOAD_CHUNK_SIZE = 2 * 1024 * 1024;
+
+// Attempts made for a chunk before giving up on the upload
+const UPLOAD_MAX_RETRIES = 8;
+
+const sleep = (ms) => new Promise((resolve) => setTimeout(resolve, ms));
+
+// The session of an interrupted upload is kept so a later
+// attempt of the same file continues where it stopped
+const uploadSessionKey = (file, dir, relPath) =>
+  `svault-upload:${dir}:${relPath}:${file.size}:${file.lastModified}`;
+
+const apiError = async (res) => {
+  try {
+    const body = await res.json();
+    return new Error(body.error);
+  } catch {
+    return new Error(res.statusText);
+  }
+};
+
+const getUploadSession = async (file, dir, relPath) => {
+  const key = uploadSessionKey(file, dir, relPath);
+  const savedId = localStorage.getItem(key);
+
+  if (savedId) {
+    const res = await fetch(`${BASE}/api/v1/uploads/${savedId}`);
+    if (res.ok) {
+      return res.json();
+    }
+
+    localStorage.removeItem(key);
+  }
+
+  const res = await fetch(`${BASE}/api/v1/uploads`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({
+      name: file.name,
+      path: relPath,
+      dir,
+      size: file.size,
+    }),
+  });
+
+  if (!res.ok) {
+    throw await apiError(res);
+  }
+
+  const session = await res.json();
+  localStorage.setItem(key, session.id);
+
+  return session;
+};
+
+// sendChunk resolves with the response status, the offset
+// reported by the server and the parsed body
+const sendChunk = (id, offset, chunk, onProgress) =>
+  new Promise((resolve, reject) => {
+    const xhr = new XMLHttpRequest();
+
+    xhr.upload.addEventListener("progress", (event) => {
+      onProgress(offset + event.loaded);
+    });
+
+    xhr.addEventListener("load", () => {
+      let body = {};
+      try {
+        body = JSON.parse(xhr.responseText);
+      } catch {}
+
+      resolve({
+        status: xhr.status,
+        offset: Number(xhr.getResponseHeader("Upload-Offset") ?? offset),
+        body,
+      });
+    });
+
+    xhr.addEventListener("error", () => reject(new Error("Network error")));
+    xhr.addEventListener("timeout", () => reject(new Error("Timed out")));
+
+    xhr.open("PATCH", `${BASE}/api/v1/uploads/${id}`, true);
+    xhr.setRequestHeader("Upload-Offset", offset);
+    xhr.setRequestHeader("Content-Type", "application/offset+octet-stream");
+    xhr.send(chunk);
+  });
+
+// uploadResumable sends a file in chunks, resuming from the
+// offset the server has after network failures. relPath is the
+// path of the file inside dir, keeping the layout of folder uploads
+const uploadResumable = async (file, dir, relPath, onProgress) => {
+  const key = uploadSessionKey(file, dir, relPath);
+  const session = await getUploadSession(file, dir, relPath);
+
+  let offset = session.offset;
+  let retries = 0;
+
+  while (true) {
+    const chunk = file.slice(offset, offset + UPLOAD_CHUNK_SIZE);
+
+    try {
+      const res = await sendChunk(session.id, offset, chunk, onProgress);
+
+      if (res.status === 201) {
+        localStorage.removeItem(key);
+        return res.body;
+      }
+
+      if (res.status === 200 || res.status === 409) {
+        offset = res.offset;
+        retries = 0;
+        continue;
+      }
+
+      if (res.status < 500) {
+        localStorage.removeItem(key);
+        throw new Error(res.body.error ?? `Upload failed (${res.status})`);
+      }
+    } catch (err) {
+      if (err.message !== "Network error" && err.message !== "Timed out") {
+        throw err;
+      }
+    }
+
+    if (++retries > UPLOAD_MAX_RETRIES) {
+      throw new Error("Upload interrupted, retry to resume");
+    }
+
+    await sleep(Math.min(1000 * 2 ** retries, 30000));
+
+    // Ask where the server stopped before sending again
+    const res = await fetch(`${BASE}/api/v1/uploads/${session.id}`).catch(() => null);
+    if (res && res.ok) {
+      offset = (await res.json()).offset;
+    }
+  }
+};
+
+const joinPath = (...parts) =>
+  "/" + parts.join("/").split("/").filter(Boolean).join("/");
+
+const createDir = async (path) => {
+  const res = await fetch(`${BASE}/api/v1/mkdir`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ path }),
+  });
+
+  // An existing directory is fine when recreating a folder layout
+  if (!res.ok && res.status !== 409) {
+    throw await apiError(res);
+  }
+};
+
+// readAllEntries returns every entry of a dropped directory,
+// browsers hand them out in batches
+const readAllEntries = (reader) =>
+  new Promise((resolve, reject) => {
+    const entries = [];
+
+    const readBatch = () =>
+      reader.readEntries((batch) => {
+        if (batch.length === 0) {
+          resolve(entries);
+          return;
+        }
+
+        entries.push(...batch);
+        readBatch();
+      }, reject);
+
+    readBatch();
+  });
+
+// collectEntry walks a dropped file or directory, adding files
+// with their relative path to items and empty directories to dirs
+const collectEntry = async (entry, items, dirs) => {
+  const relPath = entry.fullPath.replace(/^\//, "");
+
+  if (entry.isFile) {
+    const file = await new Promise((resolve, reject) =>
+      entry.file(resolve, reject),
+    );
+    items.push({ file, path: relPath });
+    return;
+  }
+
+  const children = await readAllEntries(entry.createReader());
+  if (children.length === 0) {
+    dirs.push(relPath);
+  }
+
+  for (const child of children) {
+    await collectEntry(child, items, dirs);
+  }
+};
+
+const setupSelection = () => {
+  const selectAll = document.getElementById("select-all");
+  const selectionBar = document.getElementById("selection-bar");
+  const selectionCount = document.getElementById("selection-count");
+  // Rows come and go with live updates, so they are looked up each time
+  const checkboxes = () => [...document.querySelectorAll(".select-file")];
+
+  const selected = () => checkboxes().filter((checkbox) => checkbox.checked);
+
+  const updateSelectionBar = () => {
+    const total = selected().length;
+
+    selectionBar.classList.toggle("hidden", total === 0);
+    selectionCount.textContent = `${total} item${total > 1 ? "s" : ""} selected`;
+    selectAll.checked = total > 0 && total === checkboxes().length;
+  };
+
+  selectAll.addEventListener("change", () => {
+    checkboxes().forEach((checkbox) => (checkbox.checked = selectAll.checked));
+    updateSelectionBar();
+  });
+
+  document.getElementById("files").addEventListener("change", (event) => {
+    if (event.target.classList.contains("select-file")) {
+      updateSelectionBar();
+    }
+  });
+
+  document.addEventListener("selection-changed", updateSelectionBar);
+
+  document.querySelectorAll(".download-selected").forEach((button) =>
+    button.addEventListener("click", () => {
+      const params = new URLSearchParams();
+
+      selected().forEach((checkbox) => params.append("file", checkbox.value));
+      params.append("format", button.dataset.format);
+
+      window.location.href = `${BASE}/download?${params}`;
+    }),
+  );
+};
+
+const postJSON = async (url, body) => {
+  const res = await fetch(url, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
   });
 
-  container.innerHTML = `
-          <ol class="flex space-x-2 text-sm">
-            <li><a href="/" class="text-teal-600 hover:underline">Home</a></li>
-            ${breadcrumbItems.map((item) => `<li>/ ${item}</li>`).join("")}
-          </ol>
-        `;
+  if (!res.ok) {
+    throw await apiError(res);
+  }
+};
+
+// Runs each change in turn, stopping at the first failure,
+// and reloads the listing once done
+const applyChanges = async (paths, change) => {
+  try {
+    for (const path of paths) {
+      await change(path);
+    }
+  } catch (err) {
+    alert(err.message);
+  }
+
+  window.location.reload();
+};
+
+const renameFile = (path, name) => {
+  const newName = prompt(`Rename ${name} to:`, name);
+  if (!newName || newName === name) return;
+
+  applyChanges([path], (path) =>
+    postJSON(`${BASE}/api/v1/rename`, { path, name: newName }),
+  );
+};
+
+const moveFiles = (paths, currentPath) => {
+  const to = prompt("Move to directory:", currentPath || "/");
+  if (!to) return;
+
+  applyChanges(paths, (path) => postJSON(`${BASE}/api/v1/move`, { path, to }));
+};
+
+const deleteFiles = (paths) => {
+  const what = paths.length > 1 ? `${paths.length} items` : paths[0];
+  if (!confirm(`Delete ${what}? This cannot be undone.`)) return;
+
+  applyChanges(paths, (path) => postJSON(`${BASE}/api/v1/delete`, { path }));
+};
+
+const setupManagement = () => {
+  const table = document.getElementById("files");
+  const currentPath = table.dataset.currentPath;
+
+  const selectedPaths = () =>
+    [...document.querySelectorAll(".select-file:checked")].map(
+      (checkbox) => checkbox.value,
+    );
+
+  table.addEventListener("click", (event) => {
+    const button = event.target.closest("button");
+    if (!button) return;
+
+    const { path, name } = button.parentElement.dataset;
+
+    if (button.classList.contains("rename-file")) {
+      renameFile(path, name);
+    } else if (button.classList.contains("move-file")) {
+      moveFiles([path], currentPath);
+    } else if (button.classList.contains("delete-file")) {
+      deleteFiles([path]);
+    }
+  });
+
+  document
+    .getElementById("move-selected")
+    ?.addEventListener("click", () => moveFiles(selectedPaths(), currentPath));
+
+  document
+    .getElementById("delete-selected")
+    ?.addEventListener("click", () => deleteFiles(selectedPaths()));
+};
+
+// Images the server cannot thumbnail fall back to the file icon
+const thumbnailFallback = (img) =>
+  img.addEventListener("error", () => {
+    const icon = document.createElement("i");
+    icon.className = "icon icon-file text-cyan-700 text-6xl";
+    img.replaceWith(icon);
+  });
+
+// Switches between the table and the thumbnail grid,
+// remembering the choice across pages
+const setupViewToggle = () => {
+  const table = document.getElementById("files");
+  const grid = document.getElementById("grid-view");
+  const buttons = document.querySelectorAll(".view-toggle");
+
+  const showView = (view) => {
+    table.classList.toggle("hidden", view === "grid");
+    grid.classList.toggle("hidden", view !== "grid");
+    buttons.forEach((button) =>
+      button.classList.toggle("bg-gray-300", button.dataset.view === view),
+    );
+    localStorage.setItem("svault-view", view);
+  };
+
+  buttons.forEach((button) =>
+    button.addEventListener("click", () => showView(button.dataset.view)),
+  );
+
+  grid.querySelectorAll("img").forEach(thumbnailFallback);
+
+  showView(localStorage.getItem("svault-view") ?? "list");
+};
+
+// Parses the HTML of a single element
+const fromHTML = (html) => {
+  const template = document.createElement("template");
+  template.innerHTML = html.trim();
+  return template.content.firstElementChild;
+};
+
+// Keeps the listing in step with changes made to the
+// directory by anyone while the page is open
+const setupLiveUpdates = () => {
+  const table = document.getElementById("files");
+  if (table.dataset.liveUpdates !== "true") return;
+
+  const tbody = table.querySelector("tbody");
+  const grid = document.getElementById("grid-view");
+  const dir = table.dataset.currentPath;
+
+  const find = (parent, path) =>
+    [...parent.children].find((el) => el.dataset.path === path);
+
+  // New entries are placed after the entry they follow by name,
+  // directories first, like the listing of an unsorted page
+  const insert = (parent, el, file) => {
+    const after = [...parent.children].find((other) => {
+      const isDir = other.dataset.dir === "true";
+      if (isDir !== file.is_dir) return file.is_dir;
+
+      return other.dataset.name.localeCompare(file.name) > 0;
+    });
+
+    parent.insertBefore(el, after ?? null);
+  };
+
+  const upsert = (parent, html, event) => {
+    const el = fromHTML(html);
+    el.querySelectorAll("img").forEach(thumbnailFallback);
+
+    const existing = find(parent, event.path);
+    if (existing) {
+      // Keep the selection of rows updated in place
+      const checked = existing.querySelector(".select-file")?.checked;
+      const checkbox = el.querySelector(".select-file");
+      if (checkbox && checked) checkbox.checked = true;
+
+      existing.replaceWith(el);
+    } else {
+      insert(parent, el, event.file);
+    }
+  };
+
+  const remove = (path) => {
+    find(tbody, path)?.remove();
+    find(grid, path)?.remove();
+  };
+
+  const source = new EventSource(`${BASE}/events?${new URLSearchParams({ dir })}`);
+
+  source.addEventListener("message", (message) => {
+    const event = JSON.parse(message.data);
+
+    switch (event.op) {
+      case "create":
+      case "write":
+        upsert(tbody, event.row, event);
+        upsert(grid, event.card, event);
+        break;
+      case "remove":
+      case "rename":
+        remove(event.path);
+        break;
+      case "resync":
+        window.location.reload();
+        return;
+    }
+
+    document.dispatchEvent(new Event("selection-changed"));
+  });
 };
 
 document.addEventListener("DOMContentLoaded", () => {
+  setupSelection();
+  setupManagement();
+  setupViewToggle();
+  setupLiveUpdates();
+
   const dropArea = document.getElementById("drop-area");
   const fileInput = document.getElementById("file-upload");
   const uploadButton = document.getElementById("upload-button");
@@ -30,53 +500,57 @@ document.addEventListener("DOMContentLoaded", () => {
 
   cookBreadCrumbs(uploadDir, breadcrumbsContainer);
 
-  let files;
+  if (!dropArea) {
+    return;
+  }
 
-  const updateUploadBtnLabel = (total) => {
-    if (total > 0) {
-      uploadButton.innerText = `Upload ${total} file${total > 1 ? "s" : ""}`;
-      uploadButton.classList.remove("hidden");
-    }
-  };
+  const folderInput = document.getElementById("folder-upload");
+  const newFolderButton = document.getElementById("new-folder-button");
+
+  // Files to upload with their path relative to the upload dir,
+  // and empty directories of dropped folders
+  let pending = { items: [], dirs: [] };
 
-  const uploadFiles = async (files) => {
-    const formData = new FormData();
+  const setPending = (items, dirs = []) => {
+    pending = { items, dirs };
 
-    for (let file of files) {
-      formData.append("file", file);
+    const total = items.length;
+    if (total > 0 || dirs.length > 0) {
+      uploadButton.innerText = `Upload ${total} file${total === 1 ? "" : "s"}`;
+      uploadButton.classList.remove("hidden");
     }
+  };
 
-    formData.append("uploadDir", uploadDir);
+  const fromFileList = (files) =>
+    [...files].map((file) => ({
+      file,
+      path: file.webkitRelativePath || file.name,
+    }));
 
-    return new Promise((resolve, reject) => {
-      const xhr = new XMLHttpRequest();
+  const uploadFiles = async ({ items, dirs }) => {
+    const totalBytes = items.reduce((total, item) => total + item.file.size, 0);
+    let doneBytes = 0;
 
-      xhr.upload.addEventListener("progress", (event) => {
-        if (event.lengthComputable) {
-          const percentComplete = (event.loaded / event.total) * 100;
-          uploadStatus.textContent = `Uploading: ${percentComplete.toFixed(2)}%`;
-        }
-      });
+    try {
+      for (const dir of dirs) {
+        await createDir(joinPath(uploadDir, dir));
+      }
 
-      xhr.addEventListener("load", () => {
-        if (xhr.status === 200) {
-          uploadStatus.textContent = "Upload complete!";
-          window.location.reload();
-          resolve();
-        } else {
-          uploadStatus.textContent = "Error uploading files.";
-          reject(new Error("Upload failed"));
-        }
-      });
+      for (const { file, path } of items) {
+        await uploadResumable(file, uploadDir, path, (sent) => {
+          const percentComplete =
+            totalBytes > 0 ? ((doneBytes + sent) / totalBytes) * 100 : 100;
+          uploadStatus.textContent = `Uploading ${path}: ${percentComplete.toFixed(2)}%`;
+        });
 
-      xhr.addEventListener("error", () => {
-        uploadStatus.textContent = "Network error during upload.";
-        reject(new Error("Network error"));
-      });
+        doneBytes += file.size;
+      }
 
-      xhr.open("POST", "/upload", true);
-      xhr.send(formData);
-    });
+      uploadStatus.textContent = "Upload complete!";
+      window.location.reload();
+    } catch (err) {
+      uploadStatus.textContent = `Error uploading files: ${err.message}`;
+    }
   };
 
   dropArea.addEventListener("dragover", (e) => {
@@ -88,21 +562,55 @@ document.addEventListener("DOMContentLoaded", () => {
     dropArea.classList.remove("bg-teal-100");
   });
 
-  dropArea.addEventListener("drop", (e) => {
+  dropArea.addEventListener("drop", async (e) => {
     e.preventDefault();
     dropArea.classList.remove("bg-teal-100");
-    files = e.dataTransfer.files;
-    updateUploadBtnLabel(files.length);
+
+    // Entries have to be taken before the handler yields
+    const entries = [...e.dataTransfer.items]
+      .map((item) => item.webkitGetAsEntry?.())
+      .filter(Boolean);
+
+    if (entries.length === 0) {
+      setPending(fromFileList(e.dataTransfer.files));
+      return;
+    }
+
+    const items = [];
+    const dirs = [];
+
+    for (const entry of entries) {
+      await collectEntry(entry, items, dirs);
+    }
+
+    setPending(items, dirs);
   });
 
   fileInput.addEventListener("change", () => {
-    files = fileInput.files;
-    updateUploadBtnLabel(files.length);
+    setPending(fromFileList(fileInput.files));
+  });
+
+  folderInput.addEventListener("change", () => {
+    setPending(fromFileList(folderInput.files));
   });
 
   uploadButton.addEventListener("click", () => {
-    if (files && files.length > 0) {
-      uploadFiles(files);
+    if (pending.items.length > 0 || pending.dirs.length > 0) {
+      uploadFiles(pending);
+    }
+  });
+
+  newFolderButton.addEventListener("click", async () => {
+    const name = prompt("Folder name");
+    if (!name) {
+      return;
+    }
+
+    try {
+      await createDir(joinPath(uploadDir, name));
+      window.location.reload();
+    } catch (err) {
+      uploadStatus.textContent = `Error creating folder: ${err.message}`;
     }
   });
 });
@@ -0,0 +1,266 @@
+const escapeHTML = (text) =>
+  text
+    .replace(/&/g, "&amp;")
+    .replace(/</g, "&lt;")
+    .replace(/>/g, "&gt;")
+    .replace(/"/g, "&quot;")
+    .replace(/'/g, "&#39;");
+
+// Keywords shared by the languages commonly served. Highlighting
+// is only a reading aid so one list covers all of them
+const KEYWORDS = new Set(
+  `abstract and as async await break case catch class const continue def
+  default defer del do elif else enum except export extends false final
+  finally fn for from func function go if impl import in interface is let
+  loop match mod module mut new nil none not null or package pass private
+  protected pub public raise range return select self static struct super
+  switch this throw trait true try type typeof use var void while with
+  yield`.split(/\s+/),
+);
+
+// Languages using # for line comments instead of //
+const HASH_COMMENTS = new Set([
+  "py",
+  "rb",
+  "sh",
+  "pl",
+  "yaml",
+  "yml",
+  "toml",
+  "conf",
+  "cfg",
+  "ini",
+  "env",
+  "mod",
+  "sum",
+]);
+
+const tokenPattern = (language) => {
+  const comment = HASH_COMMENTS.has(language)
+    ? String.raw`#.*`
+    : String.raw`\/\/.*|\/\*[\s\S]*?\*\/`;
+
+  return new RegExp(
+    [
+      `(${comment})`,
+      String.raw`("(?:\\.|[^"\\\n])*"|'(?:\\.|[^'\\\n])*'|` +
+        "`[^`]*`)",
+      String.raw`(\b\d[\d_]*(?:\.\d+)?(?:e[+-]?\d+)?\b|\b0x[\da-f]+\b)`,
+      String.raw`([A-Za-z_][\w]*)`,
+    ].join("|"),
+    "gi",
+  );
+};
+
+const highlight = (code, language) => {
+  let html = "";
+  let last = 0;
+
+  for (const match of code.matchAll(tokenPattern(language))) {
+    const [text, comment, string, number, word] = match;
+
+    html += escapeHTML(code.slice(last, match.index));
+    last = match.index + text.length;
+
+    let className = "";
+    if (comment) className = "tok-comment";
+    else if (string) className = "tok-string";
+    else if (number) className = "tok-number";
+    else if (word && KEYWORDS.has(word)) className = "tok-keyword";
+
+    html += className
+      ? `<span class="${className}">${escapeHTML(text)}</span>`
+      : escapeHTML(text);
+  }
+
+  return html + escapeHTML(code.slice(last));
+};
+
+// Adds line numbers, closing and reopening spans that
+// cross lines so each line stands on its own
+const numberLines = (html) => {
+  const open = [];
+
+  return html
+    .split("\n")
+    .map((line, index) => {
+      const prefix = open.join("");
+
+      for (const tag of line.match(/<span[^>]*>|<\/span>/g) ?? []) {
+        if (tag === "</span>") open.pop();
+        else open.push(tag);
+      }
+
+      const suffix = "</span>".repeat(open.length);
+      return `<span class="line-number">${index + 1}</span>${prefix}${line}${suffix}`;
+    })
+    .join("\n");
+};
+
+// Only links that cannot run script are kept
+const safeURL = (url) =>
+  /^(https?:|mailto:|#|\/|\.|[\w-]+(\/|\.|$))/i.test(url) ? url : "#";
+
+// Relative links in a markdown file point next to it on the server
+const resolveURL = (url, baseDir, endpoint) => {
+  if (/^([a-z]+:|#|\/\/)/i.test(url)) return url;
+
+  const parts = url.startsWith("/") ? [] : baseDir.split("/");
+  for (const part of url.split(/[?#]/)[0].split("/")) {
+    if (part === "..") parts.pop();
+    else if (part && part !== ".") parts.push(part);
+  }
+
+  const file = "/" + parts.filter(Boolean).join("/");
+  return `${document.body.dataset.base}/${endpoint}?file=${encodeURIComponent(file)}`;
+};
+
+const renderInline = (text, baseDir) => {
+  const codeSpans = [];
+
+  let html = escapeHTML(text).replace(/`([^`]+)`/g, (_, code) => {
+    codeSpans.push(`<code>${code}</code>`);
+    return `\u0000${codeSpans.length - 1}\u0000`;
+  });
+
+  html = html
+    .replace(/!\[([^\]]*)\]\(([^)\s]+)\)/g, (_, alt, src) => {
+      const url = safeURL(resolveURL(src, baseDir, "view"));
+      return `<img src="${url}" alt="${alt}" />`;
+    })
+    .replace(/\[([^\]]+)\]\(([^)\s]+)\)/g, (_, label, href) => {
+      const url = safeURL(resolveURL(href, baseDir, "preview"));
+      return `<a href="${url}">${label}</a>`;
+    })
+    .replace(/\*\*(.+?)\*\*|__(.+?)__/g, "<strong>$1$2</strong>")
+    .replace(/\*([^*]+)\*|\b_([^_]+)_\b/g, "<em>$1$2</em>")
+    .replace(/~~(.+?)~~/g, "<del>$1</del>");
+
+  return html.replace(/\u0000(\d+)\u0000/g, (_, i) => codeSpans[i]);
+};
+
+const renderMarkdown = (markdown, baseDir) => {
+  const lines = markdown.replace(/\r\n?/g, "\n").split("\n");
+  const blocks = [];
+  let paragraph = [];
+  let list = null;
+
+  const flushParagraph = () => {
+    if (paragraph.length) {
+      blocks.push(`<p>${renderInline(paragraph.join(" "), baseDir)}</p>`);
+      paragraph = [];
+    }
+  };
+
+  const flushList = () => {
+    if (list) {
+      const items = list.items
+        .map((item) => `<li>${renderInline(item, baseDir)}</li>`)
+        .join("");
+      blocks.push(`<${list.tag}>${items}</${list.tag}>`);
+      list = null;
+    }
+  };
+
+  const flush = () => {
+    flushParagraph();
+    flushList();
+  };
+
+  for (let i = 0; i < lines.length; i++) {
+    const line = lines[i];
+
+    const fence = line.match(/^\s*(```|~~~)\s*([\w+-]*)/);
+    if (fence) {
+      flush();
+
+      const code = [];
+      for (i++; i < lines.length && !lines[i].trim().startsWith(fence[1]); i++) {
+        code.push(lines[i]);
+      }
+
+      blocks.push(
+        `<pre class="code-preview"><code>${highlight(code.join("\n"), fence[2])}</code></pre>`,
+      );
+      continue;
+    }
+
+    const heading = line.match(/^(#{1,6})\s+(.*?)\s*#*$/);
+    if (heading) {
+      flush();
+      const level = heading[1].length;
+      blocks.push(`<h${level}>${renderInline(heading[2], baseDir)}</h${level}>`);
+      continue;
+    }
+
+    if (/^\s*([-*_])(\s*\1){2,}\s*$/.test(line)) {
+      flush();
+      blocks.push("<hr />");
+      continue;
+    }
+
+    const quote = line.match(/^>\s?(.*)/);
+    if (quote) {
+      flush();
+      const quoted = [quote[1]];
+      while (i + 1 < lines.length && lines[i + 1].startsWith(">")) {
+        quoted.push(lines[++i].replace(/^>\s?/, ""));
+      }
+      blocks.push(`<blockquote>${renderMarkdown(quoted.join("\n"), baseDir)}</blockquote>`);
+      continue;
+    }
+
+    const item = line.match(/^\s*([-*+]|\d+[.)])\s+(.*)/);
+    if (item) {
+      flushParagraph();
+      const tag = /\d/.test(item[1]) ? "ol" : "ul";
+      if (list && list.tag !== tag) flushList();
+      list ??= { tag, items: [] };
+      list.items.push(item[2]);
+      continue;
+    }
+
+    if (!line.trim()) {
+      flush();
+      continue;
+    }
+
+    // Indented lines continue the last list item
+    if (list && /^\s+/.test(line)) {
+      list.items[list.items.length - 1] += " " + line.trim();
+      continue;
+    }
+
+    flushList();
+    paragraph.push(line.trim());
+  }
+
+  flush();
+  return blocks.join("\n");
+};
+
+document.addEventListener("DOMContentLoaded", async () => {
+  const container = document.getElementById("text-preview");
+  if (!container) return;
+
+  const { src, kind, language } = container.dataset;
+  const file = new URL(src, window.location.href).searchParams.get("file");
+  const baseDir = file.slice(0, file.lastIndexOf("/"));
+
+  try {
+    const res = await fetch(src);
+    if (!res.ok) throw new Error(res.statusText);
+
+    const text = await res.text();
+
+    if (kind === "markdown") {
+      container.className = "markdown-preview";
+      container.innerHTML = renderMarkdown(text, baseDir);
+    } else {
+      container.className = "code-preview";
+      container.innerHTML = numberLines(highlight(text, language.toLowerCase()));
+    }
+  } catch (err) {
+    container.textContent = `Failed to load preview: ${err.message}`;
+  }
+});
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/internal/ratelimit"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+type connBucketsKey struct{}
+
+// connBuckets limit the bandwidth of a single connection
+type connBuckets struct {
+	upload   *ratelimit.Bucket
+	download *ratelimit.Bucket
+}
+
+// Throttle limits the request rate of each client and the
+// bandwidth of uploads and downloads
+type Throttle struct {
+	bus          *events.Bus
+	serverConfig *config.ServerConfig
+	tunnel       *TunnelState
+	clients      *ratelimit.Limiter
+	upload       *ratelimit.Bucket
+	download     *ratelimit.Bucket
+}
+
+func NewThrottle(bus *events.Bus, serverConfig *config.ServerConfig, tunnel *TunnelState) *Throttle {
+	return &Throttle{
+		bus:          bus,
+		serverConfig: serverConfig,
+		tunnel:       tunnel,
+		clients:      ratelimit.NewLimiter(serverConfig.GetRateLimit(), serverConfig.GetRateBurst()),
+		upload:       bandwidthBucket(serverConfig.GetUploadLimit()),
+		download:     bandwidthBucket(serverConfig.GetDownloadLimit()),
+	}
+}
+
+// bandwidthBucket allows limit bytes per second, sent in
+// bursts of at most a second worth of bytes
+func bandwidthBucket(limit int64) *ratelimit.Bucket {
+	return ratelimit.NewBucket(float64(limit), float64(limit))
+}
+
+// ConnContext gives each connection its own bandwidth limits,
+// for use as http.Server.ConnContext
+func (t *Throttle) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connBucketsKey{}, t.newConnBuckets())
+}
+
+func (t *Throttle) newConnBuckets() *connBuckets {
+	return &connBuckets{
+		upload:   bandwidthBucket(t.serverConfig.GetConnUploadLimit()),
+		download: bandwidthBucket(t.serverConfig.GetConnDownloadLimit()),
+	}
+}
+
+// TunnelState tells whether the tunnel is up. Only then do local
+// requests come from the tunnel client, and only the servers of
+// some providers append the address of the remote client to
+// X-Forwarded-For. A nil state is never up
+type TunnelState struct {
+	up atomic.Pointer[tunnelUp]
+}
+
+type tunnelUp struct {
+	url             string
+	forwardsClients bool
+}
+
+// SetUp records the URL of the tunnel once it is up, and whether
+// its provider forwards the addresses of the remote clients
+func (ts *TunnelState) SetUp(url string, forwardsClients bool) {
+	ts.up.Store(&tunnelUp{url: url, forwardsClients: forwardsClients})
+}
+
+// SetDown records that the tunnel is down
+func (ts *TunnelState) SetDown() {
+	ts.up.Store(nil)
+}
+
+// URL returns the URL of the tunnel, "" while it is down
+func (ts *TunnelState) URL() string {
+	if ts == nil {
+		return ""
+	}
+
+	if up := ts.up.Load(); up != nil {
+		return up.url
+	}
+
+	return ""
+}
+
+func (ts *TunnelState) Up() bool {
+	return ts.URL() != ""
+}
+
+// forwarded returns the address the tunnel client forwarded r
+// for, "" when r did not come through the tunnel
+func (ts *TunnelState) forwarded(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if ts == nil {
+		return ""
+	}
+
+	// Clients of other providers can send any header they like
+	up := ts.up.Load()
+	if up == nil || !up.forwardsClients {
+		return ""
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return ""
+	}
+
+	values := r.Header.Values("X-Forwarded-For")
+	if len(values) == 0 {
+		return ""
+	}
+
+	entries := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(entries[len(entries)-1])
+}
+
+// clientIP identifies the client of r. Earlier X-Forwarded-For
+// entries are sent by the client and cannot be trusted
+func (ts *TunnelState) clientIP(r *http.Request) string {
+	if forwarded := ts.forwarded(r); forwarded != "" {
+		return forwarded
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return host
+}
+
+// Middleware refuses requests of clients above the rate limit
+// and throttles the bodies of requests and responses to next
+func (t *Throttle) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := t.tunnel.clientIP(r)
+
+		allowed, started := t.clients.Allow(client)
+		if !allowed {
+			if started {
+				t.bus.PublishEvent(events.APILog{
+					Message: fmt.Sprintf("Rate limiting requests from %v", client),
+				})
+			}
+
+			retryAfter := math.Ceil(t.clients.RetryAfter(client).Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(retryAfter), 1)))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		conn, ok := r.Context().Value(connBucketsKey{}).(*connBuckets)
+		if !ok {
+			conn = t.newConnBuckets()
+		}
+
+		if t.upload != nil || conn.upload != nil {
+			reader := ratelimit.NewReader(r.Context(), r.Body, t.upload, conn.upload)
+			reader.OnWait = t.onWait("upload", client, r)
+			r.Body = throttledBody{Reader: reader, body: r.Body}
+		}
+
+		if t.download != nil || conn.download != nil {
+			writer := ratelimit.NewWriter(r.Context(), w, t.download, conn.download)
+			writer.OnWait = t.onWait("download", client, r)
+			w = &throttledWriter{ResponseWriter: w, writer: writer}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// onWait reports the first time a transfer of r is throttled
+func (t *Throttle) onWait(direction string, client string, r *http.Request) func(time.Duration) {
+	var once sync.Once
+
+	return func(time.Duration) {
+		once.Do(func() {
+			t.bus.PublishEvent(events.APILog{
+				Message: fmt.Sprintf("Throttling %v of %v for %v", direction, r.URL.Path, client),
+			})
+		})
+	}
+}
+
+// throttledBody reads a request body at the upload limits
+type throttledBody struct {
+	*ratelimit.Reader
+	body interface{ Close() error }
+}
+
+func (b throttledBody) Close() error {
+	return b.body.Close()
+}
+
+// throttledWriter writes a response at the download limits
+type throttledWriter struct {
+	http.ResponseWriter
+	writer *ratelimit.Writer
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the flusher
+// of the underlying writer
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+)
+
+func TestThrottleRateLimitsClients(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	tunnel := &TunnelState{}
+	throttle := NewThrottle(h.bus, config.NewServerConfig().SetRateLimit(1).SetRateBurst(2), tunnel)
+	handler := throttle.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(remoteAddr string, forwarded string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := request("10.0.0.1:1234", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %v status = %v, want %v", i, rec.Code, http.StatusOK)
+		}
+	}
+
+	rec := request("10.0.0.1:5678", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %v, want %v", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+
+	if rec := request("10.0.0.2:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("other client status = %v, want %v", rec.Code, http.StatusOK)
+	}
+
+	// Without the tunnel local clients cannot claim other addresses
+	for i := 0; i < 2; i++ {
+		request("127.0.0.1:1234", "203.0.113.9")
+	}
+
+	if rec := request("127.0.0.1:1234", "203.0.113.10"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("forwarded address without the tunnel status = %v, want %v", rec.Code, http.StatusTooManyRequests)
+	}
+
+	// Nor through a tunnel forwarding connections as they are
+	tunnel.SetUp("http://svault.example.com:8080", false)
+
+	if rec := request("127.0.0.1:1234", "203.0.113.12"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("forwarded address through an ssh tunnel status = %v, want %v", rec.Code, http.StatusTooManyRequests)
+	}
+
+	tunnel.SetUp("https://svault.example.com", true)
+
+	// Tunneled clients are told apart by the address the tunnel
+	// appended, whatever they sent themselves
+	for _, forwarded := range []string{"203.0.113.1", "10.0.0.1, 203.0.113.2"} {
+		if rec := request("127.0.0.1:1234", forwarded); rec.Code != http.StatusOK {
+			t.Errorf("tunneled client %v status = %v, want %v", forwarded, rec.Code, http.StatusOK)
+		}
+	}
+
+	if rec := request("127.0.0.1:1234", "203.0.113.11, 10.0.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("spoofed client status = %v, want %v", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestThrottleLimitsBandwidth(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	throttle := NewThrottle(h.bus, config.NewServerConfig().SetConnDownloadLimit(1000).SetUploadLimit(1000), nil)
+	handler := throttle.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	body := strings.Repeat("x", 1300)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	if rec.Body.String() != body {
+		t.Fatal("throttling changed the body")
+	}
+
+	// 1000 bytes are free each way, the other 300 take 300ms each
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("transfer took %v, want about 600ms", elapsed)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/thumbnail"
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+)
+
+// Thumbnails fit in a square of this many pixels
+const thumbnailSize = 256
+
+// ThumbnailHandler sends a small JPEG preview of the
+// image in the file query, generating it on first use
+func (h *Handlers) ThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	name, err := fsroot.Clean(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, "Failed to get thumbnail", errorStatus(err))
+		return
+	}
+
+	if err := h.authorize(r, users.PERM_READ, name); err != nil {
+		http.Error(w, "Failed to get thumbnail", errorStatus(err))
+		return
+	}
+
+	if !thumbnail.Supported(name) {
+		http.Error(w, "Failed to get thumbnail", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	src, err := h.root.Open(name)
+	if err != nil {
+		http.Error(w, "Failed to get thumbnail", errorStatus(err))
+		return
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(w, "Failed to get thumbnail", http.StatusNotFound)
+		return
+	}
+
+	// The cache is shared by every dir served, so files are
+	// told apart by their path on disk
+	resolved, err := h.root.Resolve(name)
+	if err != nil {
+		http.Error(w, "Failed to get thumbnail", errorStatus(err))
+		return
+	}
+
+	cached, err := h.thumbs.Get(resolved, info, src)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, thumbnail.ErrUnsupported) || errors.Is(err, thumbnail.ErrTooLarge) {
+			status = http.StatusUnsupportedMediaType
+		}
+
+		h.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("failed to make thumbnail of %v: %w", filepath.Join(h.dir, name), err),
+		})
+
+		http.Error(w, "Failed to get thumbnail", status)
+		return
+	}
+
+	thumb, err := os.Open(cached)
+	if err != nil {
+		http.Error(w, "Failed to get thumbnail", http.StatusInternalServerError)
+		return
+	}
+	defer thumb.Close()
+
+	// Browsers revalidate with the source's modification time,
+	// so an edited image gets a fresh thumbnail
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	http.ServeContent(w, r, "", info.ModTime(), thumb)
+}
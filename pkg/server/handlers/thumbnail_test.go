@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+)
+
+func TestThumbnailHandler(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(base, "served", "photo.png"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(base, "leaked.png"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file       string
+		wantStatus int
+	}{
+		{"/photo.png", http.StatusOK},
+		{"/sub/file.txt", http.StatusUnsupportedMediaType},
+		{"/missing.png", http.StatusNotFound},
+		{"../leaked.png", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ThumbnailHandler(rec, httptest.NewRequest(http.MethodGet, "/thumb?file="+url.QueryEscape(tt.file), nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			thumb, _, err := image.Decode(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := thumb.Bounds().Size(); got != image.Pt(thumbnailSize, thumbnailSize/2) {
+				t.Fatalf("thumbnail size = %v", got)
+			}
+		})
+	}
+}
+
+func TestThumbnailHandlerKeepsDirsApart(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatal(err)
+	}
+
+	other := filepath.Join(base, "other")
+	os.MkdirAll(other, 0o755)
+
+	// Same name, size and time in both dirs
+	modTime := time.Now().Add(-time.Hour)
+	for _, dir := range []string{filepath.Join(base, "served"), other} {
+		p := filepath.Join(dir, "photo.png")
+		if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, modTime, modTime)
+	}
+
+	otherHandlers := NewHandlers(h.bus, other, config.NewServerConfig(), config.NewNotifConfig())
+	t.Cleanup(func() { otherHandlers.Close() })
+
+	for _, handlers := range []*Handlers{h, otherHandlers} {
+		rec := httptest.NewRecorder()
+		handlers.ThumbnailHandler(rec, httptest.NewRequest(http.MethodGet, "/thumb?file=/photo.png", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %v, want %v", rec.Code, http.StatusOK)
+		}
+	}
+
+	cached, _ := filepath.Glob(filepath.Join(base, "home", ".svault", "cache", "thumbnails", "*.jpg"))
+	if len(cached) != 2 {
+		t.Errorf("cached thumbnails = %v, want one for each dir", cached)
+	}
+}
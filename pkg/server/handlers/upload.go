@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+	"github.com/Owbird/SVault-Engine/pkg/models"
+)
+
+// Prefix of the temp files uploads are written to before
+// being moved into place
+const uploadTempPrefix = ".svault-upload-"
+
+// Highest suffix tried when renaming an upload to a free name
+const maxRenameAttempts = 1000
+
+var errUploadsDisabled = &httpError{
+	status: http.StatusForbidden,
+	err:    errors.New("uploads are not allowed on this server"),
+}
+
+func (h *Handlers) GetFileUpload(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.saveUploads(w, r); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+}
+
+// saveUploads stores every file part of a multipart request
+// in the requested upload dir and returns the saved files
+func (h *Handlers) saveUploads(w http.ResponseWriter, r *http.Request) ([]File, error) {
+	saved := []File{}
+
+	if !h.serverConfig.GetAllowUploads() {
+		h.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("rejected upload from %v: %w", r.RemoteAddr, errUploadsDisabled),
+		})
+		return saved, errUploadsDisabled
+	}
+
+	h.bus.PublishEvent(events.APILog{
+		Message: "Receiving files",
+	})
+
+	if maxSize := h.serverConfig.GetMaxUploadSize(); maxSize > 0 {
+		if r.ContentLength > maxSize {
+			return saved, &http.MaxBytesError{Limit: maxSize}
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		log.Println(err)
+		return saved, &httpError{status: http.StatusBadRequest, err: err}
+	}
+
+	// The form field is part of the stream, the query is kept
+	// as a fallback for clients sending it in the URL
+	uploadDir := r.URL.Query().Get("uploadDir")
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Println(err)
+			return saved, err
+		}
+
+		if part.FormName() == "uploadDir" && part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				return saved, &httpError{status: http.StatusBadRequest, err: err}
+			}
+
+			uploadDir = string(value)
+			continue
+		}
+
+		// Handle file parts only
+		if part.FileName() != "" {
+			relPath := partRelativePath(part)
+
+			dir, name, err := h.uploadTarget(uploadDir, relPath)
+			if err != nil {
+				h.bus.PublishEvent(events.APILog{
+					Err: fmt.Errorf("rejected upload of %v to %v: %w", relPath, uploadDir, err),
+				})
+				return saved, err
+			}
+
+			target := path.Join(dir, name)
+
+			if err := h.authorize(r, users.PERM_UPLOAD, target); err != nil {
+				return saved, err
+			}
+
+			// Fail early instead of receiving a file that will be rejected
+			if h.serverConfig.GetOverwritePolicy() == config.OVERWRITE_REJECT {
+				if _, err := h.root.Stat(target); err == nil {
+					return saved, errFileExists(target)
+				}
+			}
+
+			if err := h.root.MkdirAll(dir, 0o755); err != nil {
+				return saved, err
+			}
+
+			tmpPath, err := h.writeTemp(dir, part)
+			if err != nil {
+				log.Println(err)
+				return saved, err
+			}
+
+			savedPath, err := h.commitUpload(tmpPath, target)
+			if err != nil {
+				os.Remove(tmpPath)
+				return saved, err
+			}
+
+			h.bus.PublishEvent(events.APILog{
+				Message: fmt.Sprintf("File received at %v", filepath.Join(h.dir, savedPath)),
+			})
+
+			h.notifConfig.SendNotification(models.Notification{
+				Title: "File received",
+				Body:  fmt.Sprintf("File %v received", path.Base(savedPath)),
+			})
+
+			if file, err := h.statFile(savedPath); err == nil {
+				saved = append(saved, file)
+			}
+		}
+	}
+
+	return saved, nil
+}
+
+// partRelativePath returns the file name of a part as sent by
+// the client. Unlike part.FileName the directories of folder
+// uploads are kept
+func partRelativePath(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return part.FileName()
+	}
+
+	return params["filename"]
+}
+
+// uploadTarget returns the directory and name an upload is saved
+// under. relPath is the path of the file relative to uploadDir,
+// which folder uploads send to preserve their structure. Neither
+// may climb out of uploadDir or the served dir
+func (h *Handlers) uploadTarget(uploadDir string, relPath string) (string, string, error) {
+	dir, err := fsroot.Clean(uploadDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	rel, err := fsroot.Clean(relPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := path.Base(rel)
+	if rel == "." || name == ".." {
+		return "", "", &httpError{status: http.StatusBadRequest, err: errors.New("invalid file name")}
+	}
+
+	dir = path.Join(dir, path.Dir(rel))
+
+	if _, err := h.root.Resolve(path.Join(dir, name)); err != nil {
+		return "", "", err
+	}
+
+	return dir, name, nil
+}
+
+func errFileExists(name string) error {
+	return &httpError{
+		status: http.StatusConflict,
+		err:    fmt.Errorf("%v already exists", path.Base(name)),
+	}
+}
+
+// createTemp creates a temp file inside dir for an upload
+// to be written to before being moved into place
+func (h *Handlers) createTemp(dir string) (*os.File, error) {
+	resolvedDir, err := h.root.Resolve(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(resolvedDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, &httpError{status: http.StatusBadRequest, err: fmt.Errorf("%v is not a directory", dir)}
+	}
+
+	return os.CreateTemp(resolvedDir, uploadTempPrefix+"*")
+}
+
+// writeTemp copies src into a temp file inside dir so it can be
+// renamed into place once complete. The temp file is removed
+// if the copy fails
+func (h *Handlers) writeTemp(dir string, src io.Reader) (string, error) {
+	tmp, err := h.createTemp(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+// commitUpload moves a completed temp file to target following the
+// overwrite policy and returns the path it was saved under
+func (h *Handlers) commitUpload(tmpPath string, target string) (string, error) {
+	policy := h.serverConfig.GetOverwritePolicy()
+
+	if policy == config.OVERWRITE_OVERWRITE {
+		resolved, err := h.root.Resolve(target)
+		if err != nil {
+			return "", err
+		}
+
+		if info, err := os.Stat(resolved); err == nil && info.IsDir() {
+			return "", errFileExists(target)
+		}
+
+		return target, os.Rename(tmpPath, resolved)
+	}
+
+	ext := path.Ext(target)
+	base := strings.TrimSuffix(target, ext)
+
+	for attempt := 0; attempt < maxRenameAttempts; attempt++ {
+		candidate := target
+		if attempt > 0 {
+			candidate = fmt.Sprintf("%v (%d)%v", base, attempt, ext)
+		}
+
+		resolved, err := h.root.Resolve(candidate)
+		if err != nil {
+			return "", err
+		}
+
+		err = placeNew(tmpPath, resolved)
+		if err == nil {
+			return candidate, nil
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+
+		if policy == config.OVERWRITE_REJECT {
+			return "", errFileExists(target)
+		}
+	}
+
+	return "", errFileExists(target)
+}
+
+// placeNew moves src to dst only if dst does not exist yet.
+// A hard link is used so the check and the move are atomic,
+// falling back to a checked rename where links are unsupported
+func placeNew(src string, dst string) error {
+	err := os.Link(src, dst)
+	if err == nil {
+		return os.Remove(src)
+	}
+
+	if errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		return fs.ErrExist
+	}
+
+	return os.Rename(src, dst)
+}
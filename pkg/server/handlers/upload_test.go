@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+)
+
+func newUploadRequest(t *testing.T, target string, uploadDir string, files map[string]string) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+
+	if err := mw.WriteField("uploadDir", uploadDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fw.Write([]byte(content))
+	}
+
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return req
+}
+
+// servedFiles returns the names in dir, failing on leftover temp files
+func servedFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), uploadTempPrefix) {
+			t.Fatalf("temp file %v left behind", entry.Name())
+		}
+
+		if entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[entry.Name()] = string(data)
+	}
+
+	return files
+}
+
+func TestUploadRejectedWhenDisabled(t *testing.T) {
+	h, base := newTestHandlers(t)
+	h.serverConfig.SetAllowUploads(false)
+
+	rec := httptest.NewRecorder()
+	h.GetFileUpload(rec, newUploadRequest(t, "/upload", "/", map[string]string{"new.txt": "new"}))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	if _, ok := servedFiles(t, filepath.Join(base, "served"))["new.txt"]; ok {
+		t.Fatal("upload was stored while disabled")
+	}
+}
+
+func TestUploadMaxSize(t *testing.T) {
+	h, base := newTestHandlers(t)
+	h.serverConfig.SetMaxUploadSize(512)
+
+	rec := httptest.NewRecorder()
+	h.GetFileUpload(rec, newUploadRequest(t, "/upload", "/", map[string]string{"big.txt": strings.Repeat("x", 4096)}))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %v, want %v", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// Without a known length the limit is hit while streaming
+	req := newUploadRequest(t, "/upload", "/", map[string]string{"big.txt": strings.Repeat("x", 4096)})
+	req.ContentLength = -1
+
+	rec = httptest.NewRecorder()
+	h.GetFileUpload(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("streamed status = %v, want %v", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	if _, ok := servedFiles(t, filepath.Join(base, "served"))["big.txt"]; ok {
+		t.Fatal("oversized upload was stored")
+	}
+}
+
+func TestUploadOverwritePolicy(t *testing.T) {
+	tests := []struct {
+		policy     string
+		wantStatus int
+		want       map[string]string
+	}{
+		{config.OVERWRITE_REJECT, http.StatusConflict, map[string]string{"file.txt": "file"}},
+		{config.OVERWRITE_RENAME, http.StatusOK, map[string]string{"file.txt": "file", "file (1).txt": "new"}},
+		{config.OVERWRITE_OVERWRITE, http.StatusOK, map[string]string{"file.txt": "new"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			h, base := newTestHandlers(t)
+			h.serverConfig.SetOverwritePolicy(tt.policy)
+
+			rec := httptest.NewRecorder()
+			h.GetFileUpload(rec, newUploadRequest(t, "/upload", "/sub", map[string]string{"file.txt": "new"}))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %v", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			got := servedFiles(t, filepath.Join(base, "served", "sub"))
+			if len(got) != len(tt.want) {
+				t.Fatalf("files = %v, want %v", got, tt.want)
+			}
+
+			for name, content := range tt.want {
+				if got[name] != content {
+					t.Fatalf("files = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadRenameKeepsCounting(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.GetFileUpload(rec, newUploadRequest(t, "/upload", "/sub", map[string]string{"file.txt": "new"}))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %v: %v", rec.Code, rec.Body.String())
+		}
+	}
+
+	got := servedFiles(t, filepath.Join(base, "served", "sub"))
+	for _, name := range []string{"file.txt", "file (1).txt", "file (2).txt"} {
+		if _, ok := got[name]; !ok {
+			t.Fatalf("missing %v in %v", name, got)
+		}
+	}
+}
+
+func TestUploadKeepsFolderStructure(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.GetFileUpload(rec, newUploadRequest(t, "/upload", "/sub", map[string]string{
+		"album/2024/photo.jpg": "photo",
+		"album/notes.txt":      "notes",
+	}))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %v", rec.Code, rec.Body.String())
+	}
+
+	for name, content := range map[string]string{
+		"sub/album/2024/photo.jpg": "photo",
+		"sub/album/notes.txt":      "notes",
+	} {
+		data, err := os.ReadFile(filepath.Join(base, "served", filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Fatalf("%v = %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestUploadRejectsFolderTraversal(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	for _, name := range []string{"../planted.txt", "album/../../planted.txt", "/../../planted.txt"} {
+		rec := httptest.NewRecorder()
+		h.GetFileUpload(rec, newUploadRequest(t, "/upload", "/sub", map[string]string{name: "planted"}))
+
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%v status = %v, want %v", name, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	for _, dir := range []string{base, filepath.Join(base, "served")} {
+		if _, err := os.Stat(filepath.Join(dir, "planted.txt")); err == nil {
+			t.Fatalf("upload escaped into %v", dir)
+		}
+	}
+}
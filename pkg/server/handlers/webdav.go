@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/internal/fsroot"
+	"github.com/Owbird/SVault-Engine/internal/users"
+	"github.com/Owbird/SVault-Engine/pkg/events"
+	"golang.org/x/net/webdav"
+)
+
+// Path the WebDAV share is served under
+const davPrefix = "/dav"
+
+// davFS exposes the root to WebDAV with the permissions of the
+// user of a request. Temp files of uploads in progress do not exist
+type davFS struct {
+	h *Handlers
+	r *http.Request
+}
+
+// davFile is an open file or directory of a davFS
+type davFile struct {
+	*os.File
+	fs   davFS
+	name string
+}
+
+// davUpload is a file opened for writing by a davFS. It is written
+// to a temp file, which is moved into place on Close following the
+// overwrite policy, unless a write or the copy into it failed
+type davUpload struct {
+	*os.File
+	fs   davFS
+	name string
+	err  error
+}
+
+// davMethodPerms maps the WebDAV methods changing files to the
+// permission of users they need. Others only read
+var davMethodPerms = map[string]string{
+	http.MethodPut:    users.PERM_UPLOAD,
+	"MKCOL":           users.PERM_UPLOAD,
+	"COPY":            users.PERM_UPLOAD,
+	"LOCK":            users.PERM_UPLOAD,
+	"UNLOCK":          users.PERM_UPLOAD,
+	"PROPPATCH":       users.PERM_UPLOAD,
+	"MOVE":            users.PERM_MODIFY,
+	http.MethodDelete: users.PERM_DELETE,
+}
+
+// DavHandler serves the root over WebDAV under /dav/ so it can be
+// mounted as a network drive. Writes follow the same settings and
+// user permissions as the web UI
+func (h *Handlers) DavHandler(w http.ResponseWriter, r *http.Request) {
+	perm, writes := davMethodPerms[r.Method]
+	if !writes {
+		perm = users.PERM_READ
+	}
+
+	if err := h.davAllowed(perm); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	if !userCan(r, perm) {
+		http.Error(w, errForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		if maxSize := h.serverConfig.GetMaxUploadSize(); maxSize > 0 {
+			if r.ContentLength > maxSize {
+				err := &http.MaxBytesError{Limit: maxSize}
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		}
+	}
+
+	// Mounts are served with their name stripped, while the
+	// hrefs of responses and Destination headers include it
+	base := h.serverConfig.GetBasePath()
+
+	// Clients address files by their exact name, so only the reject
+	// policy applies and anything else replaces the existing file
+	if h.serverConfig.GetOverwritePolicy() == config.OVERWRITE_REJECT {
+		if name, ok := davTarget(r, base); ok {
+			if info, err := h.root.Stat(name); err == nil && (r.Method != http.MethodPut || !info.IsDir()) {
+				http.Error(w, errFileExists(name).Error(), http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = base + r.URL.Path
+	r2.URL.RawPath = ""
+
+	dav := &webdav.Handler{
+		Prefix:     base + davPrefix,
+		FileSystem: davFS{h: h, r: r},
+		LockSystem: h.davLocks,
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				h.bus.PublishEvent(events.APILog{
+					Err: fmt.Errorf("WebDAV %v %v failed: %w", r.Method, r.URL.Path, err),
+				})
+				return
+			}
+
+			if writes {
+				h.bus.PublishEvent(events.APILog{
+					Message: fmt.Sprintf("WebDAV %v %v", r.Method, r.URL.Path),
+				})
+			}
+		},
+	}
+
+	dav.ServeHTTP(w, r2)
+}
+
+// davTarget returns the name of the file a request writes
+// to, if any. COPY and MOVE replace their destination
+func davTarget(r *http.Request, base string) (string, bool) {
+	switch r.Method {
+	case http.MethodPut:
+		return strings.TrimPrefix(r.URL.Path, davPrefix), true
+	case "COPY", "MOVE":
+		u, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil {
+			return "", false
+		}
+
+		name, ok := strings.CutPrefix(u.Path, base+davPrefix)
+		return name, ok && name != ""
+	default:
+		return "", false
+	}
+}
+
+// davAllowed checks that the server allows perm
+func (h *Handlers) davAllowed(perm string) error {
+	switch {
+	case perm == users.PERM_UPLOAD && !h.serverConfig.GetAllowUploads():
+		return errUploadsDisabled
+	case perm == users.PERM_MODIFY && !h.serverConfig.GetAllowModify():
+		return errModifyDisabled
+	case perm == users.PERM_DELETE && !h.serverConfig.GetAllowDelete():
+		return errDeleteDisabled
+	default:
+		return nil
+	}
+}
+
+// exists reports whether name is part of the share for the user
+func (d davFS) exists(name string) bool {
+	return !strings.HasPrefix(path.Base(name), uploadTempPrefix) && d.h.visible(d.r, name)
+}
+
+// check returns an error when the user cannot perform perm on name
+func (d davFS) check(perm string, names ...string) error {
+	for _, name := range names {
+		if !d.exists(name) {
+			return fs.ErrNotExist
+		}
+	}
+
+	if err := d.h.authorize(d.r, perm, names...); err != nil {
+		return fs.ErrPermission
+	}
+
+	return nil
+}
+
+func (d davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if err := d.check(users.PERM_UPLOAD, name); err != nil {
+		return err
+	}
+
+	return d.h.root.Mkdir(name, perm)
+}
+
+func (d davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if !d.exists(name) {
+		return nil, fs.ErrNotExist
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		if err := d.check(users.PERM_UPLOAD, name); err != nil {
+			return nil, err
+		}
+	}
+
+	// PUT and COPY replace the whole file
+	if flag&os.O_TRUNC != 0 {
+		cleaned, err := fsroot.Clean(name)
+		if err != nil {
+			return nil, err
+		}
+
+		tmp, err := d.h.createTemp(path.Dir(cleaned))
+		if err != nil {
+			return nil, err
+		}
+
+		return &davUpload{File: tmp, fs: d, name: cleaned}, nil
+	}
+
+	file, err := d.h.root.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Directories leading to granted paths can be listed, files
+	// only be read where they are granted
+	if !info.IsDir() && d.h.authorize(d.r, users.PERM_READ, name) != nil {
+		file.Close()
+		return nil, fs.ErrNotExist
+	}
+
+	return davFile{File: file, fs: d, name: name}, nil
+}
+
+// RemoveAll deletes name, also when COPY or MOVE replace it
+func (d davFS) RemoveAll(ctx context.Context, name string) error {
+	if d.h.davAllowed(users.PERM_DELETE) != nil {
+		return fs.ErrPermission
+	}
+
+	if err := d.check(users.PERM_DELETE, name); err != nil {
+		return err
+	}
+
+	return d.h.root.RemoveAll(name)
+}
+
+func (d davFS) Rename(ctx context.Context, oldName string, newName string) error {
+	if err := d.check(users.PERM_MODIFY, oldName, newName); err != nil {
+		return err
+	}
+
+	return d.h.root.Rename(oldName, newName)
+}
+
+func (d davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if !d.exists(name) {
+		return nil, fs.ErrNotExist
+	}
+
+	return d.h.root.Stat(name)
+}
+
+func (u *davUpload) Write(p []byte) (int, error) {
+	n, err := u.File.Write(p)
+	if err != nil && u.err == nil {
+		u.err = err
+	}
+
+	return n, err
+}
+
+// ReadFrom copies src into the upload, remembering when the copy
+// failed as the request body may end before the file is complete
+func (u *davUpload) ReadFrom(src io.Reader) (int64, error) {
+	n, err := io.Copy(u.File, src)
+	if err != nil && u.err == nil {
+		u.err = err
+	}
+
+	return n, err
+}
+
+// Close moves the upload into place, or discards it if it failed
+func (u *davUpload) Close() error {
+	err := u.File.Close()
+	if err == nil {
+		err = u.err
+	}
+
+	if err == nil {
+		_, err = u.fs.h.commitUpload(u.File.Name(), u.name)
+	}
+
+	if err != nil {
+		os.Remove(u.File.Name())
+	}
+
+	return err
+}
+
+// Readdir lists the entries the user can see, following the
+// symlinks the root allows. All entries are returned at once
+func (f davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	entries, err := f.fs.h.root.ReadDir(f.name)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []fs.FileInfo{}
+
+	for _, entry := range entries {
+		name := path.Join(f.name, entry.Name())
+
+		if !f.fs.exists(name) {
+			continue
+		}
+
+		if !f.fs.h.serverConfig.GetShowHidden() && isHidden(entry.Name()) {
+			continue
+		}
+
+		info, err := f.fs.h.root.Stat(name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
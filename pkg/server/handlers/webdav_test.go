@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Owbird/SVault-Engine/internal/config"
+)
+
+func TestDavHandlerListsAndReads(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	os.WriteFile(filepath.Join(base, "served", uploadTempPrefix+"partial"), []byte("partial"), 0o644)
+
+	req := httptest.NewRequest("PROPFIND", "/dav/", nil)
+	req.Header.Set("Depth", "1")
+	rec := httptest.NewRecorder()
+	h.DavHandler(rec, req)
+
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND status = %v, want %v", rec.Code, http.StatusMultiStatus)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "<D:href>/dav/sub/</D:href>") {
+		t.Errorf("PROPFIND is missing sub: %v", body)
+	}
+	if strings.Contains(body, uploadTempPrefix) {
+		t.Errorf("PROPFIND lists an upload temp file: %v", body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.DavHandler(rec, httptest.NewRequest(http.MethodGet, "/dav/sub/file.txt", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "file" {
+		t.Errorf("GET = %v %q, want %v %q", rec.Code, rec.Body.String(), http.StatusOK, "file")
+	}
+
+	rec = httptest.NewRecorder()
+	h.DavHandler(rec, httptest.NewRequest(http.MethodGet, "/dav/../secret.txt", nil))
+
+	if rec.Code == http.StatusOK {
+		t.Error("GET escaped the served dir")
+	}
+}
+
+func TestDavHandlerWrites(t *testing.T) {
+	h, base := newTestHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.DavHandler(rec, httptest.NewRequest(http.MethodPut, "/dav/sub/new.txt", strings.NewReader("new")))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PUT status = %v, want %v", rec.Code, http.StatusCreated)
+	}
+
+	data, err := os.ReadFile(filepath.Join(base, "served", "sub", "new.txt"))
+	if err != nil || string(data) != "new" {
+		t.Errorf("PUT wrote %q, %v", data, err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.DavHandler(rec, httptest.NewRequest(http.MethodDelete, "/dav/sub/new.txt", nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("DELETE status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	h.serverConfig.SetAllowUploads(false)
+
+	rec = httptest.NewRecorder()
+	h.DavHandler(rec, httptest.NewRequest("MKCOL", "/dav/dir", nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("MKCOL status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "served", "dir")); err == nil {
+		t.Error("MKCOL created a directory while uploads are not allowed")
+	}
+}
+
+func TestDavHandlerCopyMoveNeedDeleteToReplace(t *testing.T) {
+	h, base := newTestHandlers(t)
+	h.serverConfig.SetAllowModify(true)
+
+	os.WriteFile(filepath.Join(base, "served", "top.txt"), []byte("top"), 0o644)
+
+	for _, method := range []string{"COPY", "MOVE"} {
+		req := httptest.NewRequest(method, "/dav/top.txt", nil)
+		req.Header.Set("Destination", "/dav/sub/file.txt")
+		req.Header.Set("Overwrite", "T")
+
+		rec := httptest.NewRecorder()
+		h.DavHandler(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%v status = %v, want %v", method, rec.Code, http.StatusForbidden)
+		}
+
+		data, err := os.ReadFile(filepath.Join(base, "served", "sub", "file.txt"))
+		if err != nil || string(data) != "file" {
+			t.Errorf("%v replaced the destination while deletes are not allowed: %q, %v", method, data, err)
+		}
+	}
+}
+
+func TestDavHandlerCopyMoveRejectExisting(t *testing.T) {
+	h, base := newTestHandlers(t)
+	h.serverConfig.SetAllowModify(true).SetAllowDelete(true).SetOverwritePolicy(config.OVERWRITE_REJECT)
+
+	os.WriteFile(filepath.Join(base, "served", "top.txt"), []byte("top"), 0o644)
+
+	for _, method := range []string{"COPY", "MOVE"} {
+		req := httptest.NewRequest(method, "/dav/top.txt", nil)
+		req.Header.Set("Destination", "/dav/sub")
+		req.Header.Set("Overwrite", "T")
+
+		rec := httptest.NewRecorder()
+		h.DavHandler(rec, req)
+
+		if rec.Code != http.StatusConflict {
+			t.Errorf("%v status = %v, want %v", method, rec.Code, http.StatusConflict)
+		}
+
+		if _, err := os.Stat(filepath.Join(base, "served", "sub", "file.txt")); err != nil {
+			t.Errorf("%v replaced the destination: %v", method, err)
+		}
+	}
+
+	req := httptest.NewRequest("COPY", "/dav/top.txt", nil)
+	req.Header.Set("Destination", "/dav/copy.txt")
+
+	rec := httptest.NewRecorder()
+	h.DavHandler(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("COPY to a new file status = %v, want %v", rec.Code, http.StatusCreated)
+	}
+}
+
+// failingReader fails after returning its data, like a dropped connection
+type failingReader struct {
+	data string
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.data == "" {
+		return 0, errors.New("connection reset")
+	}
+
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+
+	return n, nil
+}
+
+func TestDavHandlerPutUploadsSafely(t *testing.T) {
+	h, base := newTestHandlers(t)
+	h.serverConfig.SetMaxUploadSize(4)
+
+	rec := httptest.NewRecorder()
+	h.DavHandler(rec, httptest.NewRequest(http.MethodPut, "/dav/big.txt", strings.NewReader("too big")))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT above the limit status = %v, want %v", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// Existing files are renamed around like other uploads
+	rec = httptest.NewRecorder()
+	h.DavHandler(rec, httptest.NewRequest(http.MethodPut, "/dav/sub/file.txt", strings.NewReader("new")))
+
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusNoContent {
+		t.Fatalf("PUT status = %v", rec.Code)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(base, "served", "sub", "file.txt")); string(data) != "file" {
+		t.Errorf("PUT replaced the existing file with %q", data)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(base, "served", "sub", "file (1).txt")); string(data) != "new" {
+		t.Errorf("renamed upload = %q, want %q", data, "new")
+	}
+
+	rec = httptest.NewRecorder()
+	h.DavHandler(rec, httptest.NewRequest(http.MethodPut, "/dav/cut.txt", &failingReader{data: "cut"}))
+
+	if rec.Code < 400 {
+		t.Errorf("interrupted PUT status = %v, want an error", rec.Code)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(base, "served"))
+	for _, entry := range entries {
+		if entry.Name() == "cut.txt" || strings.HasPrefix(entry.Name(), uploadTempPrefix) {
+			t.Errorf("interrupted PUT left %v", entry.Name())
+		}
+	}
+}
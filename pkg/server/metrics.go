@@ -0,0 +1,69 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/Owbird/SVault-Engine/internal/metrics"
+	"github.com/Owbird/SVault-Engine/pkg/server/handlers"
+)
+
+const (
+	// Directions of wormhole transfers
+	SEND    = "send"
+	RECEIVE = "receive"
+)
+
+// serverMetrics are the metrics of the web server, the
+// wormhole transfers and the tunnel
+type serverMetrics struct {
+	registry *metrics.Registry
+	http     *handlers.Metrics
+
+	transfersInFlight *metrics.Vec
+	transfers         *metrics.Vec
+	tunnelUp          *metrics.Vec
+}
+
+func newServerMetrics() *serverMetrics {
+	registry := metrics.NewRegistry()
+
+	return &serverMetrics{
+		registry: registry,
+		http:     handlers.NewMetrics(registry),
+		transfersInFlight: registry.Gauge(
+			"svault_wormhole_transfers_in_flight",
+			"Wormhole transfers in progress by direction.",
+			"direction",
+		),
+		transfers: registry.Counter(
+			"svault_wormhole_transfers_total",
+			"Wormhole transfers finished by direction and result.",
+			"direction", "result",
+		),
+		tunnelUp: registry.Gauge(
+			"svault_tunnel_up",
+			"Whether the tunnel serving the web UI remotely is open.",
+		),
+	}
+}
+
+// transferStarted counts a wormhole transfer in flight until
+// the returned function is called with its outcome
+func (m *serverMetrics) transferStarted(direction string) (done func(err error)) {
+	m.transfersInFlight.Inc(direction)
+
+	var once sync.Once
+
+	return func(err error) {
+		once.Do(func() {
+			m.transfersInFlight.Dec(direction)
+
+			result := "ok"
+			if err != nil {
+				result = "error"
+			}
+
+			m.transfers.Inc(direction, result)
+		})
+	}
+}
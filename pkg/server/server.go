@@ -3,19 +3,29 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/Owbird/SVault-Engine/internal/accesslog"
+	"github.com/Owbird/SVault-Engine/internal/config"
+	"github.com/Owbird/SVault-Engine/internal/mdns"
+	"github.com/Owbird/SVault-Engine/internal/tunnel"
+	"github.com/Owbird/SVault-Engine/internal/users"
 	"github.com/Owbird/SVault-Engine/internal/utils"
-	"github.com/Owbird/SVault-Engine/pkg/config"
+	appconfig "github.com/Owbird/SVault-Engine/pkg/config"
+	"github.com/Owbird/SVault-Engine/pkg/events"
 	"github.com/Owbird/SVault-Engine/pkg/models"
 	"github.com/Owbird/SVault-Engine/pkg/server/handlers"
-	"github.com/localtunnel/go-localtunnel"
 	"github.com/psanford/wormhole-william/wormhole"
 	"github.com/rs/cors"
 )
@@ -24,8 +34,28 @@ type Server struct {
 	// The current directory being hosted
 	Dir string
 
-	// The channel to send the logs through
-	logCh chan models.ServerLog
+	// Directories hosted under their names, e.g. "photos" is served
+	// at /photos/. They are added to the mounts of svault.toml,
+	// replacing those with the same name
+	Mounts map[string]string
+
+	// The network interface the server is advertised on and whose
+	// address is logged. Defaults to picking one
+	Interface string
+
+	// Should the server be exposed remotely through the tunnel.
+	// Defaults to false, serving the local network alone
+	Remote bool
+
+	// Exposes the server remotely. Defaults to the provider
+	// selected in svault.toml
+	Tunnel tunnel.Provider
+
+	// Delivers the logs to the subscribers
+	bus *events.Bus
+
+	// Counts the requests, transfers and tunnel status
+	metrics *serverMetrics
 }
 
 // ShareCallBacks defines a set of callback functions for handling file sharing events.
@@ -47,7 +77,7 @@ const (
 	PORT = 8080
 )
 
-var appConfig = config.NewAppConfig()
+var appConfig = appconfig.NewAppConfig()
 
 func sendNotification(notif models.Notification) {
 	appConfig.GetNotifConfig().SendNotification(models.Notification{
@@ -57,69 +87,144 @@ func sendNotification(notif models.Notification) {
 	})
 }
 
+// NewServer returns a server for dir. The logs are sent
+// to logCh when it is not nil, see Subscribe for more
 func NewServer(dir string, logCh chan models.ServerLog) *Server {
+	bus := events.NewBus()
+
+	if logCh != nil {
+		bus.Subscribe(events.Channel(logCh))
+	}
+
 	return &Server{
-		Dir:   dir,
-		logCh: logCh,
+		Dir:     dir,
+		bus:     bus,
+		metrics: newServerMetrics(),
 	}
 }
 
-// Starts starts and serves the specified dir
-func (s *Server) Start() {
-	s.logCh <- models.ServerLog{
+// Subscribe delivers the logs of the server to subscriber until
+// unsubscribe is called. A slow subscriber misses logs rather
+// than holding up the server
+func (s *Server) Subscribe(subscriber events.Subscriber) (unsubscribe func()) {
+	return s.bus.Subscribe(subscriber)
+}
+
+// Starts starts and serves the specified dir. It returns
+// when the server can't start or stops serving
+func (s *Server) Start() error {
+	s.bus.PublishEvent(events.APILog{
 		Message: "Starting server",
-		Type:    models.API_LOG,
+	})
+
+	serverConfig := appConfig.GetSeverConfig()
+
+	mounts := s.mounts(serverConfig)
+
+	if len(mounts) == 0 && s.Dir == "" {
+		err := errors.New("no directory or mounts to serve")
+		s.bus.PublishEvent(events.APILog{
+			Err: err,
+		})
+		return err
 	}
 
-	host, err := utils.GetLocalIp()
+	// Without a network the server is still reachable on this
+	// machine, and through the tunnel
+	iface, ip, err := utils.LocalInterface(s.Interface)
 	if err != nil {
-		s.logCh <- models.ServerLog{
-			Error: err,
-			Type:  models.SERVE_WEB_UI_NETWORK,
-		}
-		return
+		s.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("serving on this machine alone: %w", err),
+		})
+		ip = net.IPv4(127, 0, 0, 1)
 	}
 
-	s.logCh <- models.ServerLog{
-		Message: fmt.Sprintf("http://%s:%s", host, strconv.Itoa(PORT)),
-		Type:    models.SERVE_WEB_UI_NETWORK,
+	networkURL := fmt.Sprintf("http://%s:%s", ip, strconv.Itoa(PORT))
+
+	s.bus.PublishEvent(events.NetworkURL{
+		URL: networkURL,
+	})
+
+	// Trusts the client addresses forwarded by the tunnel while it is up
+	tunnelState := &handlers.TunnelState{}
+
+	// The QR codes point phones to the logged URLs
+	urls := &handlers.ServerURLs{Tunnel: tunnelState}
+
+	if iface != nil {
+		urls.Network = networkURL
+		go s.advertise(iface, ip, serverConfig.GetName())
 	}
 
-	go (func() {
-		tunnel, err := localtunnel.New(PORT, "localhost", localtunnel.Options{})
-		if err != nil {
-			s.logCh <- models.ServerLog{
-				Error: err,
-				Type:  models.SERVE_WEB_UI_REMOTE,
+	var provider tunnel.Provider = tunnel.Disabled{}
+
+	if s.Remote {
+		provider = s.Tunnel
+		if provider == nil {
+			provider, err = tunnel.New(appConfig.GetTunnelConfig())
+			if err != nil {
+				s.bus.PublishEvent(events.RemoteURL{
+					Err: err,
+				})
+				provider = tunnel.Disabled{}
 			}
-			return
 		}
 
-		sendNotification(models.Notification{
-			Title:         "Web Server Ready",
-			Body:          "URL copied to clipboard",
-			ClipboardText: tunnel.URL(),
+		go s.keepTunnel(provider, tunnelState)
+	}
+
+	usersDir, err := users.StoreDir()
+	if err != nil {
+		s.bus.PublishEvent(events.APILog{
+			Err: err,
 		})
+		return err
+	}
 
-		s.logCh <- models.ServerLog{
-			Message: tunnel.URL(),
-			Type:    models.SERVE_WEB_UI_REMOTE,
-		}
-	})()
+	auth := handlers.NewAuth(s.bus, users.NewStore(usersDir))
 
 	mux := http.NewServeMux()
 
-	serverConfig := appConfig.GetSeverConfig()
+	if len(mounts) == 0 {
+		handlerFuncs := handlers.NewHandlers(s.bus, s.Dir, serverConfig, appConfig.GetNotifConfig())
+		handlerFuncs.SetURLs(urls)
+		registerRoutes(mux, handlerFuncs, s.metrics.http)
+	} else {
+		for i, mount := range mounts {
+			handlerFuncs := handlers.NewHandlers(
+				s.bus,
+				mount.GetDir(),
+				serverConfig.ForMount(mount),
+				appConfig.GetNotifConfig(),
+			)
+			handlerFuncs.SetURLs(urls)
+
+			if i == 0 {
+				mux.HandleFunc("GET /assets/{file}", s.metrics.http.Route("GET /assets/{file}", handlerFuncs.GetAssets))
+			}
+
+			mountMux := http.NewServeMux()
+			registerRoutes(mountMux, handlerFuncs, s.metrics.http)
+
+			prefix := "/" + mount.GetName()
+			mux.Handle(prefix+"/", http.StripPrefix(prefix, mountMux))
+		}
+
+		mountsHandlers := handlers.NewMountsHandlers(serverConfig, mounts)
+		mountsHandlers.SetURLs(urls)
 
-	handlerFuncs := handlers.NewHandlers(s.logCh, s.Dir, serverConfig, appConfig.GetNotifConfig())
+		mux.HandleFunc("GET /{$}", s.metrics.http.Route("GET /{$}", mountsHandlers.GetMountsHandler))
+		mux.HandleFunc("GET /api/v1/mounts", s.metrics.http.Route("GET /api/v1/mounts", mountsHandlers.APIMountsHandler))
+		mux.HandleFunc("GET /qr", s.metrics.http.Route("GET /qr", mountsHandlers.QRHandler))
+	}
 
-	mux.HandleFunc("/", handlerFuncs.GetFilesHandler)
-	mux.HandleFunc("/download", handlerFuncs.DownloadFileHandler)
-	mux.HandleFunc("/upload", handlerFuncs.GetFileUpload)
-	mux.HandleFunc("GET /assets/{file}", handlerFuncs.GetAssets)
+	if serverConfig.GetMetrics() {
+		s.serveMetrics(mux, serverConfig.GetMetricsAddr())
+	}
 
 	corsOpts := cors.New(cors.Options{
-		AllowedOrigins: []string{"https://*.loca.lt"},
+		AllowedOrigins:  provider.Origins(),
+		AllowOriginFunc: allowOrigins(provider.Origins()),
 		AllowedMethods: []string{
 			http.MethodGet,
 			http.MethodOptions,
@@ -131,25 +236,278 @@ func (s *Server) Start() {
 		},
 	})
 
-	s.logCh <- models.ServerLog{
+	for _, mount := range mounts {
+		s.bus.PublishEvent(events.APILog{
+			Message: fmt.Sprintf("Serving %v at /%v", mount.GetDir(), mount.GetName()),
+		})
+	}
+
+	s.bus.PublishEvent(events.APILog{
 		Message: fmt.Sprintf("Starting API on port %v from %v", PORT, s.Dir),
-		Type:    models.API_LOG,
+	})
+
+	throttle := handlers.NewThrottle(s.bus, serverConfig, tunnelState)
+
+	// Requests are still published without the file
+	var logger *accesslog.Logger
+
+	logsDir, err := accesslog.Dir()
+	if err == nil {
+		logger, err = accesslog.NewLogger(logsDir, accesslog.MAX_SIZE, accesslog.MAX_BACKUPS)
+	}
+	if err != nil {
+		s.bus.PublishEvent(events.APILog{
+			Err: fmt.Errorf("failed to open access log: %w", err),
+		})
+	} else {
+		defer logger.Close()
 	}
 
-	err = http.ListenAndServe(fmt.Sprintf(":%v", PORT), corsOpts.Handler(mux))
+	access := handlers.NewAccessLogger(s.bus, logger, tunnelState)
+
+	httpServer := &http.Server{
+		Addr:        fmt.Sprintf(":%v", PORT),
+		Handler:     access.Middleware(s.metrics.http.Middleware(throttle.Middleware(corsOpts.Handler(auth.Middleware(mux))))),
+		ConnContext: throttle.ConnContext,
+	}
+
+	err = httpServer.ListenAndServe()
 	if err != nil {
-		s.logCh <- models.ServerLog{
-			Error: err,
-			Type:  models.API_LOG,
+		s.bus.PublishEvent(events.APILog{
+			Err: err,
+		})
+	}
+
+	return err
+}
+
+// advertise announces the server as name on the local network
+// of iface, for discover commands to find it
+func (s *Server) advertise(iface *net.Interface, ip net.IP, name string) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ip.String()
+	}
+
+	responder, err := mdns.NewResponder(iface, mdns.Service{
+		Instance: name,
+		Host:     strings.Split(hostname, ".")[0],
+		Port:     PORT,
+		IPs:      []net.IP{ip},
+		Text:     map[string]string{"name": name},
+	})
+	if err == nil {
+		err = responder.Serve(context.Background())
+	}
+
+	s.bus.PublishEvent(events.APILog{
+		Err: fmt.Errorf("failed to advertise on the local network: %w", err),
+	})
+}
+
+// keepTunnel exposes the server remotely through provider,
+// reconnecting whenever the tunnel drops
+func (s *Server) keepTunnel(provider tunnel.Provider, state *handlers.TunnelState) {
+	// Only the first failure after the tunnel was up is notified
+	wasUp := false
+
+	reconnector := &tunnel.Reconnector{
+		Provider: provider,
+		Port:     PORT,
+		OnUp: func(t tunnel.Tunnel) {
+			wasUp = true
+			state.SetUp(t.URL(), provider.ForwardsClients())
+			s.metrics.tunnelUp.Set(1)
+
+			sendNotification(models.Notification{
+				Title:         "Web Server Ready",
+				Body:          "URL copied to clipboard",
+				ClipboardText: t.URL(),
+			})
+
+			s.bus.PublishEvent(events.RemoteURL{
+				URL: t.URL(),
+			})
+
+			s.bus.PublishEvent(events.TunnelUp{
+				URL: t.URL(),
+			})
+		},
+		OnDown: func(err error, retryIn time.Duration) {
+			state.SetDown()
+			s.metrics.tunnelUp.Set(0)
+
+			if wasUp {
+				wasUp = false
+
+				sendNotification(models.Notification{
+					Title: "Remote access lost",
+					Body:  "Reconnecting the tunnel",
+				})
+			}
+
+			s.bus.PublishEvent(events.TunnelDown{
+				Message: fmt.Sprintf("Reconnecting in %v", retryIn),
+				Err:     err,
+			})
+		},
+	}
+
+	err := reconnector.Run(context.Background())
+	if errors.Is(err, tunnel.ErrDisabled) {
+		s.bus.PublishEvent(events.APILog{
+			Message: "Remote access is disabled in svault.toml",
+		})
+	}
+}
+
+// allowOrigins refuses every cross origin request when there are
+// no origins, which cors would otherwise take as allowing all
+func allowOrigins(origins []string) func(origin string) bool {
+	if len(origins) > 0 {
+		return nil
+	}
+
+	return func(origin string) bool {
+		return false
+	}
+}
+
+// mounts returns the directories to serve under their names.
+// When there are any, Dir is served as a mount named after it
+func (s *Server) mounts(serverConfig *config.ServerConfig) []*config.MountConfig {
+	mounts := []*config.MountConfig{}
+	byName := map[string]int{}
+
+	add := func(mount *config.MountConfig) {
+		if i, ok := byName[mount.GetName()]; ok {
+			mounts[i] = mount
+			return
+		}
+
+		byName[mount.GetName()] = len(mounts)
+		mounts = append(mounts, mount)
+	}
+
+	for _, mount := range serverConfig.GetMounts() {
+		add(mount)
+	}
+
+	names := make([]string, 0, len(s.Mounts))
+	for name := range s.Mounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Mounts given to the server alone get the server's permissions
+	// and keep those of svault.toml when they replace one
+	for _, name := range names {
+		if !config.ValidMountName(name) {
+			s.bus.PublishEvent(events.APILog{
+				Err: fmt.Errorf("invalid mount name %q", name),
+			})
+			continue
+		}
+
+		mount := config.NewMountConfig(name, s.Mounts[name]).
+			SetAllowUploads(serverConfig.GetAllowUploads()).
+			SetAllowModify(serverConfig.GetAllowModify()).
+			SetAllowDelete(serverConfig.GetAllowDelete())
+
+		if i, ok := byName[name]; ok {
+			existing := mounts[i]
+			mount.SetAllowUploads(existing.GetAllowUploads()).
+				SetAllowModify(existing.GetAllowModify()).
+				SetAllowDelete(existing.GetAllowDelete())
+		}
+
+		add(mount)
+	}
+
+	if len(mounts) > 0 && s.Dir != "" {
+		name := filepath.Base(s.Dir)
+		if !config.ValidMountName(name) {
+			name = "files"
 		}
+
+		if _, ok := byName[name]; !ok {
+			add(config.NewMountConfig(name, s.Dir).
+				SetAllowUploads(serverConfig.GetAllowUploads()).
+				SetAllowModify(serverConfig.GetAllowModify()).
+				SetAllowDelete(serverConfig.GetAllowDelete()))
+		}
+	}
+
+	return mounts
+}
+
+// registerRoutes adds the routes of the web UI and API of h to mux,
+// labelled with their patterns in the metrics of m
+func registerRoutes(mux *http.ServeMux, h *handlers.Handlers, m *handlers.Metrics) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, m.Route(pattern, handler))
 	}
+
+	handle("/", h.GetFilesHandler)
+	handle("/download", h.DownloadFileHandler)
+	handle("GET /view", h.ViewFileHandler)
+	handle("GET /preview", h.PreviewFileHandler)
+	handle("GET /thumb", h.ThumbnailHandler)
+	handle("GET /search", h.SearchHandler)
+	handle("GET /events", h.EventsHandler)
+	handle("/upload", h.GetFileUpload)
+	handle("GET /assets/{file}", h.GetAssets)
+	handle("/dav/", h.DavHandler)
+	handle("GET /qr", h.QRHandler)
+
+	handle("GET /api/v1/files", h.APIFilesHandler)
+	handle("GET /api/v1/download", h.APIDownloadHandler)
+	handle("POST /api/v1/upload", h.APIUploadHandler)
+	handle("POST /api/v1/uploads", h.APICreateUploadHandler)
+	handle("GET /api/v1/uploads/{id}", h.APIUploadStatusHandler)
+	handle("PATCH /api/v1/uploads/{id}", h.APIUploadChunkHandler)
+	handle("DELETE /api/v1/uploads/{id}", h.APICancelUploadHandler)
+	handle("POST /api/v1/mkdir", h.APIMkdirHandler)
+	handle("POST /api/v1/rename", h.APIRenameHandler)
+	handle("POST /api/v1/move", h.APIMoveHandler)
+	handle("POST /api/v1/delete", h.APIDeleteHandler)
+	handle("GET /api/v1/search", h.APISearchHandler)
+	handle("GET /api/v1/info", h.APIInfoHandler)
+	handle("GET /api/v1/config", h.APIConfigHandler)
+}
+
+// serveMetrics serves the metrics at /metrics of mux, or on
+// their own listener when addr is set
+func (s *Server) serveMetrics(mux *http.ServeMux, addr string) {
+	if addr == "" {
+		mux.Handle("GET /metrics", s.metrics.registry.Handler())
+		return
+	}
+
+	s.bus.PublishEvent(events.APILog{
+		Message: fmt.Sprintf("Serving metrics on %v", addr),
+	})
+
+	go func() {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", s.metrics.registry.Handler())
+
+		if err := http.ListenAndServe(addr, metricsMux); err != nil {
+			s.bus.PublishEvent(events.APILog{
+				Err: fmt.Errorf("failed to serve metrics: %w", err),
+			})
+		}
+	}()
 }
 
 // Send a file through a wormhole from a device
 // TODO: Support directories
 func (s *Server) Share(file string, callbacks ShareCallBacks) {
+	done := s.metrics.transferStarted(SEND)
+
 	f, err := os.Open(file)
 	if err != nil {
+		done(err)
 		callbacks.OnSendErr(err)
 
 		return
@@ -169,6 +527,9 @@ func (s *Server) Share(file string, callbacks ShareCallBacks) {
 	}
 
 	code, st, err := c.SendFile(ctx, file, f, wormhole.WithProgress(handleProgress))
+	if err != nil {
+		done(err)
+	}
 
 	if err != nil && callbacks.OnSendErr != nil {
 		callbacks.OnSendErr(err)
@@ -193,6 +554,8 @@ func (s *Server) Share(file string, callbacks ShareCallBacks) {
 		for {
 			select {
 			case status := <-st:
+				done(status.Error)
+
 				if status.Error != nil && callbacks.OnSendErr != nil {
 					callbacks.OnSendErr(status.Error)
 
@@ -225,7 +588,10 @@ func (s *Server) Share(file string, callbacks ShareCallBacks) {
 
 // Receive file from device through wormhole
 // Saves file to the svault dir in the Downloads directory
-func (s *Server) Receive(code string) error {
+func (s *Server) Receive(code string) (err error) {
+	done := s.metrics.transferStarted(RECEIVE)
+	defer func() { done(err) }()
+
 	var c wormhole.Client
 
 	ctx := context.Background()